@@ -0,0 +1,189 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/Trishvan/queuectl/internal/store"
+	"github.com/Trishvan/queuectl/internal/worker"
+	"github.com/olekukonko/tablewriter"
+	"github.com/spf13/cobra"
+)
+
+var benchCmd = &cobra.Command{
+	Use:    "bench",
+	Short:  "Measure store throughput for short jobs",
+	Hidden: true,
+	Long: `Measure how many jobs per second the store can claim and complete, with the jobs doing no work.
+
+Each mode runs against its own temporary database:
+  single  every worker claims with FindAndLockJob and saves each result with its own commits
+  batch   one claimer hands out jobs from ClaimJobs and a CompletionWriter saves results in batches`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		jobs, _ := cmd.Flags().GetInt("jobs")
+		workers, _ := cmd.Flags().GetInt("workers")
+		if jobs < 1 || workers < 1 {
+			return fmt.Errorf("--jobs and --workers must be positive")
+		}
+
+		dir, err := os.MkdirTemp("", "queuectl-bench-")
+		if err != nil {
+			return err
+		}
+		defer os.RemoveAll(dir)
+
+		modes := []struct {
+			name string
+			run  func(s store.Store, workers int) int64
+		}{
+			{"single", benchSingle},
+			{"batch", benchBatch},
+		}
+
+		table := tablewriter.NewWriter(os.Stdout)
+		table.SetHeader([]string{"Mode", "Jobs", "Workers", "Duration", "Jobs/sec", "Busy Errors"})
+		for _, mode := range modes {
+			s, err := store.NewSQLiteStore(filepath.Join(dir, mode.name+".db"))
+			if err != nil {
+				return fmt.Errorf("failed to create database: %w", err)
+			}
+			if err := benchEnqueue(s, jobs); err != nil {
+				s.Close()
+				return fmt.Errorf("failed to enqueue jobs: %w", err)
+			}
+
+			start := time.Now()
+			busy := mode.run(s, workers)
+			elapsed := time.Since(start)
+
+			summary, err := s.GetStatusSummary("")
+			s.Close()
+			if err != nil {
+				return err
+			}
+			if summary[store.StateCompleted] != jobs {
+				return fmt.Errorf("%s: only %d of %d jobs completed", mode.name, summary[store.StateCompleted], jobs)
+			}
+
+			table.Append([]string{
+				mode.name,
+				fmt.Sprintf("%d", jobs),
+				fmt.Sprintf("%d", workers),
+				elapsed.Round(time.Millisecond).String(),
+				fmt.Sprintf("%.0f", float64(jobs)/elapsed.Seconds()),
+				fmt.Sprintf("%d", busy),
+			})
+		}
+		table.Render()
+		return nil
+	},
+}
+
+func benchEnqueue(s store.Store, n int) error {
+	for i := 0; i < n; i++ {
+		job, err := store.NewJobFromSpec(fmt.Sprintf(`{"id":"bench-%d","command":"true"}`, i), cfg.MaxRetries)
+		if err != nil {
+			return err
+		}
+		if _, err := s.Enqueue(job); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// benchResult fills in the outcome of a job that succeeded instantly.
+func benchResult(job *store.Job, owner string) *store.JobResult {
+	now := time.Now().UTC()
+	lease := job.LeaseOwner
+	job.State = store.StateCompleted
+	job.LeaseOwner = ""
+	job.LeaseExpiresAt = time.Time{}
+	return &store.JobResult{
+		Job:     job,
+		Attempt: &store.Attempt{JobID: job.ID, Rerun: job.Reruns, Attempt: job.Attempts, Worker: owner, StartedAt: now, FinishedAt: now},
+		Lease:   lease,
+	}
+}
+
+// benchBackoff is how long a failed store operation waits before it is tried again.
+const benchBackoff = 10 * time.Millisecond
+
+// benchRetry runs op until it succeeds, counting the failures, which under contention are
+// SQLite giving up on the write lock.
+func benchRetry(errors *int64, op func() error) {
+	for op() != nil {
+		atomic.AddInt64(errors, 1)
+		time.Sleep(benchBackoff)
+	}
+}
+
+func benchSingle(s store.Store, workers int) int64 {
+	var errors int64
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func(owner string) {
+			defer wg.Done()
+			for {
+				var job *store.Job
+				benchRetry(&errors, func() (err error) {
+					job, err = s.FindAndLockJob(store.ClaimOptions{Owner: owner, Lease: cfg.LeaseDuration.Duration})
+					return err
+				})
+				if job == nil {
+					return
+				}
+				r := benchResult(job, owner)
+				benchRetry(&errors, func() error { return s.RecordAttempt(r.Attempt) })
+				benchRetry(&errors, func() error { return s.UpdateJob(r.Job, r.Lease) })
+			}
+		}(fmt.Sprintf("bench:%d", i))
+	}
+	wg.Wait()
+	return atomic.LoadInt64(&errors)
+}
+
+func benchBatch(s store.Store, workers int) int64 {
+	var errors int64
+	completions := worker.NewCompletionWriter(s, nil)
+
+	queue := make(chan *store.Job, workers)
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func(owner string) {
+			defer wg.Done()
+			for job := range queue {
+				completions.Submit(benchResult(job, owner))
+			}
+		}(fmt.Sprintf("bench:%d", i))
+	}
+
+	for {
+		var jobs []*store.Job
+		benchRetry(&errors, func() (err error) {
+			jobs, err = s.ClaimJobs(store.ClaimOptions{Owner: "bench", Lease: cfg.LeaseDuration.Duration}, workers)
+			return err
+		})
+		if len(jobs) == 0 {
+			break
+		}
+		for _, job := range jobs {
+			queue <- job
+		}
+	}
+	close(queue)
+	wg.Wait()
+	completions.Close()
+	return atomic.LoadInt64(&errors)
+}
+
+func init() {
+	benchCmd.Flags().Int("jobs", 5000, "Number of jobs to run in each mode")
+	benchCmd.Flags().Int("workers", 8, "Number of workers")
+}
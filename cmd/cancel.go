@@ -0,0 +1,31 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+)
+
+var cancelCmd = &cobra.Command{
+	Use:   "cancel <job_id>",
+	Short: "Cancel a pending or running job",
+	Long: `Cancel a pending or running job.
+
+A pending job is cancelled immediately. A running job is flagged, and the worker running it
+kills its command at its next heartbeat. Cancelled jobs are never retried or moved to the DLQ.`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		jobID := args[0]
+		cancelled, err := db.CancelJob(jobID)
+		if err != nil {
+			return jobError("cancel", jobID, err)
+		}
+
+		if cancelled {
+			fmt.Printf("Job %s has been cancelled.\n", jobID)
+		} else {
+			fmt.Printf("Job %s is running; cancellation requested. Its worker will stop it shortly.\n", jobID)
+		}
+		return nil
+	},
+}
@@ -0,0 +1,83 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+
+	"github.com/Trishvan/queuectl/internal/store"
+	"github.com/olekukonko/tablewriter"
+	"github.com/spf13/cobra"
+)
+
+var concurrencyCmd = &cobra.Command{
+	Use:   "concurrency",
+	Short: "Inspect the concurrency keys that limit jobs running at once",
+}
+
+var concurrencyShowCmd = &cobra.Command{
+	Use:   "show <key>",
+	Short: "Show the jobs holding a concurrency key and the jobs waiting for it",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		key := args[0]
+		if key == "" {
+			return fmt.Errorf("the concurrency key cannot be empty")
+		}
+		jobs, err := db.ListJobsByConcurrencyKey(key)
+		if err != nil {
+			return fmt.Errorf("failed to list jobs with concurrency key %s: %w", key, err)
+		}
+		if len(jobs) == 0 {
+			fmt.Printf("No jobs hold or wait for concurrency key %s.\n", key)
+			return nil
+		}
+
+		var holders, waiters []*store.Job
+		for _, job := range jobs {
+			if job.State == store.StateProcessing {
+				holders = append(holders, job)
+			} else {
+				waiters = append(waiters, job)
+			}
+		}
+		fmt.Printf("Concurrency key %s: %d running, %d waiting\n", key, len(holders), len(waiters))
+
+		if len(holders) > 0 {
+			fmt.Println("\nHolders:")
+			table := tablewriter.NewWriter(os.Stdout)
+			table.SetHeader([]string{"ID", "Queue", "Limit", "Lease Owner", "Lease Expires At"})
+			for _, job := range holders {
+				table.Append([]string{
+					job.ID,
+					job.Queue,
+					strconv.Itoa(job.ConcurrencyLimit),
+					job.LeaseOwner,
+					job.LeaseExpiresAt.Format("2006-01-02 15:04:05"),
+				})
+			}
+			table.Render()
+		}
+
+		if len(waiters) > 0 {
+			fmt.Println("\nWaiting:")
+			table := tablewriter.NewWriter(os.Stdout)
+			table.SetHeader([]string{"ID", "Queue", "Limit", "Priority", "Next Run At"})
+			for _, job := range waiters {
+				table.Append([]string{
+					job.ID,
+					job.Queue,
+					strconv.Itoa(job.ConcurrencyLimit),
+					strconv.Itoa(job.Priority),
+					job.NextRunAt.Format("2006-01-02 15:04:05"),
+				})
+			}
+			table.Render()
+		}
+		return nil
+	},
+}
+
+func init() {
+	concurrencyCmd.AddCommand(concurrencyShowCmd)
+}
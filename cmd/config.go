@@ -3,7 +3,10 @@ package cmd
 import (
 	"fmt"
 	"strconv"
+	"time"
 
+	"github.com/Trishvan/queuectl/internal/config"
+	"github.com/Trishvan/queuectl/internal/store"
 	"github.com/spf13/cobra"
 )
 
@@ -33,6 +36,57 @@ var configSetCmd = &cobra.Command{
 				return fmt.Errorf("invalid value for backoff-base: %s", value)
 			}
 			cfg.BackoffBase = base
+		case "lease-duration":
+			lease, err := time.ParseDuration(value)
+			if err != nil || lease <= 0 {
+				return fmt.Errorf("invalid value for lease-duration: %s", value)
+			}
+			cfg.LeaseDuration = config.Duration{Duration: lease}
+		case "output-limit":
+			limit, err := strconv.Atoi(value)
+			if err != nil || limit < 0 {
+				return fmt.Errorf("invalid value for output-limit: %s", value)
+			}
+			cfg.OutputLimit = limit
+		case "priority-aging":
+			aging, err := time.ParseDuration(value)
+			if err != nil || aging < 0 {
+				return fmt.Errorf("invalid value for priority-aging: %s", value)
+			}
+			cfg.PriorityAging = config.Duration{Duration: aging}
+		case "default-timeout":
+			timeout, err := time.ParseDuration(value)
+			if err != nil || timeout < 0 {
+				return fmt.Errorf("invalid value for default-timeout: %s", value)
+			}
+			cfg.DefaultTimeout = config.Duration{Duration: timeout}
+		case "kill-grace":
+			grace, err := time.ParseDuration(value)
+			if err != nil || grace < 0 {
+				return fmt.Errorf("invalid value for kill-grace: %s", value)
+			}
+			cfg.KillGrace = config.Duration{Duration: grace}
+		case "retry-timeouts":
+			retry, err := strconv.ParseBool(value)
+			if err != nil {
+				return fmt.Errorf("invalid value for retry-timeouts: %s", value)
+			}
+			cfg.RetryTimeouts = retry
+		case "retry-on-exit-codes":
+			codes, err := store.ParseExitCodes(value)
+			if err != nil {
+				return fmt.Errorf("invalid value for retry-on-exit-codes: %w", err)
+			}
+			cfg.RetryOnExitCodes = codes
+		case "fail-fast-exit-codes":
+			codes, err := store.ParseExitCodes(value)
+			if err != nil {
+				return fmt.Errorf("invalid value for fail-fast-exit-codes: %w", err)
+			}
+			cfg.FailFastExitCodes = codes
+		case "database-url":
+			// An empty value goes back to the local SQLite database.
+			cfg.DatabaseURL = value
 		default:
 			return fmt.Errorf("unknown configuration key: %s", key)
 		}
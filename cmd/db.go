@@ -0,0 +1,101 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/Trishvan/queuectl/internal/store"
+	"github.com/spf13/cobra"
+)
+
+var dbCmd = &cobra.Command{
+	Use:   "db",
+	Short: "Inspect and migrate the database schema",
+	Long: `Inspect and migrate the database schema.
+
+Every other command migrates the database when it opens it. These commands open it without
+doing so, so that pending migrations can be reviewed first.`,
+}
+
+var dbVersionCmd = &cobra.Command{
+	Use:   "version",
+	Short: "Show the schema version of the database",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		m, err := migrator()
+		if err != nil {
+			return err
+		}
+		current, latest, err := m.SchemaVersion()
+		if err != nil {
+			return fmt.Errorf("failed to read schema version: %w", err)
+		}
+
+		fmt.Printf("Schema version %d (latest known: %d)\n", current, latest)
+		switch {
+		case current > latest:
+			fmt.Println("The database was migrated by a newer queuectl. Upgrade queuectl to use it.")
+		case current < latest:
+			fmt.Printf("%d migration(s) pending. Run 'queuectl db migrate' to apply them.\n", latest-current)
+		default:
+			fmt.Println("The database is up to date.")
+		}
+		return nil
+	},
+}
+
+var dbMigrateCmd = &cobra.Command{
+	Use:   "migrate",
+	Short: "Apply pending schema migrations",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		dryRun, _ := cmd.Flags().GetBool("dry-run")
+		m, err := migrator()
+		if err != nil {
+			return err
+		}
+
+		if dryRun {
+			pending, err := m.PendingMigrations()
+			if err != nil {
+				return err
+			}
+			if len(pending) == 0 {
+				fmt.Println("The database is up to date.")
+				return nil
+			}
+			fmt.Printf("Would apply %d migration(s):\n", len(pending))
+			for _, mig := range pending {
+				fmt.Printf("  %d  %s\n", mig.Version, mig.Name)
+			}
+			return nil
+		}
+
+		applied, err := m.Migrate()
+		for _, mig := range applied {
+			fmt.Printf("Applied migration %d: %s\n", mig.Version, mig.Name)
+		}
+		if err != nil {
+			return fmt.Errorf("migration failed: %w", err)
+		}
+		if len(applied) == 0 {
+			fmt.Println("The database is up to date.")
+		}
+		return nil
+	},
+}
+
+// migrator returns the opened store as a store.Migrator.
+func migrator() (store.Migrator, error) {
+	m, ok := db.(store.Migrator)
+	if !ok {
+		return nil, errors.New("this store has no versioned schema")
+	}
+	return m, nil
+}
+
+func init() {
+	dbMigrateCmd.Flags().Bool("dry-run", false, "List the migrations that would be applied without applying them")
+	dbCmd.AddCommand(dbVersionCmd)
+	dbCmd.AddCommand(dbMigrateCmd)
+}
@@ -3,9 +3,9 @@ package cmd
 import (
 	"fmt"
 	"os"
-	"time"
 
 	"github.com/Trishvan/queuectl/internal/store"
+	"github.com/Trishvan/queuectl/internal/worker"
 	"github.com/olekukonko/tablewriter"
 	"github.com/spf13/cobra"
 )
@@ -19,7 +19,8 @@ var dlqListCmd = &cobra.Command{
 	Use:   "list",
 	Short: "List all jobs in the DLQ",
 	RunE: func(cmd *cobra.Command, args []string) error {
-		jobs, err := db.ListJobsByState(store.StateDead)
+		queue, _ := cmd.Flags().GetString("queue")
+		jobs, err := db.ListJobsByState(store.StateDead, queue)
 		if err != nil {
 			return fmt.Errorf("failed to list DLQ jobs: %w", err)
 		}
@@ -30,12 +31,18 @@ var dlqListCmd = &cobra.Command{
 		}
 
 		table := tablewriter.NewWriter(os.Stdout)
-		table.SetHeader([]string{"ID", "Command", "Attempts", "Created At", "Updated At"})
+		table.SetHeader([]string{"ID", "Queue", "Command", "Attempts", "Reason", "Created At", "Updated At"})
 		for _, job := range jobs {
+			reason, err := deadReason(job)
+			if err != nil {
+				return fmt.Errorf("failed to get attempts for job %s: %w", job.ID, err)
+			}
 			table.Append([]string{
 				job.ID,
+				job.Queue,
 				job.Command,
 				fmt.Sprintf("%d", job.Attempts),
+				reason,
 				job.CreatedAt.Format("2006-01-02 15:04:05"),
 				job.UpdatedAt.Format("2006-01-02 15:04:05"),
 			})
@@ -45,6 +52,27 @@ var dlqListCmd = &cobra.Command{
 	},
 }
 
+// deadReason describes why a job was dead-lettered, based on its last recorded attempt.
+func deadReason(job *store.Job) (string, error) {
+	attempts, err := db.ListAttempts(job.ID)
+	if err != nil {
+		return "", err
+	}
+	if len(attempts) == 0 {
+		// Jobs reclaimed after their worker died have no attempt record.
+		return "lease expired", nil
+	}
+	last := attempts[len(attempts)-1]
+	switch last.Reason {
+	case store.ReasonExitCode:
+		return fmt.Sprintf("%s (exit %d)", last.Classification, last.ExitCode), nil
+	case "":
+		return string(last.Classification), nil
+	default:
+		return fmt.Sprintf("%s (%s)", last.Classification, last.Reason), nil
+	}
+}
+
 var dlqRetryCmd = &cobra.Command{
 	Use:   "retry <job_id>",
 	Short: "Retry a job from the DLQ",
@@ -59,15 +87,16 @@ var dlqRetryCmd = &cobra.Command{
 		if job.State != store.StateDead {
 			return fmt.Errorf("job %s is not in the DLQ (current state: %s)", jobID, job.State)
 		}
+		if queue, _ := cmd.Flags().GetString("queue"); queue != "" && job.Queue != queue {
+			return fmt.Errorf("job %s is in queue %s, not %s", jobID, job.Queue, queue)
+		}
 
-		// Reset job for retry
-		job.State = store.StatePending
-		job.Attempts = 0
-		job.NextRunAt = time.Now().UTC()
+		job.ResetForRetry()
 
-		if err := db.UpdateJob(job); err != nil {
+		if err := db.UpdateJob(job, ""); err != nil {
 			return fmt.Errorf("failed to retry job %s: %w", jobID, err)
 		}
+		worker.NotifyManagers()
 
 		fmt.Printf("Job %s has been moved from DLQ back to the pending queue.\n", jobID)
 		return nil
@@ -75,6 +104,7 @@ var dlqRetryCmd = &cobra.Command{
 }
 
 func init() {
+	dlqCmd.PersistentFlags().String("queue", "", "Only operate on jobs in this queue")
 	dlqCmd.AddCommand(dlqListCmd)
 	dlqCmd.AddCommand(dlqRetryCmd)
 }
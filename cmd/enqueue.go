@@ -2,8 +2,10 @@ package cmd
 
 import (
 	"fmt"
+	"time"
 
 	"github.com/Trishvan/queuectl/internal/store"
+	"github.com/Trishvan/queuectl/internal/worker"
 	"github.com/spf13/cobra"
 )
 
@@ -18,11 +20,52 @@ var enqueueCmd = &cobra.Command{
 			return fmt.Errorf("invalid job spec: %w", err)
 		}
 
-		if err := db.Enqueue(job); err != nil {
+		at, _ := cmd.Flags().GetString("at")
+		in, _ := cmd.Flags().GetDuration("in")
+		switch {
+		case at != "" && cmd.Flags().Changed("in"):
+			return fmt.Errorf("--at and --in cannot be used together")
+		case at != "":
+			runAt, err := time.Parse(time.RFC3339, at)
+			if err != nil {
+				return fmt.Errorf("invalid --at: %w", err)
+			}
+			job.NextRunAt = runAt.UTC()
+		case cmd.Flags().Changed("in"):
+			if in < 0 {
+				return fmt.Errorf("invalid --in: %s is negative", in)
+			}
+			job.NextRunAt = time.Now().UTC().Add(in)
+		}
+
+		res, err := db.Enqueue(job)
+		if err != nil {
 			return fmt.Errorf("failed to enqueue job: %w", err)
 		}
+		if res.Duplicate {
+			fmt.Printf("Duplicate of job %s (idempotency key %q), not enqueued\n", res.JobID, job.IdempotencyKey)
+			return nil
+		}
+		worker.NotifyManagers(job)
 
+		switch job.State {
+		case store.StateBlocked:
+			fmt.Printf("Successfully enqueued job with ID: %s (blocked until its dependencies complete)\n", job.ID)
+			return nil
+		case store.StateCancelled:
+			fmt.Printf("Enqueued job with ID: %s, but it was cancelled because a dependency has already failed\n", job.ID)
+			return nil
+		}
+		if job.NextRunAt.After(time.Now().UTC()) {
+			fmt.Printf("Successfully enqueued job with ID: %s (scheduled for %s)\n", job.ID, job.NextRunAt.Format(time.RFC3339))
+			return nil
+		}
 		fmt.Printf("Successfully enqueued job with ID: %s\n", job.ID)
 		return nil
 	},
 }
+
+func init() {
+	enqueueCmd.Flags().String("at", "", "Run the job at this RFC3339 time (overrides run_at in the spec)")
+	enqueueCmd.Flags().Duration("in", 0, "Run the job after this delay, e.g. 10m (overrides delay in the spec)")
+}
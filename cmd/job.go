@@ -0,0 +1,182 @@
+package cmd
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/Trishvan/queuectl/internal/store"
+	"github.com/spf13/cobra"
+)
+
+var jobCmd = &cobra.Command{
+	Use:     "job",
+	Aliases: []string{"jobs"},
+	Short:   "Inspect and manage individual jobs",
+}
+
+var jobReclaimCmd = &cobra.Command{
+	Use:   "reclaim",
+	Short: "Return orphaned processing jobs to the queue",
+	Long: `Return jobs stuck in the processing state to pending, or to the DLQ if they have no retries left.
+
+By default only jobs whose lease has expired are reclaimed. Use --all after a crash, once you
+are sure no manager is still running, to reclaim every processing job immediately.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		all, _ := cmd.Flags().GetBool("all")
+
+		cutoff := time.Now().UTC()
+		if all {
+			// Every live lease expires before this, so nothing is left in processing.
+			cutoff = cutoff.Add(100 * 365 * 24 * time.Hour)
+		}
+
+		requeued, dead, err := db.ReclaimExpiredLeases(cutoff)
+		if err != nil {
+			return fmt.Errorf("failed to reclaim jobs: %w", err)
+		}
+
+		fmt.Printf("Reclaimed %d jobs to pending, moved %d jobs to the DLQ.\n", requeued, dead)
+		return nil
+	},
+}
+
+var jobSetPriorityCmd = &cobra.Command{
+	Use:   "set-priority <job_id> <priority>",
+	Short: "Change the priority of a pending job",
+	Args:  cobra.ExactArgs(2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		jobID := args[0]
+		priority, err := strconv.Atoi(args[1])
+		if err != nil {
+			return fmt.Errorf("invalid priority: %s", args[1])
+		}
+
+		if err := db.SetPriority(jobID, priority); err != nil {
+			return jobError("set the priority of", jobID, err)
+		}
+
+		fmt.Printf("Job %s priority set to %d.\n", jobID, priority)
+		return nil
+	},
+}
+
+var jobGraphCmd = &cobra.Command{
+	Use:   "graph <job_id>",
+	Short: "Show the dependency graph a job belongs to",
+	Long: `Show every job connected to a job through depends_on, with its state.
+
+Each job is printed under the jobs it depends on, starting from the jobs that depend on
+nothing. A job with several dependencies appears under each of them, in full the first time.
+The job asked about is marked with *.`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		jobID := args[0]
+		if _, err := db.GetJob(jobID); err != nil {
+			return fmt.Errorf("failed to get job %s: %w", jobID, err)
+		}
+
+		g, err := loadJobGraph(jobID)
+		if err != nil {
+			return fmt.Errorf("failed to load the graph of job %s: %w", jobID, err)
+		}
+		g.print(jobID)
+		return nil
+	},
+}
+
+// jobGraph is the part of the dependency graph connected to one job.
+type jobGraph struct {
+	states     map[string]store.JobState
+	dependsOn  map[string][]string
+	dependents map[string][]string
+}
+
+// loadJobGraph walks the dependencies of id in both directions.
+func loadJobGraph(id string) (*jobGraph, error) {
+	g := &jobGraph{
+		states:     make(map[string]store.JobState),
+		dependsOn:  make(map[string][]string),
+		dependents: make(map[string][]string),
+	}
+	queue := []string{id}
+	for len(queue) > 0 {
+		id := queue[0]
+		queue = queue[1:]
+		if _, ok := g.states[id]; ok {
+			continue
+		}
+		job, err := db.GetJob(id)
+		if err != nil {
+			return nil, err
+		}
+		dependsOn, dependents, err := db.JobDependencies(id)
+		if err != nil {
+			return nil, err
+		}
+		g.states[id] = job.State
+		g.dependsOn[id] = dependsOn
+		g.dependents[id] = dependents
+		queue = append(queue, dependsOn...)
+		queue = append(queue, dependents...)
+	}
+	return g, nil
+}
+
+// print draws the graph as a tree for each job that depends on nothing, marking the job
+// it was loaded for.
+func (g *jobGraph) print(selected string) {
+	var roots []string
+	for id := range g.states {
+		if len(g.dependsOn[id]) == 0 {
+			roots = append(roots, id)
+		}
+	}
+	sort.Strings(roots)
+
+	shown := make(map[string]bool)
+	var printNode func(id, prefix, branch, indent string)
+	printNode = func(id, prefix, branch, indent string) {
+		line := fmt.Sprintf("%s%s%s [%s]", prefix, branch, id, g.states[id])
+		if id == selected {
+			line += " *"
+		}
+		if shown[id] {
+			fmt.Println(line + " (shown above)")
+			return
+		}
+		fmt.Println(line)
+		shown[id] = true
+
+		children := g.dependents[id]
+		for i, child := range children {
+			if i == len(children)-1 {
+				printNode(child, prefix+indent, "└── ", "    ")
+			} else {
+				printNode(child, prefix+indent, "├── ", "│   ")
+			}
+		}
+	}
+	for _, root := range roots {
+		printNode(root, "", "", "")
+	}
+}
+
+// jobError describes err, returned while trying to do something to job id, reporting a
+// job that does not exist as not found rather than with the store's error.
+func jobError(action, id string, err error) error {
+	if errors.Is(err, sql.ErrNoRows) {
+		return fmt.Errorf("job %s not found", id)
+	}
+	return fmt.Errorf("failed to %s job %s: %w", action, id, err)
+}
+
+func init() {
+	jobCmd.AddCommand(jobGraphCmd)
+	jobCmd.AddCommand(jobSetPriorityCmd)
+	jobReclaimCmd.Flags().Bool("all", false, "Reclaim all processing jobs, even those with an unexpired lease")
+	jobCmd.AddCommand(jobReclaimCmd)
+}
@@ -15,16 +15,17 @@ var listCmd = &cobra.Command{
 	Short: "List jobs by state",
 	RunE: func(cmd *cobra.Command, args []string) error {
 		stateStr, _ := cmd.Flags().GetString("state")
+		queue, _ := cmd.Flags().GetString("queue")
 		state := store.JobState(strings.ToLower(stateStr))
 
 		validStates := map[store.JobState]bool{
-			store.StatePending: true, store.StateProcessing: true, store.StateCompleted: true, store.StateFailed: true, store.StateDead: true,
+			store.StatePending: true, store.StateScheduled: true, store.StateBlocked: true, store.StateProcessing: true, store.StateCompleted: true, store.StateFailed: true, store.StateDead: true, store.StateCancelled: true,
 		}
 		if !validStates[state] {
-			return fmt.Errorf("invalid state: %s. valid states are pending, processing, completed, failed, dead", stateStr)
+			return fmt.Errorf("invalid state: %s. valid states are pending, scheduled, blocked, processing, completed, failed, dead, cancelled", stateStr)
 		}
 
-		jobs, err := db.ListJobsByState(state)
+		jobs, err := db.ListJobsByState(state, queue)
 		if err != nil {
 			return fmt.Errorf("failed to list jobs: %w", err)
 		}
@@ -35,14 +36,17 @@ var listCmd = &cobra.Command{
 		}
 
 		table := tablewriter.NewWriter(os.Stdout)
-		table.SetHeader([]string{"ID", "Command", "Attempts", "Created At", "Updated At"})
+		table.SetHeader([]string{"ID", "Queue", "Priority", "Command", "Attempts", "Created At", "Updated At", "Next Run At"})
 		for _, job := range jobs {
 			table.Append([]string{
 				job.ID,
+				job.Queue,
+				fmt.Sprintf("%d", job.Priority),
 				job.Command,
 				fmt.Sprintf("%d", job.Attempts),
 				job.CreatedAt.Format("2006-01-02 15:04:05"),
 				job.UpdatedAt.Format("2006-01-02 15:04:05"),
+				job.NextRunAt.Format("2006-01-02 15:04:05"),
 			})
 		}
 		table.Render()
@@ -51,5 +55,6 @@ var listCmd = &cobra.Command{
 }
 
 func init() {
-	listCmd.Flags().String("state", "pending", "State of the jobs to list (pending, processing, completed, failed, dead)")
+	listCmd.Flags().String("state", "pending", "State of the jobs to list (pending, scheduled, blocked, processing, completed, failed, dead, cancelled)")
+	listCmd.Flags().String("queue", "", "Only list jobs in this queue")
 }
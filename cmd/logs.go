@@ -0,0 +1,91 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/Trishvan/queuectl/internal/store"
+	"github.com/spf13/cobra"
+)
+
+var logsCmd = &cobra.Command{
+	Use:   "logs <job_id>",
+	Short: "Show the recorded output of a job's attempts",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		jobID := args[0]
+		attemptNum, _ := cmd.Flags().GetInt("attempt")
+
+		if _, err := db.GetJob(jobID); err != nil {
+			return jobError("get", jobID, err)
+		}
+		attempts, err := db.ListAttempts(jobID)
+		if err != nil {
+			return fmt.Errorf("failed to get attempts for job %s: %w", jobID, err)
+		}
+
+		var selected []*store.Attempt
+		for _, a := range attempts {
+			if attemptNum == 0 || a.Attempt == attemptNum {
+				selected = append(selected, a)
+			}
+		}
+
+		if len(selected) == 0 {
+			if attemptNum != 0 {
+				return fmt.Errorf("no attempt %d recorded for job %s", attemptNum, jobID)
+			}
+			fmt.Printf("No attempts recorded for job %s.\n", jobID)
+			return nil
+		}
+
+		for i, a := range selected {
+			if i > 0 {
+				fmt.Println()
+			}
+			printAttempt(a)
+		}
+		return nil
+	},
+}
+
+func printAttempt(a *store.Attempt) {
+	if a.Rerun > 0 {
+		fmt.Printf("=== Attempt %d of rerun %d (worker %s)\n", a.Attempt, a.Rerun, a.Worker)
+	} else {
+		fmt.Printf("=== Attempt %d (worker %s)\n", a.Attempt, a.Worker)
+	}
+	fmt.Printf("Started:   %s\n", a.StartedAt.Format("2006-01-02 15:04:05"))
+	fmt.Printf("Finished:  %s (%v)\n", a.FinishedAt.Format("2006-01-02 15:04:05"), a.FinishedAt.Sub(a.StartedAt))
+	fmt.Printf("Exit code: %d\n", a.ExitCode)
+	if a.Signal != "" {
+		fmt.Printf("Signal:    %s\n", a.Signal)
+	}
+	if a.Error != "" {
+		fmt.Printf("Error:     %s\n", a.Error)
+	}
+	if a.Reason != "" {
+		fmt.Printf("Reason:    %s\n", a.Reason)
+	}
+	if a.Classification != "" {
+		fmt.Printf("Decision:  %s\n", a.Classification)
+	}
+	fmt.Println("--- stdout")
+	printOutput(a.Stdout)
+	fmt.Println("--- stderr")
+	printOutput(a.Stderr)
+}
+
+func printOutput(output string) {
+	if output == "" {
+		fmt.Println("(empty)")
+		return
+	}
+	fmt.Print(output)
+	if output[len(output)-1] != '\n' {
+		fmt.Println()
+	}
+}
+
+func init() {
+	logsCmd.Flags().Int("attempt", 0, "Only show this attempt number, in every rerun (default: all attempts)")
+}
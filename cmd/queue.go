@@ -0,0 +1,115 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/Trishvan/queuectl/internal/store"
+	"github.com/olekukonko/tablewriter"
+	"github.com/spf13/cobra"
+)
+
+var queueCmd = &cobra.Command{
+	Use:   "queue",
+	Short: "Manage queue rate limits",
+}
+
+var queueSetRateCmd = &cobra.Command{
+	Use:   "set-rate <name> <rate>",
+	Short: "Limit how often jobs in a queue start, e.g. 100/m",
+	Long: `Limit how often jobs in a queue start, across every worker and manager sharing the database.
+
+The rate is a number of jobs per second (s), minute (m), hour (h) or duration, as in 100/m or
+5/30s. It is a token bucket: up to --burst jobs (by default one interval's worth) can start at
+once after a quiet spell, then they start at the rate.
+
+name is a queue, or the rate_key of jobs that share a limit across queues. A job with a
+rate_key counts against that limit only, not its queue's. Setting a limit again replaces it
+and refills its bucket.`,
+	Args: cobra.ExactArgs(2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		name := args[0]
+		rate, per, err := store.ParseRate(args[1])
+		if err != nil {
+			return err
+		}
+		burst, _ := cmd.Flags().GetInt("burst")
+		if burst < 0 {
+			return fmt.Errorf("invalid --burst: %d is negative", burst)
+		}
+
+		limit := &store.RateLimit{Name: name, Rate: rate, Per: per, Burst: burst}
+		if err := db.SetRateLimit(limit); err != nil {
+			return fmt.Errorf("failed to set the rate limit of %s: %w", name, err)
+		}
+		fmt.Printf("Jobs in %s are limited to %s, bursts of up to %d.\n", name, store.FormatRate(limit.Rate, limit.Per), limit.Burst)
+		return nil
+	},
+}
+
+var queueRemoveRateCmd = &cobra.Command{
+	Use:   "remove-rate <name>",
+	Short: "Remove the rate limit of a queue",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if err := db.RemoveRateLimit(args[0]); err != nil {
+			return fmt.Errorf("failed to remove the rate limit of %s: %w", args[0], err)
+		}
+		fmt.Printf("Rate limit of %s removed.\n", args[0])
+		return nil
+	},
+}
+
+// printRateLimits prints the rate limits and whether they are holding ready jobs back, or
+// just the one named queue if it is not empty.
+func printRateLimits(queue string) error {
+	limits, err := db.ListRateLimits()
+	if err != nil {
+		return fmt.Errorf("failed to list rate limits: %w", err)
+	}
+	now := time.Now().UTC()
+	table := tablewriter.NewWriter(os.Stdout)
+	table.SetHeader([]string{"Name", "Rate", "Burst", "Tokens", "Ready", "Status"})
+	rows := 0
+	for _, limit := range limits {
+		if queue != "" && limit.Name != queue {
+			continue
+		}
+		tokens := limit.Available(now)
+		status := "ok"
+		if limit.Ready > 0 && tokens < 1 {
+			status = fmt.Sprintf("throttled, next job in %s", roundWait(limit.NextToken(now)))
+		}
+		table.Append([]string{
+			limit.Name,
+			store.FormatRate(limit.Rate, limit.Per),
+			strconv.Itoa(limit.Burst),
+			strconv.Itoa(int(tokens)),
+			strconv.Itoa(limit.Ready),
+			status,
+		})
+		rows++
+	}
+	if rows == 0 {
+		return nil
+	}
+	fmt.Println("\nRate Limits:")
+	table.Render()
+	return nil
+}
+
+// roundWait rounds a wait for display: to milliseconds under a second, else to seconds.
+func roundWait(d time.Duration) time.Duration {
+	if d < time.Second {
+		return d.Round(time.Millisecond)
+	}
+	return d.Round(time.Second)
+}
+
+func init() {
+	queueSetRateCmd.Flags().Int("burst", 0, "Most jobs that can start at once (default: the rate's number of jobs)")
+	queueCmd.AddCommand(queueSetRateCmd)
+	queueCmd.AddCommand(queueRemoveRateCmd)
+}
@@ -10,8 +10,8 @@ import (
 )
 
 var (
-	cfg   *config.Config
-	db    store.Store
+	cfg     *config.Config
+	db      store.Store
 	rootCmd = &cobra.Command{
 		Use:   "queuectl",
 		Short: "A CLI-based background job queue system",
@@ -23,12 +23,21 @@ var (
 				return fmt.Errorf("failed to load config: %w", err)
 			}
 
-			// Don't open DB for config command
-			if cmd.Parent() != nil && cmd.Parent().Name() == "config" || cmd.Name() == "config" {
+			// Don't open DB for config command, or for bench, which uses its own
+			if cmd.Parent() != nil && cmd.Parent().Name() == "config" || cmd.Name() == "config" || cmd.Name() == "bench" {
 				return nil
 			}
 
-			db, err = store.NewSQLiteStore(cfg.DatabasePath)
+			dsn := cfg.DatabaseDSN()
+			if flag, _ := cmd.Flags().GetString("db"); flag != "" {
+				dsn = flag
+			}
+			// The db commands look at the schema before anything migrates it.
+			if cmd.Parent() != nil && cmd.Parent().Name() == "db" {
+				db, err = store.OpenForMigration(dsn)
+			} else {
+				db, err = store.Open(dsn)
+			}
 			if err != nil {
 				return fmt.Errorf("failed to initialize database: %w", err)
 			}
@@ -51,10 +60,21 @@ func Execute() {
 }
 
 func init() {
+	rootCmd.PersistentFlags().String("db", "", "Database to use instead of the configured one: a postgres:// URL or a SQLite file path")
 	rootCmd.AddCommand(enqueueCmd)
 	rootCmd.AddCommand(workerCmd)
 	rootCmd.AddCommand(statusCmd)
 	rootCmd.AddCommand(listCmd)
 	rootCmd.AddCommand(dlqCmd)
 	rootCmd.AddCommand(configCmd)
+	rootCmd.AddCommand(jobCmd)
+	rootCmd.AddCommand(logsCmd)
+	rootCmd.AddCommand(scheduleCmd)
+	rootCmd.AddCommand(cancelCmd)
+	rootCmd.AddCommand(serveCmd)
+	rootCmd.AddCommand(benchCmd)
+	rootCmd.AddCommand(dbCmd)
+	rootCmd.AddCommand(workflowCmd)
+	rootCmd.AddCommand(concurrencyCmd)
+	rootCmd.AddCommand(queueCmd)
 }
@@ -0,0 +1,187 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/Trishvan/queuectl/internal/scheduler"
+	"github.com/Trishvan/queuectl/internal/store"
+	"github.com/olekukonko/tablewriter"
+	"github.com/spf13/cobra"
+)
+
+var scheduleCmd = &cobra.Command{
+	Use:   "schedule",
+	Short: "Manage recurring jobs",
+}
+
+var scheduleAddCmd = &cobra.Command{
+	Use:   "add <name> <cron_expr> <json_spec>",
+	Short: "Enqueue a job from a template on a cron schedule",
+	Long: `Enqueue a job from a template on a cron schedule.
+
+The cron expression has 5 fields (minute hour day-of-month month day-of-week), or 6 with a
+leading seconds field. Descriptors such as @hourly and @every 5m are also accepted.
+Schedules are fired by running worker managers.`,
+	Args: cobra.ExactArgs(3),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		name, expr, template := args[0], args[1], args[2]
+		timezone, _ := cmd.Flags().GetString("tz")
+		misfire, _ := cmd.Flags().GetString("misfire")
+
+		if _, _, err := scheduler.Parse(expr, timezone); err != nil {
+			return err
+		}
+		policy := store.MisfirePolicy(misfire)
+		if !scheduler.ValidMisfirePolicy(policy) {
+			return fmt.Errorf("invalid misfire policy: %s. valid policies are skip, once, all", misfire)
+		}
+		if err := validateTemplate(template); err != nil {
+			return err
+		}
+
+		now := time.Now().UTC()
+		sched := &store.Schedule{
+			Name:          name,
+			CronExpr:      expr,
+			Timezone:      timezone,
+			Template:      template,
+			MisfirePolicy: policy,
+			CreatedAt:     now,
+		}
+		next, err := scheduler.Next(sched, now)
+		if err != nil {
+			return err
+		}
+		sched.NextRunAt = next
+
+		if err := db.AddSchedule(sched); err != nil {
+			return fmt.Errorf("failed to add schedule %s: %w", name, err)
+		}
+
+		fmt.Printf("Schedule %s added. Next run at %s.\n", name, next.Format(time.RFC3339))
+		return nil
+	},
+}
+
+// validateTemplate checks that a schedule's job template is a valid job spec. Templates
+// may not set an ID, since every tick enqueues a new job.
+func validateTemplate(template string) error {
+	var fields map[string]interface{}
+	if err := json.Unmarshal([]byte(template), &fields); err != nil {
+		return fmt.Errorf("invalid job spec: %w", err)
+	}
+	if _, ok := fields["id"]; ok {
+		return fmt.Errorf("invalid job spec: a schedule template cannot set an id")
+	}
+	if _, err := store.NewJobFromSpec(template, cfg.MaxRetries); err != nil {
+		return fmt.Errorf("invalid job spec: %w", err)
+	}
+	return nil
+}
+
+var scheduleListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List recurring jobs",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		schedules, err := db.ListSchedules()
+		if err != nil {
+			return fmt.Errorf("failed to list schedules: %w", err)
+		}
+
+		if len(schedules) == 0 {
+			fmt.Println("No schedules defined.")
+			return nil
+		}
+
+		table := tablewriter.NewWriter(os.Stdout)
+		table.SetHeader([]string{"Name", "Cron", "Timezone", "Misfire", "Paused", "Next Run At", "Last Run At", "Template"})
+		for _, sched := range schedules {
+			lastRun := "-"
+			if !sched.LastRunAt.IsZero() {
+				lastRun = sched.LastRunAt.Format("2006-01-02 15:04:05")
+			}
+			table.Append([]string{
+				sched.Name,
+				sched.CronExpr,
+				sched.Timezone,
+				string(sched.MisfirePolicy),
+				fmt.Sprintf("%t", sched.Paused),
+				sched.NextRunAt.Format("2006-01-02 15:04:05"),
+				lastRun,
+				sched.Template,
+			})
+		}
+		table.Render()
+		return nil
+	},
+}
+
+var scheduleRemoveCmd = &cobra.Command{
+	Use:   "remove <name>",
+	Short: "Delete a recurring job",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if err := db.RemoveSchedule(args[0]); err != nil {
+			return fmt.Errorf("failed to remove schedule %s: %w", args[0], err)
+		}
+		fmt.Printf("Schedule %s removed.\n", args[0])
+		return nil
+	},
+}
+
+var schedulePauseCmd = &cobra.Command{
+	Use:   "pause <name>",
+	Short: "Stop a recurring job from enqueuing until it is resumed",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		sched, err := db.GetSchedule(args[0])
+		if err != nil {
+			return fmt.Errorf("failed to get schedule %s: %w", args[0], err)
+		}
+
+		sched.Paused = true
+		if err := db.UpdateSchedule(sched); err != nil {
+			return fmt.Errorf("failed to pause schedule %s: %w", args[0], err)
+		}
+		fmt.Printf("Schedule %s paused.\n", args[0])
+		return nil
+	},
+}
+
+var scheduleResumeCmd = &cobra.Command{
+	Use:   "resume <name>",
+	Short: "Resume a paused recurring job",
+	Long:  `Resume a paused recurring job. Ticks that passed while it was paused are not run.`,
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		sched, err := db.GetSchedule(args[0])
+		if err != nil {
+			return fmt.Errorf("failed to get schedule %s: %w", args[0], err)
+		}
+
+		next, err := scheduler.Next(sched, time.Now().UTC())
+		if err != nil {
+			return err
+		}
+		sched.Paused = false
+		sched.NextRunAt = next
+		if err := db.UpdateSchedule(sched); err != nil {
+			return fmt.Errorf("failed to resume schedule %s: %w", args[0], err)
+		}
+		fmt.Printf("Schedule %s resumed. Next run at %s.\n", args[0], next.Format(time.RFC3339))
+		return nil
+	},
+}
+
+func init() {
+	scheduleAddCmd.Flags().String("tz", "UTC", "Timezone the cron expression is evaluated in, e.g. Europe/Berlin")
+	scheduleAddCmd.Flags().String("misfire", string(store.MisfireSkip), "What to do with ticks missed while no manager ran: skip, once, or all")
+	scheduleCmd.AddCommand(scheduleAddCmd)
+	scheduleCmd.AddCommand(scheduleListCmd)
+	scheduleCmd.AddCommand(scheduleRemoveCmd)
+	scheduleCmd.AddCommand(schedulePauseCmd)
+	scheduleCmd.AddCommand(scheduleResumeCmd)
+}
@@ -0,0 +1,55 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/Trishvan/queuectl/internal/api"
+	"github.com/Trishvan/queuectl/internal/worker"
+	"github.com/spf13/cobra"
+)
+
+var serveCmd = &cobra.Command{
+	Use:   "serve",
+	Short: "Serve the job queue over a JSON HTTP API",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		listen, _ := cmd.Flags().GetString("listen")
+
+		server := api.NewServer(db, cfg)
+		server.Notify = worker.NotifyManagers
+		srv := &http.Server{
+			Addr:              listen,
+			Handler:           server.Handler(),
+			ReadHeaderTimeout: 10 * time.Second,
+		}
+
+		errChan := make(chan error, 1)
+		go func() {
+			log.Printf("Serving API on %s", listen)
+			errChan <- srv.ListenAndServe()
+		}()
+
+		sigChan := make(chan os.Signal, 1)
+		signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
+		select {
+		case err := <-errChan:
+			return fmt.Errorf("API server failed: %w", err)
+		case <-sigChan:
+		}
+
+		log.Println("Shutdown signal received, stopping API server...")
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		return srv.Shutdown(ctx)
+	},
+}
+
+func init() {
+	serveCmd.Flags().String("listen", ":8080", "Address to listen on")
+}
@@ -14,16 +14,21 @@ var statusCmd = &cobra.Command{
 	Use:   "status",
 	Short: "Show summary of all job states & active workers",
 	RunE: func(cmd *cobra.Command, args []string) error {
-		summary, err := db.GetStatusSummary()
+		queue, _ := cmd.Flags().GetString("queue")
+		summary, err := db.GetStatusSummary(queue)
 		if err != nil {
 			return fmt.Errorf("failed to get status summary: %w", err)
 		}
 
-		fmt.Println("Job Status Summary:")
+		if queue != "" {
+			fmt.Printf("Job Status Summary (queue %s):\n", queue)
+		} else {
+			fmt.Println("Job Status Summary:")
+		}
 		table := tablewriter.NewWriter(os.Stdout)
 		table.SetHeader([]string{"State", "Count"})
 
-		states := []store.JobState{store.StatePending, store.StateProcessing, store.StateCompleted, store.StateFailed, store.StateDead}
+		states := []store.JobState{store.StatePending, store.StateScheduled, store.StateBlocked, store.StateProcessing, store.StateCompleted, store.StateFailed, store.StateDead, store.StateCancelled}
 		for _, state := range states {
 			count := 0
 			if val, ok := summary[state]; ok {
@@ -33,13 +38,31 @@ var statusCmd = &cobra.Command{
 		}
 		table.Render()
 
+		if err := printRateLimits(queue); err != nil {
+			return err
+		}
+
 		fmt.Println("\nWorker Status:")
-		if worker.GetActiveWorkerCount() > 0 {
-			fmt.Println("Workers are running.")
-		} else {
+		workers, err := worker.ListLiveWorkers(db, cfg)
+		if err != nil {
+			return fmt.Errorf("failed to list workers: %w", err)
+		}
+		if len(workers) == 0 {
 			fmt.Println("Workers are not running.")
+		} else {
+			busy := 0
+			for _, w := range workers {
+				if w.CurrentJob != "" {
+					busy++
+				}
+			}
+			fmt.Printf("%d workers running, %d busy. See 'queuectl workers list' for details.\n", len(workers), busy)
 		}
 
 		return nil
 	},
 }
+
+func init() {
+	statusCmd.Flags().String("queue", "", "Only summarize jobs in this queue")
+}
@@ -2,39 +2,258 @@ package cmd
 
 import (
 	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/Trishvan/queuectl/internal/worker"
+	"github.com/olekukonko/tablewriter"
 	"github.com/spf13/cobra"
 )
 
 var workerCmd = &cobra.Command{
-	Use:   "worker",
-	Short: "Manage worker processes",
+	Use:     "worker",
+	Aliases: []string{"workers"},
+	Short:   "Manage worker processes",
 }
 
 var workerStartCmd = &cobra.Command{
 	Use:   "start",
 	Short: "Start one or more workers",
-	Run: func(cmd *cobra.Command, args []string) {
+	RunE: func(cmd *cobra.Command, args []string) error {
 		count, _ := cmd.Flags().GetInt("count")
-		manager := worker.NewManager(count, db, cfg)
+		queues, _ := cmd.Flags().GetString("queues")
+		metricsListen, _ := cmd.Flags().GetString("metrics-listen")
+		name, _ := cmd.Flags().GetString("name")
+		if err := worker.ValidateManagerName(name); err != nil {
+			return err
+		}
+
+		pools := []worker.Pool{{Count: count}}
+		if queues != "" {
+			if cmd.Flags().Changed("count") {
+				return fmt.Errorf("--count and --queues cannot be used together")
+			}
+			var err error
+			pools, err = worker.ParsePools(queues)
+			if err != nil {
+				return fmt.Errorf("invalid --queues: %w", err)
+			}
+		}
+
+		manager := worker.NewManager(name, pools, db, cfg)
+		manager.MetricsAddr = metricsListen
 		manager.Start()
+		return nil
 	},
 }
 
 var workerStopCmd = &cobra.Command{
 	Use:   "stop",
 	Short: "Stop running workers gracefully",
+	Long: `Stop a worker manager running on this host. Its workers finish their current jobs before exiting.
+
+Without flags the manager named "default" is stopped.`,
 	RunE: func(cmd *cobra.Command, args []string) error {
-		if err := worker.StopWorkers(); err != nil {
+		name, _ := cmd.Flags().GetString("name")
+		all, _ := cmd.Flags().GetBool("all")
+
+		if all {
+			if cmd.Flags().Changed("name") {
+				return fmt.Errorf("--name and --all cannot be used together")
+			}
+			if err := worker.StopAllManagers(); err != nil {
+				return fmt.Errorf("failed to stop workers: %w", err)
+			}
+			return nil
+		}
+
+		if err := worker.ValidateManagerName(name); err != nil {
+			return err
+		}
+		if err := worker.StopManager(name); err != nil {
+			if names, listErr := worker.ListManagers(); listErr == nil && len(names) > 0 {
+				return fmt.Errorf("failed to stop workers: %w (running managers: %s)", err, strings.Join(names, ", "))
+			}
 			return fmt.Errorf("failed to stop workers: %w", err)
 		}
 		return nil
 	},
 }
 
+var workerListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List live workers and the jobs they are running",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		workers, err := worker.ListLiveWorkers(db, cfg)
+		if err != nil {
+			return fmt.Errorf("failed to list workers: %w", err)
+		}
+
+		if len(workers) == 0 {
+			fmt.Println("No workers are running.")
+			return nil
+		}
+
+		table := tablewriter.NewWriter(os.Stdout)
+		table.SetHeader([]string{"ID", "Host", "PID", "Queue", "Current Job", "Started At", "Last Seen"})
+		for _, w := range workers {
+			queue := w.Queue
+			if queue == "" {
+				queue = "*"
+			}
+			currentJob := w.CurrentJob
+			if currentJob == "" {
+				currentJob = "(idle)"
+			}
+			table.Append([]string{
+				w.ID,
+				w.Hostname,
+				fmt.Sprintf("%d", w.ManagerPID),
+				queue,
+				currentJob,
+				w.StartedAt.Format("2006-01-02 15:04:05"),
+				w.LastSeen.Format("2006-01-02 15:04:05"),
+			})
+		}
+		table.Render()
+		return nil
+	},
+}
+
+// sendControl sends a control command to the manager named by the command's --name flag.
+func sendControl(cmd *cobra.Command, req worker.ControlRequest) (*worker.ManagerInfo, error) {
+	name, _ := cmd.Flags().GetString("name")
+	if err := worker.ValidateManagerName(name); err != nil {
+		return nil, err
+	}
+	return worker.SendControl(name, req)
+}
+
+var workerScaleCmd = &cobra.Command{
+	Use:   "scale <count>",
+	Short: "Change the number of workers in a running manager",
+	Long: `Add or remove workers in a running manager without restarting it. Removed workers finish their
+current job first.
+
+A manager started with --queues has one pool per queue; use --queue to pick the pool to scale.
+Scaling a queue the manager does not serve yet adds a pool for it.`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		count, err := strconv.Atoi(args[0])
+		if err != nil || count < 0 {
+			return fmt.Errorf("invalid worker count: %s", args[0])
+		}
+		queue, _ := cmd.Flags().GetString("queue")
+
+		info, err := sendControl(cmd, worker.ControlRequest{Command: worker.ControlScale, Queue: queue, Count: count})
+		if err != nil {
+			return fmt.Errorf("failed to scale workers: %w", err)
+		}
+		printManagerInfo(info)
+		return nil
+	},
+}
+
+var workerPauseCmd = &cobra.Command{
+	Use:   "pause",
+	Short: "Stop a running manager's workers from claiming new jobs",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if _, err := sendControl(cmd, worker.ControlRequest{Command: worker.ControlPause}); err != nil {
+			return fmt.Errorf("failed to pause workers: %w", err)
+		}
+		fmt.Println("Workers paused. Running jobs will finish; no new jobs will be claimed.")
+		return nil
+	},
+}
+
+var workerResumeCmd = &cobra.Command{
+	Use:   "resume",
+	Short: "Let a paused manager's workers claim jobs again",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if _, err := sendControl(cmd, worker.ControlRequest{Command: worker.ControlResume}); err != nil {
+			return fmt.Errorf("failed to resume workers: %w", err)
+		}
+		fmt.Println("Workers resumed.")
+		return nil
+	},
+}
+
+var workerDrainCmd = &cobra.Command{
+	Use:   "drain",
+	Short: "Let a running manager finish its current jobs, then exit",
+	Long:  `Shut a running manager down gracefully and wait until all of its workers have exited.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		fmt.Println("Draining workers...")
+		if _, err := sendControl(cmd, worker.ControlRequest{Command: worker.ControlDrain}); err != nil {
+			return fmt.Errorf("failed to drain workers: %w", err)
+		}
+		fmt.Println("All workers have finished and the manager has exited.")
+		return nil
+	},
+}
+
+var workerInfoCmd = &cobra.Command{
+	Use:   "info",
+	Short: "Show what each worker of a running manager is doing",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		info, err := sendControl(cmd, worker.ControlRequest{Command: worker.ControlInfo})
+		if err != nil {
+			return fmt.Errorf("failed to get worker info: %w", err)
+		}
+		printManagerInfo(info)
+		return nil
+	},
+}
+
+func printManagerInfo(info *worker.ManagerInfo) {
+	state := "running"
+	if info.Paused {
+		state = "paused"
+	}
+	fmt.Printf("Manager %s (PID %d), up %s, %s\n", info.Name, info.PID, time.Since(info.StartedAt).Round(time.Second), state)
+
+	if len(info.Workers) == 0 {
+		fmt.Println("No workers.")
+		return
+	}
+	table := tablewriter.NewWriter(os.Stdout)
+	table.SetHeader([]string{"ID", "Queue", "Current Job", "Uptime", "Processed"})
+	for _, w := range info.Workers {
+		queue := w.Queue
+		if queue == "" {
+			queue = "*"
+		}
+		currentJob := w.CurrentJob
+		if currentJob == "" {
+			currentJob = "(idle)"
+		}
+		table.Append([]string{
+			strconv.Itoa(w.ID),
+			queue,
+			currentJob,
+			time.Since(w.StartedAt).Round(time.Second).String(),
+			strconv.Itoa(w.Processed),
+		})
+	}
+	table.Render()
+}
+
 func init() {
 	workerStartCmd.Flags().IntP("count", "c", 1, "Number of workers to start")
+	workerStartCmd.Flags().String("queues", "", "Per-queue worker pools, e.g. emails:4,reports:1 (default: all queues)")
+	workerStartCmd.Flags().String("name", worker.DefaultManagerName, "Name of this manager, unique on this host")
+	workerStartCmd.Flags().String("metrics-listen", "", "Serve Prometheus metrics at /metrics on this address, e.g. :9090")
+	workerStopCmd.Flags().String("name", worker.DefaultManagerName, "Name of the manager to stop")
+	workerStopCmd.Flags().Bool("all", false, "Stop every manager running on this host")
 	workerCmd.AddCommand(workerStartCmd)
 	workerCmd.AddCommand(workerStopCmd)
+	workerCmd.AddCommand(workerListCmd)
+
+	for _, c := range []*cobra.Command{workerScaleCmd, workerPauseCmd, workerResumeCmd, workerDrainCmd, workerInfoCmd} {
+		c.Flags().String("name", worker.DefaultManagerName, "Name of the manager to control")
+		workerCmd.AddCommand(c)
+	}
+	workerScaleCmd.Flags().String("queue", "", "Queue whose pool to scale")
 }
@@ -0,0 +1,164 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/Trishvan/queuectl/internal/store"
+	"github.com/Trishvan/queuectl/internal/worker"
+	"github.com/Trishvan/queuectl/internal/workflow"
+	"github.com/olekukonko/tablewriter"
+	"github.com/spf13/cobra"
+)
+
+var workflowCmd = &cobra.Command{
+	Use:   "workflow",
+	Short: "Run multi-step pipelines defined in workflow files",
+}
+
+var workflowRunCmd = &cobra.Command{
+	Use:   "run <file>",
+	Short: "Enqueue a run of a workflow file",
+	Long: `Enqueue a run of a workflow file, in YAML or JSON.
+
+Each step becomes a job: the step's fields are a job spec as accepted by enqueue, plus a
+name, and depends_on lists the names of the steps that must complete first. The file's env
+is shared by every step and its queue is used by steps that do not name one.`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		path := args[0]
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		file, err := workflow.Parse(data)
+		if err != nil {
+			return fmt.Errorf("invalid workflow %s: %w", path, err)
+		}
+		if file.Name == "" {
+			file.Name = strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+		}
+
+		wf, jobs, err := file.NewRun(cfg.MaxRetries)
+		if err != nil {
+			return fmt.Errorf("invalid workflow %s: %w", path, err)
+		}
+		if err := db.CreateWorkflow(wf, jobs); err != nil {
+			return fmt.Errorf("failed to start workflow %s: %w", file.Name, err)
+		}
+		worker.NotifyManagers(jobs...)
+
+		fmt.Printf("Started workflow %s with run ID: %s (%d steps)\n", wf.Name, wf.ID, len(wf.Steps))
+		return nil
+	},
+}
+
+var workflowStatusCmd = &cobra.Command{
+	Use:   "status <run_id>",
+	Short: "Show the progress of a workflow run's steps",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		runID := args[0]
+		wf, err := db.GetWorkflow(runID)
+		if err != nil {
+			return fmt.Errorf("failed to get workflow %s: %w", runID, err)
+		}
+
+		states := make(map[store.JobState]int)
+		table := tablewriter.NewWriter(os.Stdout)
+		table.SetHeader([]string{"Step", "State", "Attempts", "Depends On", "Job ID"})
+		for _, step := range wf.Steps {
+			job, err := db.GetJob(step.JobID)
+			if err != nil {
+				return fmt.Errorf("failed to get job %s of step %s: %w", step.JobID, step.Name, err)
+			}
+			states[job.State]++
+			table.Append([]string{
+				step.Name,
+				string(job.State),
+				strconv.Itoa(job.Attempts),
+				strings.Join(step.DependsOn, ", "),
+				job.ID,
+			})
+		}
+
+		fmt.Printf("Workflow %s (run %s), started %s: %s, %d of %d steps completed\n",
+			wf.Name, wf.ID, wf.CreatedAt.Format("2006-01-02 15:04:05"), workflowState(states, len(wf.Steps)),
+			states[store.StateCompleted], len(wf.Steps))
+		table.Render()
+		return nil
+	},
+}
+
+// workflowState sums up a run from the number of its steps in each state.
+func workflowState(states map[store.JobState]int, steps int) string {
+	switch {
+	case states[store.StateCompleted] == steps:
+		return "completed"
+	case states[store.StatePending]+states[store.StateProcessing] > 0:
+		return "running"
+	case states[store.StateDead] > 0:
+		return "failed"
+	case states[store.StateCancelled] > 0:
+		return "cancelled"
+	}
+	return "blocked"
+}
+
+var workflowRetryCmd = &cobra.Command{
+	Use:   "retry <run_id> --from <step>",
+	Short: "Re-run a step of a workflow run and every step after it",
+	Long: `Re-run a step of a workflow run and every step that depends on it, directly or not.
+
+The steps' jobs go back to the queue with fresh attempts, whatever state they finished in.
+The steps the first one depends on must have completed, and none of the steps being re-run
+may still be queued or running.`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		runID := args[0]
+		from, _ := cmd.Flags().GetString("from")
+
+		wf, err := db.GetWorkflow(runID)
+		if err != nil {
+			return fmt.Errorf("failed to get workflow %s: %w", runID, err)
+		}
+		branch, err := workflow.Branch(wf, from)
+		if err != nil {
+			return err
+		}
+		for _, dep := range branch[0].DependsOn {
+			job, err := db.GetJob(workflow.JobID(wf.ID, dep))
+			if err != nil {
+				return fmt.Errorf("failed to get job of step %s: %w", dep, err)
+			}
+			if job.State != store.StateCompleted {
+				return fmt.Errorf("step %s depends on step %s, which is %s; retry from %s instead", from, dep, job.State, dep)
+			}
+		}
+
+		ids := make([]string, len(branch))
+		names := make([]string, len(branch))
+		for i, step := range branch {
+			ids[i] = step.JobID
+			names[i] = step.Name
+		}
+		if err := db.RerunJobs(ids); err != nil {
+			return fmt.Errorf("failed to retry workflow %s: %w", runID, err)
+		}
+		worker.NotifyManagers()
+
+		fmt.Printf("Re-running %d steps of workflow %s: %s\n", len(branch), runID, strings.Join(names, ", "))
+		return nil
+	},
+}
+
+func init() {
+	workflowCmd.AddCommand(workflowRunCmd)
+	workflowCmd.AddCommand(workflowStatusCmd)
+	workflowRetryCmd.Flags().String("from", "", "Step to re-run from (required)")
+	workflowRetryCmd.MarkFlagRequired("from")
+	workflowCmd.AddCommand(workflowRetryCmd)
+}
@@ -0,0 +1,288 @@
+package api
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/Trishvan/queuectl/internal/config"
+	"github.com/Trishvan/queuectl/internal/store"
+)
+
+// maxSpecBytes bounds the size of a job spec accepted by POST /jobs.
+const maxSpecBytes = 1 << 20
+
+// Server exposes store operations over a JSON HTTP API.
+type Server struct {
+	Store store.Store
+	Cfg   *config.Config
+	// Notify, if set, is called after jobs are enqueued or retried, to wake the workers. It
+	// is passed the jobs enqueued, if any, to be counted.
+	Notify func(enqueued ...*store.Job)
+}
+
+func NewServer(s store.Store, cfg *config.Config) *Server {
+	return &Server{
+		Store: s,
+		Cfg:   cfg,
+	}
+}
+
+// Handler returns the HTTP handler serving the API.
+func (s *Server) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/jobs", s.handleJobs)
+	mux.HandleFunc("/jobs/", s.handleJob)
+	mux.HandleFunc("/status", s.handleStatus)
+	mux.HandleFunc("/dlq", s.handleDLQ)
+	mux.HandleFunc("/dlq/", s.handleDLQJob)
+	return mux
+}
+
+func (s *Server) notify(enqueued ...*store.Job) {
+	if s.Notify != nil {
+		s.Notify(enqueued...)
+	}
+}
+
+// errorResponse is the body of every non-2xx response.
+type errorResponse struct {
+	Error string `json:"error"`
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Printf("API: Error writing response: %v", err)
+	}
+}
+
+func writeError(w http.ResponseWriter, status int, msg string) {
+	writeJSON(w, status, errorResponse{Error: msg})
+}
+
+// writeStoreError maps store errors to HTTP status codes.
+func writeStoreError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		writeError(w, http.StatusNotFound, "job not found")
+	case errors.Is(err, store.ErrJobNotPending), errors.Is(err, store.ErrJobNotCancellable), errors.Is(err, store.ErrJobExists):
+		writeError(w, http.StatusConflict, err.Error())
+	case errors.Is(err, store.ErrDependencyNotFound):
+		writeError(w, http.StatusBadRequest, err.Error())
+	default:
+		log.Printf("API: Store error: %v", err)
+		writeError(w, http.StatusInternalServerError, "internal error")
+	}
+}
+
+func allowMethod(w http.ResponseWriter, r *http.Request, method string) bool {
+	if r.Method == method {
+		return true
+	}
+	w.Header().Set("Allow", method)
+	writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+	return false
+}
+
+// splitPath returns the path segments after prefix, e.g. "/jobs/a/retry" -> ["a", "retry"].
+func splitPath(path, prefix string) []string {
+	rest := strings.Trim(strings.TrimPrefix(path, prefix), "/")
+	if rest == "" {
+		return nil
+	}
+	return strings.Split(rest, "/")
+}
+
+// handleJobs serves POST /jobs and GET /jobs?state=&queue=.
+func (s *Server) handleJobs(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodPost:
+		s.enqueue(w, r)
+	case http.MethodGet:
+		s.listJobs(w, r, store.JobState(r.URL.Query().Get("state")))
+	default:
+		w.Header().Set("Allow", "GET, POST")
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+	}
+}
+
+func (s *Server) enqueue(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxSpecBytes+1))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "failed to read request body")
+		return
+	}
+	if len(body) > maxSpecBytes {
+		writeError(w, http.StatusRequestEntityTooLarge, "job spec too large")
+		return
+	}
+
+	job, err := store.NewJobFromSpec(string(body), s.Cfg.MaxRetries)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid job spec: "+err.Error())
+		return
+	}
+	res, err := s.Store.Enqueue(job)
+	if err != nil {
+		writeStoreError(w, err)
+		return
+	}
+	if res.Duplicate {
+		// Nothing was enqueued: answer with the job the spec duplicates.
+		existing, err := s.Store.GetJob(res.JobID)
+		if err != nil {
+			writeStoreError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, existing)
+		return
+	}
+	s.notify(job)
+	writeJSON(w, http.StatusCreated, job)
+}
+
+func (s *Server) listJobs(w http.ResponseWriter, r *http.Request, state store.JobState) {
+	if state == "" {
+		state = store.StatePending
+	}
+	jobs, err := s.Store.ListJobsByState(state, r.URL.Query().Get("queue"))
+	if err != nil {
+		writeStoreError(w, err)
+		return
+	}
+	if jobs == nil {
+		jobs = []*store.Job{}
+	}
+	writeJSON(w, http.StatusOK, jobs)
+}
+
+// handleJob serves GET /jobs/{id}, GET /jobs/{id}/attempts, POST /jobs/{id}/retry
+// and POST /jobs/{id}/cancel.
+func (s *Server) handleJob(w http.ResponseWriter, r *http.Request) {
+	parts := splitPath(r.URL.Path, "/jobs/")
+	switch {
+	case len(parts) == 1:
+		if allowMethod(w, r, http.MethodGet) {
+			s.getJob(w, parts[0])
+		}
+	case len(parts) == 2 && parts[1] == "attempts":
+		if allowMethod(w, r, http.MethodGet) {
+			s.listAttempts(w, parts[0])
+		}
+	case len(parts) == 2 && parts[1] == "retry":
+		if allowMethod(w, r, http.MethodPost) {
+			s.retryJob(w, parts[0])
+		}
+	case len(parts) == 2 && parts[1] == "cancel":
+		if allowMethod(w, r, http.MethodPost) {
+			s.cancelJob(w, parts[0])
+		}
+	default:
+		writeError(w, http.StatusNotFound, "not found")
+	}
+}
+
+func (s *Server) getJob(w http.ResponseWriter, id string) {
+	job, err := s.Store.GetJob(id)
+	if err != nil {
+		writeStoreError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, job)
+}
+
+func (s *Server) listAttempts(w http.ResponseWriter, id string) {
+	if _, err := s.Store.GetJob(id); err != nil {
+		writeStoreError(w, err)
+		return
+	}
+	attempts, err := s.Store.ListAttempts(id)
+	if err != nil {
+		writeStoreError(w, err)
+		return
+	}
+	if attempts == nil {
+		attempts = []*store.Attempt{}
+	}
+	writeJSON(w, http.StatusOK, attempts)
+}
+
+// retryJob moves a job from the DLQ back to the pending queue.
+func (s *Server) retryJob(w http.ResponseWriter, id string) {
+	job, err := s.Store.GetJob(id)
+	if err != nil {
+		writeStoreError(w, err)
+		return
+	}
+	if job.State != store.StateDead {
+		writeError(w, http.StatusConflict, "job is not in the DLQ (current state: "+string(job.State)+")")
+		return
+	}
+
+	job.ResetForRetry()
+	if err := s.Store.UpdateJob(job, ""); err != nil {
+		writeStoreError(w, err)
+		return
+	}
+	s.notify()
+	writeJSON(w, http.StatusOK, job)
+}
+
+// cancelResponse reports the outcome of POST /jobs/{id}/cancel.
+type cancelResponse struct {
+	ID string `json:"id"`
+	// Cancelled is true if the job was cancelled immediately, and false if it is running
+	// and its worker has been asked to stop it.
+	Cancelled bool `json:"cancelled"`
+}
+
+func (s *Server) cancelJob(w http.ResponseWriter, id string) {
+	cancelled, err := s.Store.CancelJob(id)
+	if err != nil {
+		writeStoreError(w, err)
+		return
+	}
+	status := http.StatusOK
+	if !cancelled {
+		status = http.StatusAccepted
+	}
+	writeJSON(w, status, cancelResponse{ID: id, Cancelled: cancelled})
+}
+
+// handleStatus serves GET /status?queue=.
+func (s *Server) handleStatus(w http.ResponseWriter, r *http.Request) {
+	if !allowMethod(w, r, http.MethodGet) {
+		return
+	}
+	summary, err := s.Store.GetStatusSummary(r.URL.Query().Get("queue"))
+	if err != nil {
+		writeStoreError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, summary)
+}
+
+// handleDLQ serves GET /dlq?queue=.
+func (s *Server) handleDLQ(w http.ResponseWriter, r *http.Request) {
+	if allowMethod(w, r, http.MethodGet) {
+		s.listJobs(w, r, store.StateDead)
+	}
+}
+
+// handleDLQJob serves POST /dlq/{id}/retry.
+func (s *Server) handleDLQJob(w http.ResponseWriter, r *http.Request) {
+	parts := splitPath(r.URL.Path, "/dlq/")
+	if len(parts) != 2 || parts[1] != "retry" {
+		writeError(w, http.StatusNotFound, "not found")
+		return
+	}
+	if allowMethod(w, r, http.MethodPost) {
+		s.retryJob(w, parts[0])
+	}
+}
@@ -0,0 +1,251 @@
+// Package metrics implements the small subset of Prometheus instrumentation queuectl needs:
+// labelled counters, gauges and histograms, written in the text exposition format.
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// DefaultBuckets are histogram upper bounds in seconds, from 5ms to 1h.
+var DefaultBuckets = []float64{0.005, 0.01, 0.05, 0.1, 0.5, 1, 5, 10, 30, 60, 300, 900, 3600}
+
+// Registry holds a set of metrics and writes them out on demand.
+type Registry struct {
+	mu       sync.Mutex
+	families []*family
+	// beforeWrite hooks refresh metrics whose values are computed at scrape time.
+	beforeWrite []func()
+}
+
+func NewRegistry() *Registry {
+	return &Registry{}
+}
+
+// BeforeWrite registers fn to run before every write of the registry, so gauges that mirror
+// external state, such as the store, can be refreshed only when they are scraped.
+func (r *Registry) BeforeWrite(fn func()) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.beforeWrite = append(r.beforeWrite, fn)
+}
+
+// NewCounterVec registers a counter with the given label names.
+func (r *Registry) NewCounterVec(name, help string, labels ...string) *CounterVec {
+	return &CounterVec{r.register(name, help, "counter", labels, nil)}
+}
+
+// NewGaugeVec registers a gauge with the given label names.
+func (r *Registry) NewGaugeVec(name, help string, labels ...string) *GaugeVec {
+	return &GaugeVec{r.register(name, help, "gauge", labels, nil)}
+}
+
+// NewHistogramVec registers a histogram with the given upper bounds and label names.
+func (r *Registry) NewHistogramVec(name, help string, buckets []float64, labels ...string) *HistogramVec {
+	b := append([]float64(nil), buckets...)
+	sort.Float64s(b)
+	return &HistogramVec{r.register(name, help, "histogram", labels, b)}
+}
+
+func (r *Registry) register(name, help, typ string, labels []string, buckets []float64) *family {
+	f := &family{
+		name:    name,
+		help:    help,
+		typ:     typ,
+		labels:  labels,
+		buckets: buckets,
+		series:  make(map[string]*series),
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.families = append(r.families, f)
+	return f
+}
+
+// Write writes every metric in the Prometheus text exposition format.
+func (r *Registry) Write(w io.Writer) error {
+	r.mu.Lock()
+	hooks := append([]func(){}, r.beforeWrite...)
+	families := append([]*family{}, r.families...)
+	r.mu.Unlock()
+
+	for _, fn := range hooks {
+		fn()
+	}
+
+	bw := bufio.NewWriter(w)
+	for _, f := range families {
+		f.write(bw)
+	}
+	return bw.Flush()
+}
+
+// Handler serves the registry for Prometheus to scrape.
+func (r *Registry) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		if err := r.Write(w); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+	})
+}
+
+// CounterVec is a counter partitioned by label values.
+type CounterVec struct{ f *family }
+
+// Inc adds one to the counter for the given label values.
+func (c *CounterVec) Inc(labels ...string) {
+	c.Add(1, labels...)
+}
+
+// Add adds v to the counter for the given label values. A counter only goes up, so v
+// must not be negative; a value read from elsewhere belongs in a gauge.
+func (c *CounterVec) Add(v float64, labels ...string) {
+	c.f.update(labels, func(s *series) { s.value += v })
+}
+
+// GaugeVec is a gauge partitioned by label values.
+type GaugeVec struct{ f *family }
+
+func (g *GaugeVec) Set(v float64, labels ...string) {
+	g.f.update(labels, func(s *series) { s.value = v })
+}
+
+func (g *GaugeVec) Add(v float64, labels ...string) {
+	g.f.update(labels, func(s *series) { s.value += v })
+}
+
+// Reset drops every series, so label values that no longer exist stop being reported.
+func (g *GaugeVec) Reset() {
+	g.f.mu.Lock()
+	defer g.f.mu.Unlock()
+	g.f.series = make(map[string]*series)
+}
+
+// HistogramVec is a histogram partitioned by label values.
+type HistogramVec struct{ f *family }
+
+// Observe records v in the histogram for the given label values.
+func (h *HistogramVec) Observe(v float64, labels ...string) {
+	h.f.update(labels, func(s *series) {
+		if s.counts == nil {
+			s.counts = make([]uint64, len(h.f.buckets))
+		}
+		for i, bound := range h.f.buckets {
+			if v <= bound {
+				s.counts[i]++
+			}
+		}
+		s.count++
+		s.sum += v
+	})
+}
+
+type family struct {
+	name    string
+	help    string
+	typ     string
+	labels  []string
+	buckets []float64
+
+	mu     sync.Mutex
+	series map[string]*series
+}
+
+type series struct {
+	labels []string
+	value  float64
+	// Histograms only; counts are cumulative per bucket.
+	counts []uint64
+	count  uint64
+	sum    float64
+}
+
+func (f *family) update(labels []string, fn func(*series)) {
+	if len(labels) != len(f.labels) {
+		panic(fmt.Sprintf("metrics: %s takes %d label values, got %d", f.name, len(f.labels), len(labels)))
+	}
+	key := strings.Join(labels, "\xff")
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	s, ok := f.series[key]
+	if !ok {
+		s = &series{labels: append([]string(nil), labels...)}
+		f.series[key] = s
+	}
+	fn(s)
+}
+
+func (f *family) write(w *bufio.Writer) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	fmt.Fprintf(w, "# HELP %s %s\n", f.name, escapeHelp(f.help))
+	fmt.Fprintf(w, "# TYPE %s %s\n", f.name, f.typ)
+
+	keys := make([]string, 0, len(f.series))
+	for k := range f.series {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		s := f.series[k]
+		if f.typ != "histogram" {
+			fmt.Fprintf(w, "%s%s %s\n", f.name, f.labelString(s.labels, "", 0), formatFloat(s.value))
+			continue
+		}
+		for i, bound := range f.buckets {
+			var n uint64
+			if s.counts != nil {
+				n = s.counts[i]
+			}
+			fmt.Fprintf(w, "%s_bucket%s %d\n", f.name, f.labelString(s.labels, "le", bound), n)
+		}
+		fmt.Fprintf(w, "%s_bucket%s %d\n", f.name, f.labelString(s.labels, "le", math.Inf(1)), s.count)
+		fmt.Fprintf(w, "%s_sum%s %s\n", f.name, f.labelString(s.labels, "", 0), formatFloat(s.sum))
+		fmt.Fprintf(w, "%s_count%s %d\n", f.name, f.labelString(s.labels, "", 0), s.count)
+	}
+}
+
+// labelString formats the series' labels, plus an extra label (used for "le") if named.
+func (f *family) labelString(values []string, extra string, extraValue float64) string {
+	var pairs []string
+	for i, name := range f.labels {
+		pairs = append(pairs, name+`="`+escapeLabel(values[i])+`"`)
+	}
+	if extra != "" {
+		pairs = append(pairs, extra+`="`+formatFloat(extraValue)+`"`)
+	}
+	if len(pairs) == 0 {
+		return ""
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+func formatFloat(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+var (
+	helpEscaper  = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+	labelEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`)
+)
+
+func escapeHelp(s string) string  { return helpEscaper.Replace(s) }
+func escapeLabel(s string) string { return labelEscaper.Replace(s) }
@@ -0,0 +1,171 @@
+package scheduler
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/Trishvan/queuectl/internal/config"
+	"github.com/Trishvan/queuectl/internal/store"
+	"github.com/robfig/cron/v3"
+)
+
+const (
+	// misfireGrace is how late a tick may be fired and still count as on time. It leaves
+	// room for a few slow polls; anything later means no scheduler was running.
+	misfireGrace = 5 * time.Second
+	// maxCatchUp bounds the number of missed ticks replayed by MisfireCatchUp.
+	maxCatchUp = 1000
+)
+
+// parser accepts standard 5-field expressions and 6-field expressions with a leading seconds field.
+var parser = cron.NewParser(cron.SecondOptional | cron.Minute | cron.Hour | cron.Dom | cron.Month | cron.Dow | cron.Descriptor)
+
+// Parse validates a cron expression and timezone and returns the parsed schedule and location.
+func Parse(expr, timezone string) (cron.Schedule, *time.Location, error) {
+	spec, err := parser.Parse(expr)
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid cron expression %q: %w", expr, err)
+	}
+	loc, err := time.LoadLocation(timezone)
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid timezone %q: %w", timezone, err)
+	}
+	return spec, loc, nil
+}
+
+// Next returns the first tick of sched strictly after t, in UTC.
+func Next(sched *store.Schedule, t time.Time) (time.Time, error) {
+	spec, loc, err := Parse(sched.CronExpr, sched.Timezone)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return spec.Next(t.In(loc)).UTC(), nil
+}
+
+// ValidMisfirePolicy reports whether p is a known misfire policy.
+func ValidMisfirePolicy(p store.MisfirePolicy) bool {
+	switch p {
+	case store.MisfireSkip, store.MisfireRunOnce, store.MisfireCatchUp:
+		return true
+	}
+	return false
+}
+
+// Scheduler enqueues jobs for due schedules. Several schedulers may run against the
+// same database; each tick is fired by exactly one of them.
+type Scheduler struct {
+	Store    store.Store
+	Cfg      *config.Config
+	Interval time.Duration
+	// Enqueued, if set, is called with the jobs the scheduler enqueues after each batch.
+	Enqueued func(jobs []*store.Job)
+}
+
+func New(s store.Store, cfg *config.Config) *Scheduler {
+	return &Scheduler{
+		Store:    s,
+		Cfg:      cfg,
+		Interval: time.Second,
+	}
+}
+
+// Run fires due schedules until ctx is cancelled.
+func (s *Scheduler) Run(ctx context.Context) {
+	ticker := time.NewTicker(s.Interval)
+	defer ticker.Stop()
+	for {
+		s.fireDue(time.Now().UTC())
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (s *Scheduler) fireDue(now time.Time) {
+	due, err := s.Store.ListDueSchedules(now)
+	if err != nil {
+		log.Printf("Scheduler: Error listing due schedules: %v", err)
+		return
+	}
+	for _, sched := range due {
+		if err := s.fire(sched, now); err != nil {
+			log.Printf("Scheduler: Error firing schedule %s: %v", sched.Name, err)
+		}
+	}
+}
+
+func (s *Scheduler) fire(sched *store.Schedule, now time.Time) error {
+	spec, loc, err := Parse(sched.CronExpr, sched.Timezone)
+	if err != nil {
+		return err
+	}
+
+	ticks, due, next := plan(sched, spec, loc, now)
+
+	jobs := make([]*store.Job, 0, len(ticks))
+	for _, tick := range ticks {
+		job, err := store.NewJobFromSpec(sched.Template, s.Cfg.MaxRetries)
+		if err != nil {
+			return fmt.Errorf("invalid job template: %w", err)
+		}
+		// A deterministic ID ties each job to its tick.
+		job.ID = fmt.Sprintf("%s@%s", sched.Name, tick.UTC().Format("20060102T150405Z"))
+		jobs = append(jobs, job)
+	}
+
+	fired, err := s.Store.AdvanceSchedule(sched.Name, sched.NextRunAt, next, jobs)
+	if err != nil {
+		return err
+	}
+	if !fired {
+		// Another manager fired this tick first.
+		return nil
+	}
+	if len(jobs) > 0 && s.Enqueued != nil {
+		s.Enqueued(jobs)
+	}
+	if skipped := due - len(ticks); skipped > 0 {
+		log.Printf("Scheduler: Schedule %s enqueued %d jobs, skipped %d missed ticks (misfire policy %s)",
+			sched.Name, len(jobs), skipped, sched.MisfirePolicy)
+	} else if len(jobs) > 0 {
+		log.Printf("Scheduler: Schedule %s enqueued %d jobs", sched.Name, len(jobs))
+	}
+	return nil
+}
+
+// plan decides which due ticks of sched to fire according to its misfire policy. It returns
+// them, the number of ticks that were due, and the schedule's next tick after now.
+func plan(sched *store.Schedule, spec cron.Schedule, loc *time.Location, now time.Time) ([]time.Time, int, time.Time) {
+	var due []time.Time
+	t := sched.NextRunAt
+	for !t.After(now) && len(due) < maxCatchUp {
+		due = append(due, t)
+		t = spec.Next(t.In(loc)).UTC()
+	}
+	if !t.After(now) {
+		// Too many missed ticks to walk; jump straight to the next future one.
+		t = spec.Next(now.In(loc)).UTC()
+	}
+	if len(due) == 0 {
+		return nil, 0, t
+	}
+
+	switch sched.MisfirePolicy {
+	case store.MisfireCatchUp:
+		return due, len(due), t
+	case store.MisfireRunOnce:
+		return due[len(due)-1:], len(due), t
+	default:
+		var onTime []time.Time
+		for _, tick := range due {
+			if now.Sub(tick) <= misfireGrace {
+				onTime = append(onTime, tick)
+			}
+		}
+		return onTime, len(due), t
+	}
+}
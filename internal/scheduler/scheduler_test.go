@@ -0,0 +1,77 @@
+package scheduler
+
+import (
+	"testing"
+	"time"
+
+	"github.com/Trishvan/queuectl/internal/store"
+)
+
+func TestPlan(t *testing.T) {
+	start := time.Date(2025, 1, 1, 10, 0, 0, 0, time.UTC)
+	at := func(minutes int, seconds int) time.Time {
+		return start.Add(time.Duration(minutes)*time.Minute + time.Duration(seconds)*time.Second)
+	}
+
+	cases := []struct {
+		name   string
+		policy store.MisfirePolicy
+		now    time.Time
+		ticks  []time.Time
+		due    int
+		next   time.Time
+	}{
+		{"not due yet", store.MisfireSkip, at(-1, 0), nil, 0, at(0, 0)},
+		{"on time", store.MisfireSkip, at(0, 2), []time.Time{at(0, 0)}, 1, at(1, 0)},
+		{"skip drops missed ticks", store.MisfireSkip, at(3, 30), nil, 4, at(4, 0)},
+		{"skip keeps the tick within grace", store.MisfireSkip, at(3, 3), []time.Time{at(3, 0)}, 4, at(4, 0)},
+		{"skip is the default", "", at(3, 30), nil, 4, at(4, 0)},
+		{"once fires the last missed tick", store.MisfireRunOnce, at(3, 30), []time.Time{at(3, 0)}, 4, at(4, 0)},
+		{"all fires every missed tick", store.MisfireCatchUp, at(3, 30), []time.Time{at(0, 0), at(1, 0), at(2, 0), at(3, 0)}, 4, at(4, 0)},
+	}
+
+	spec, loc, err := Parse("* * * * *", "UTC")
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			sched := &store.Schedule{MisfirePolicy: c.policy, NextRunAt: start}
+			ticks, due, next := plan(sched, spec, loc, c.now)
+			if !equalTimes(ticks, c.ticks) || due != c.due || !next.Equal(c.next) {
+				t.Errorf("plan at %s = %v, %d due, next %s; want %v, %d due, next %s",
+					c.now.Format("15:04:05"), ticks, due, next.Format("15:04:05"), c.ticks, c.due, c.next.Format("15:04:05"))
+			}
+		})
+	}
+}
+
+func TestPlanCatchUpBound(t *testing.T) {
+	spec, loc, err := Parse("* * * * *", "UTC")
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	now := time.Date(2025, 1, 1, 10, 0, 30, 0, time.UTC)
+	sched := &store.Schedule{MisfirePolicy: store.MisfireCatchUp, NextRunAt: now.Add(-2 * maxCatchUp * time.Minute)}
+
+	ticks, due, next := plan(sched, spec, loc, now)
+	if len(ticks) != maxCatchUp || due != maxCatchUp {
+		t.Errorf("plan fired %d of %d due ticks, want %d", len(ticks), due, maxCatchUp)
+	}
+	// The ticks past the bound are skipped rather than left due.
+	if want := time.Date(2025, 1, 1, 10, 1, 0, 0, time.UTC); !next.Equal(want) {
+		t.Errorf("next tick is %s, want %s", next, want)
+	}
+}
+
+func equalTimes(a, b []time.Time) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if !a[i].Equal(b[i]) {
+			return false
+		}
+	}
+	return true
+}
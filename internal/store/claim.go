@@ -0,0 +1,107 @@
+package store
+
+import (
+	"sort"
+	"time"
+)
+
+// claimCandidate is a job that may be claimed, with what is needed to check its
+// concurrency key and rate limit.
+type claimCandidate struct {
+	id      string
+	key     string
+	limit   int
+	held    int    // Processing jobs with the same concurrency key
+	rateKey string // See jobRateKey
+}
+
+// admission picks the jobs of one claim of up to n jobs, in claim order, without taking a
+// concurrency key past its limit or starting more jobs than a rate limit has tokens for.
+// Each job is held to its own concurrency limit, so jobs sharing a key should agree on it.
+//
+// The SQL stores fetch candidates a page at a time and admit each page until the claim is
+// full, leaving out of every later page the jobs already admitted, the keys that are full
+// and the rate limits that are out of tokens. Every candidate passed over is therefore
+// left out of the pages after it, and the claim ends once a page comes back short.
+type admission struct {
+	n      int
+	limits map[string]*RateLimit // Tokens taken are removed from these
+	now    time.Time
+
+	ids   []string
+	used  []*RateLimit // The limits tokens were taken from, to be saved with the claims
+	taken map[string]int
+	full  map[string]bool
+}
+
+func newAdmission(n int, limits map[string]*RateLimit, now time.Time) *admission {
+	return &admission{
+		n:      n,
+		limits: limits,
+		now:    now,
+		taken:  make(map[string]int),
+		full:   make(map[string]bool),
+	}
+}
+
+// admit takes the candidates that fit in the claim, in order.
+func (a *admission) admit(candidates []claimCandidate) {
+	for _, c := range candidates {
+		if a.done() {
+			return
+		}
+		if c.key != "" && c.held+a.taken[c.key] >= c.limit {
+			a.full[c.key] = true
+			continue
+		}
+		if limit, ok := a.limits[c.rateKey]; ok {
+			if !limit.take(a.now) {
+				continue
+			}
+			if !a.isUsed(limit) {
+				a.used = append(a.used, limit)
+			}
+		}
+		if c.key != "" {
+			a.taken[c.key]++
+			if c.held+a.taken[c.key] >= c.limit {
+				a.full[c.key] = true
+			}
+		}
+		a.ids = append(a.ids, c.id)
+	}
+}
+
+func (a *admission) isUsed(limit *RateLimit) bool {
+	for _, used := range a.used {
+		if used == limit {
+			return true
+		}
+	}
+	return false
+}
+
+// done reports whether the claim is full.
+func (a *admission) done() bool {
+	return len(a.ids) == a.n
+}
+
+// remaining is the number of jobs the claim still has room for.
+func (a *admission) remaining() int {
+	return a.n - len(a.ids)
+}
+
+// fullKeys returns the concurrency keys found full so far, sorted.
+func (a *admission) fullKeys() []string {
+	keys := make([]string, 0, len(a.full))
+	for key := range a.full {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// throttled returns the names of the rate limits out of tokens, sorted.
+func (a *admission) throttled() []string {
+	return throttledNames(a.limits, a.now)
+}
@@ -0,0 +1,66 @@
+package store_test
+
+import (
+	"fmt"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/Trishvan/queuectl/internal/store"
+)
+
+// BenchmarkClaim measures claiming from SQLite one job at a time with FindAndLockJob and
+// in batches with ClaimJobs. The time reported is per job claimed.
+func BenchmarkClaim(b *testing.B) {
+	for _, batch := range []int{1, 8, 64} {
+		b.Run(fmt.Sprintf("batch=%d", batch), func(b *testing.B) {
+			s, err := store.NewSQLiteStore(filepath.Join(b.TempDir(), "jobs.db"))
+			if err != nil {
+				b.Fatalf("creating store: %v", err)
+			}
+			defer s.Close()
+
+			now := time.Now().UTC()
+			for i := 0; i < b.N; i++ {
+				job := &store.Job{
+					ID:         fmt.Sprintf("bench-%d", i),
+					Command:    "true",
+					State:      store.StatePending,
+					MaxRetries: 3,
+					CreatedAt:  now,
+					UpdatedAt:  now,
+					NextRunAt:  now,
+					Queue:      store.DefaultQueue,
+				}
+				if _, err := s.Enqueue(job); err != nil {
+					b.Fatalf("enqueueing %s: %v", job.ID, err)
+				}
+			}
+
+			opts := store.ClaimOptions{Owner: "bench", Lease: time.Minute}
+			b.ResetTimer()
+			for claimed := 0; claimed < b.N; {
+				var n int
+				if batch == 1 {
+					job, err := s.FindAndLockJob(opts)
+					if err != nil {
+						b.Fatalf("FindAndLockJob: %v", err)
+					}
+					if job != nil {
+						n = 1
+					}
+				} else {
+					jobs, err := s.ClaimJobs(opts, batch)
+					if err != nil {
+						b.Fatalf("ClaimJobs: %v", err)
+					}
+					n = len(jobs)
+				}
+				if n == 0 {
+					b.Fatalf("claimed %d of %d jobs, then found none", claimed, b.N)
+				}
+				claimed += n
+			}
+		})
+	}
+}
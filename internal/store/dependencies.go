@@ -0,0 +1,27 @@
+package store
+
+import (
+	"errors"
+)
+
+// ErrDependencyNotFound is returned when enqueueing a job that depends on a job that does
+// not exist.
+var ErrDependencyNotFound = errors.New("dependency not found")
+
+// stateAfterDependencies returns the state a job enqueued in state should start in, given
+// the states of the jobs it depends on.
+func stateAfterDependencies(state JobState, policy DependencyPolicy, deps []JobState) JobState {
+	for _, dep := range deps {
+		switch dep {
+		case StateCompleted:
+		case StateDead, StateCancelled:
+			if policy != DependencyWait {
+				return StateCancelled
+			}
+			state = StateBlocked
+		default:
+			state = StateBlocked
+		}
+	}
+	return state
+}
@@ -0,0 +1,18 @@
+package store
+
+import (
+	"time"
+)
+
+// duplicateStates returns the states in which an existing job with the same idempotency key
+// makes job a duplicate, or nil if any state does. since is the earliest creation time of
+// such a job, zero if there is none.
+func duplicateStates(job *Job, now time.Time) (states []JobState, since time.Time) {
+	switch job.IdempotencyScope {
+	case IdempotencyActive:
+		return []JobState{StatePending, StateBlocked, StateProcessing}, time.Time{}
+	case IdempotencyTTLScope:
+		return nil, now.Add(-job.IdempotencyTTL)
+	}
+	return []JobState{StatePending, StateBlocked}, time.Time{}
+}
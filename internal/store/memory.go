@@ -0,0 +1,897 @@
+package store
+
+import (
+	"database/sql"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+// MemoryStore keeps everything in process memory behind a single mutex. It is meant for
+// tests and short-lived tools: nothing outlives the process, and the queue cannot be shared
+// with another one. Jobs and schedules are copied in and out, so callers never share them
+// with the store.
+type MemoryStore struct {
+	mu        sync.Mutex
+	jobs      map[string]*memoryJob
+	seq       int // Insertion order of jobs, the tie-break SQLite's rowid gives
+	attempts  map[string][]*Attempt
+	schedules map[string]*Schedule
+	workflows map[string]*Workflow
+	workers   map[string]*WorkerRecord
+	limits    map[string]*RateLimit
+}
+
+var _ Store = (*MemoryStore)(nil)
+
+// memoryJob is a stored job with the state that is not part of Job.
+type memoryJob struct {
+	job             Job
+	seq             int
+	cancelRequested bool
+	dependsOn       []string // Sorted, and only returned by GetJob as in the SQL stores
+}
+
+func NewMemoryStore() *MemoryStore {
+	s := &MemoryStore{}
+	s.Init()
+	return s
+}
+
+func (s *MemoryStore) Init() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.jobs == nil {
+		s.jobs = make(map[string]*memoryJob)
+		s.attempts = make(map[string][]*Attempt)
+		s.schedules = make(map[string]*Schedule)
+		s.workflows = make(map[string]*Workflow)
+		s.workers = make(map[string]*WorkerRecord)
+		s.limits = make(map[string]*RateLimit)
+	}
+	return nil
+}
+
+func copyJob(job *Job) *Job {
+	c := *job
+	c.RetryOnExitCodes = append(ExitCodes(nil), job.RetryOnExitCodes...)
+	c.FailFastExitCodes = append(ExitCodes(nil), job.FailFastExitCodes...)
+	c.DependsOn = append([]string(nil), job.DependsOn...)
+	if job.Env != nil {
+		c.Env = make(Env, len(job.Env))
+		for k, v := range job.Env {
+			c.Env[k] = v
+		}
+	}
+	return &c
+}
+
+func (s *MemoryStore) Enqueue(job *Job) (EnqueueResult, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	duplicateOf, err := s.insertJob(job)
+	if err != nil || duplicateOf != "" {
+		return EnqueueResult{JobID: duplicateOf, Duplicate: duplicateOf != ""}, err
+	}
+	return EnqueueResult{JobID: job.ID}, nil
+}
+
+func (s *MemoryStore) insertJob(job *Job) (string, error) {
+	if job.Queue == "" {
+		job.Queue = DefaultQueue
+	}
+	if duplicateOf := s.findDuplicate(job); duplicateOf != "" {
+		return duplicateOf, nil
+	}
+	if _, ok := s.jobs[job.ID]; ok {
+		return "", fmt.Errorf("%w: %s", ErrJobExists, job.ID)
+	}
+	if len(job.DependsOn) > 0 {
+		var states []JobState
+		for _, dep := range job.DependsOn {
+			mj, ok := s.jobs[dep]
+			if !ok {
+				return "", fmt.Errorf("%w: %s", ErrDependencyNotFound, dep)
+			}
+			states = append(states, mj.job.State)
+		}
+		job.State = stateAfterDependencies(job.State, job.OnDependencyFailure, states)
+	}
+	s.seq++
+	stored := copyJob(job)
+	stored.LeaseOwner = ""
+	stored.LeaseExpiresAt = time.Time{}
+	stored.DependsOn = nil
+	dependsOn := append([]string(nil), job.DependsOn...)
+	sort.Strings(dependsOn)
+	s.jobs[job.ID] = &memoryJob{job: *stored, seq: s.seq, dependsOn: dependsOn}
+	return "", nil
+}
+
+// findDuplicate returns the ID of the oldest job that job duplicates under its idempotency
+// key and scope, or "" if there is none.
+func (s *MemoryStore) findDuplicate(job *Job) string {
+	if job.IdempotencyKey == "" {
+		return ""
+	}
+	states, since := duplicateStates(job, time.Now().UTC())
+	var oldest *memoryJob
+	for _, mj := range s.jobs {
+		if mj.job.IdempotencyKey != job.IdempotencyKey || mj.job.CreatedAt.Before(since) {
+			continue
+		}
+		if len(states) > 0 && !hasState(states, mj.job.State) {
+			continue
+		}
+		if oldest == nil || mj.job.CreatedAt.Before(oldest.job.CreatedAt) ||
+			mj.job.CreatedAt.Equal(oldest.job.CreatedAt) && mj.seq < oldest.seq {
+			oldest = mj
+		}
+	}
+	if oldest == nil {
+		return ""
+	}
+	return oldest.job.ID
+}
+
+func hasState(states []JobState, state JobState) bool {
+	for _, s := range states {
+		if s == state {
+			return true
+		}
+	}
+	return false
+}
+
+// dependents returns the jobs that depend on id.
+func (s *MemoryStore) dependents(id string) []*memoryJob {
+	var dependents []*memoryJob
+	for _, mj := range s.jobs {
+		for _, dep := range mj.dependsOn {
+			if dep == id {
+				dependents = append(dependents, mj)
+				break
+			}
+		}
+	}
+	return dependents
+}
+
+// settleDependents does what the SQL stores' settleDependents does.
+func (s *MemoryStore) settleDependents(id string, state JobState) {
+	now := time.Now().UTC()
+	switch state {
+	case StateCompleted:
+		for _, mj := range s.dependents(id) {
+			if mj.job.State != StateBlocked {
+				continue
+			}
+			ready := true
+			for _, dep := range mj.dependsOn {
+				if s.jobs[dep].job.State != StateCompleted {
+					ready = false
+					break
+				}
+			}
+			if ready {
+				mj.job.State = StatePending
+				mj.job.UpdatedAt = now
+			}
+		}
+	case StateDead, StateCancelled:
+		for _, mj := range s.dependents(id) {
+			if mj.job.State != StateBlocked || mj.job.OnDependencyFailure == DependencyWait {
+				continue
+			}
+			mj.job.State = StateCancelled
+			mj.job.UpdatedAt = now
+			s.settleDependents(mj.job.ID, StateCancelled)
+		}
+	}
+}
+
+func (s *MemoryStore) FindAndLockJob(opts ClaimOptions) (*Job, error) {
+	jobs, err := s.ClaimJobs(opts, 1)
+	if err != nil || len(jobs) == 0 {
+		return nil, err
+	}
+	return jobs[0], nil
+}
+
+func (s *MemoryStore) ClaimJobs(opts ClaimOptions, n int) ([]*Job, error) {
+	if n <= 0 {
+		return nil, nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now().UTC()
+	held := make(map[string]int)
+	var candidates []*memoryJob
+	for _, mj := range s.jobs {
+		if mj.job.State == StateProcessing && mj.job.ConcurrencyKey != "" {
+			held[mj.job.ConcurrencyKey]++
+		}
+		if mj.job.State != StatePending || mj.job.NextRunAt.After(now) {
+			continue
+		}
+		if opts.Queue != "" && mj.job.Queue != opts.Queue {
+			continue
+		}
+		candidates = append(candidates, mj)
+	}
+	sort.Slice(candidates, func(i, j int) bool {
+		a, b := &candidates[i].job, &candidates[j].job
+		pa, pb := effectivePriority(a, opts, now), effectivePriority(b, opts, now)
+		if pa != pb {
+			return pa > pb
+		}
+		if !a.CreatedAt.Equal(b.CreatedAt) {
+			return a.CreatedAt.Before(b.CreatedAt)
+		}
+		return candidates[i].seq < candidates[j].seq
+	})
+	keyed := make([]claimCandidate, len(candidates))
+	for i, mj := range candidates {
+		keyed[i] = claimCandidate{id: mj.job.ID, key: mj.job.ConcurrencyKey, limit: mj.job.ConcurrencyLimit,
+			held: held[mj.job.ConcurrencyKey], rateKey: jobRateKey(&mj.job)}
+	}
+	// Tokens are taken from the stored buckets directly.
+	adm := newAdmission(n, s.limits, now)
+	adm.admit(keyed)
+
+	jobs := make([]*Job, len(adm.ids))
+	for i, id := range adm.ids {
+		mj := s.jobs[id]
+		mj.job.State = StateProcessing
+		mj.job.UpdatedAt = now
+		mj.job.Attempts++
+		mj.job.LeaseOwner = opts.Owner
+		mj.job.LeaseExpiresAt = now.Add(opts.Lease)
+		jobs[i] = copyJob(&mj.job)
+	}
+	return jobs, nil
+}
+
+func (s *MemoryStore) RenewLease(id, owner string, lease time.Duration) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	mj, ok := s.jobs[id]
+	if !ok || mj.job.State != StateProcessing || mj.job.LeaseOwner != owner {
+		return false, ErrLeaseLost
+	}
+	now := time.Now().UTC()
+	mj.job.LeaseExpiresAt = now.Add(lease)
+	mj.job.UpdatedAt = now
+	return mj.cancelRequested, nil
+}
+
+func (s *MemoryStore) CancelJob(id string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	mj, ok := s.jobs[id]
+	if !ok {
+		return false, sql.ErrNoRows
+	}
+	now := time.Now().UTC()
+	switch mj.job.State {
+	case StatePending, StateBlocked:
+		mj.job.State = StateCancelled
+		mj.job.UpdatedAt = now
+		s.settleDependents(id, StateCancelled)
+		return true, nil
+	case StateProcessing:
+		mj.cancelRequested = true
+		mj.job.UpdatedAt = now
+		return false, nil
+	default:
+		return false, ErrJobNotCancellable
+	}
+}
+
+func (s *MemoryStore) ReclaimExpiredLeases(cutoff time.Time) (int, int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now().UTC()
+	requeued, dead := 0, 0
+	for _, mj := range s.jobs {
+		job := &mj.job
+		if job.State != StateProcessing || (!job.LeaseExpiresAt.IsZero() && job.LeaseExpiresAt.After(cutoff)) {
+			continue
+		}
+		switch {
+		case mj.cancelRequested:
+			// Jobs whose cancellation was requested are not retried.
+			job.State = StateCancelled
+		case job.Attempts >= job.MaxRetries:
+			job.State = StateDead
+			dead++
+		default:
+			job.State = StatePending
+			job.NextRunAt = now
+			requeued++
+		}
+		job.LeaseOwner = ""
+		job.LeaseExpiresAt = time.Time{}
+		job.UpdatedAt = now
+		s.settleDependents(job.ID, job.State)
+	}
+	return requeued, dead, nil
+}
+
+func (s *MemoryStore) UpdateJob(job *Job, lease string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.updateJob(job, lease)
+}
+
+// updateJob saves the fields of job that UpdateJob covers in the SQL stores.
+func (s *MemoryStore) updateJob(job *Job, lease string) error {
+	mj, ok := s.jobs[job.ID]
+	if lease != "" && (!ok || mj.job.State != StateProcessing || mj.job.LeaseOwner != lease) {
+		return ErrLeaseLost
+	}
+	if !ok {
+		return sql.ErrNoRows
+	}
+	job.UpdatedAt = time.Now().UTC()
+	if mj.cancelRequested && (job.State == StatePending || job.State == StateDead) {
+		job.State = StateCancelled
+	}
+	mj.cancelRequested = false
+	mj.job.State = job.State
+	mj.job.Attempts = job.Attempts
+	mj.job.Reruns = job.Reruns
+	mj.job.UpdatedAt = job.UpdatedAt
+	mj.job.NextRunAt = job.NextRunAt
+	mj.job.LeaseOwner = job.LeaseOwner
+	mj.job.LeaseExpiresAt = job.LeaseExpiresAt
+	s.settleDependents(job.ID, job.State)
+	return nil
+}
+
+func (s *MemoryStore) SetPriority(id string, priority int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	mj, ok := s.jobs[id]
+	if !ok {
+		return sql.ErrNoRows
+	}
+	if mj.job.State != StatePending {
+		return ErrJobNotPending
+	}
+	mj.job.Priority = priority
+	mj.job.UpdatedAt = time.Now().UTC()
+	return nil
+}
+
+func (s *MemoryStore) RecordAttempt(a *Attempt) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.checkAttempt(a); err != nil {
+		return err
+	}
+	s.recordAttempt(a)
+	return nil
+}
+
+// checkAttempt fails if a's attempt of its rerun is already recorded, as the primary key
+// of the SQL stores does.
+func (s *MemoryStore) checkAttempt(a *Attempt) error {
+	for _, recorded := range s.attempts[a.JobID] {
+		if recorded.Rerun == a.Rerun && recorded.Attempt == a.Attempt {
+			return fmt.Errorf("attempt %d of rerun %d of job %s is already recorded", a.Attempt, a.Rerun, a.JobID)
+		}
+	}
+	return nil
+}
+
+func (s *MemoryStore) recordAttempt(a *Attempt) {
+	c := *a
+	s.attempts[a.JobID] = append(s.attempts[a.JobID], &c)
+}
+
+func (s *MemoryStore) FinishJobs(results []*JobResult) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// Check every job first, so that a failed batch changes nothing.
+	for _, r := range results {
+		if _, ok := s.jobs[r.Job.ID]; !ok && r.Lease == "" {
+			return fmt.Errorf("updating job %s: %w", r.Job.ID, sql.ErrNoRows)
+		}
+		if r.Attempt != nil {
+			if err := s.checkAttempt(r.Attempt); err != nil {
+				return fmt.Errorf("recording attempt %d of job %s: %w", r.Attempt.Attempt, r.Job.ID, err)
+			}
+		}
+	}
+	for _, r := range results {
+		if r.Attempt != nil {
+			s.recordAttempt(r.Attempt)
+		}
+		s.updateJob(r.Job, r.Lease)
+	}
+	return nil
+}
+
+func (s *MemoryStore) ListAttempts(jobID string) ([]*Attempt, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var attempts []*Attempt
+	for _, a := range s.attempts[jobID] {
+		c := *a
+		attempts = append(attempts, &c)
+	}
+	sort.Slice(attempts, func(i, j int) bool {
+		if attempts[i].Rerun != attempts[j].Rerun {
+			return attempts[i].Rerun < attempts[j].Rerun
+		}
+		return attempts[i].Attempt < attempts[j].Attempt
+	})
+	return attempts, nil
+}
+
+func (s *MemoryStore) GetJob(id string) (*Job, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	mj, ok := s.jobs[id]
+	if !ok {
+		return nil, sql.ErrNoRows
+	}
+	job := copyJob(&mj.job)
+	job.DependsOn = append([]string(nil), mj.dependsOn...)
+	return job, nil
+}
+
+func (s *MemoryStore) JobDependencies(id string) ([]string, []string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var dependsOn, dependents []string
+	if mj, ok := s.jobs[id]; ok {
+		dependsOn = append(dependsOn, mj.dependsOn...)
+	}
+	for _, mj := range s.dependents(id) {
+		dependents = append(dependents, mj.job.ID)
+	}
+	sort.Strings(dependents)
+	return dependsOn, dependents, nil
+}
+
+// viewState is the state a job is reported under, with pending jobs that are not yet due
+// under StateScheduled.
+func viewState(job *Job, now time.Time) JobState {
+	if job.State == StatePending && job.NextRunAt.After(now) {
+		return StateScheduled
+	}
+	return job.State
+}
+
+func (s *MemoryStore) ListJobsByState(state JobState, queue string) ([]*Job, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now().UTC()
+	var matches []*memoryJob
+	for _, mj := range s.jobs {
+		if viewState(&mj.job, now) != state || (queue != "" && mj.job.Queue != queue) {
+			continue
+		}
+		matches = append(matches, mj)
+	}
+	sort.Slice(matches, func(i, j int) bool {
+		a, b := &matches[i].job, &matches[j].job
+		if state == StateScheduled && !a.NextRunAt.Equal(b.NextRunAt) {
+			return a.NextRunAt.Before(b.NextRunAt)
+		}
+		if !a.CreatedAt.Equal(b.CreatedAt) {
+			return a.CreatedAt.Before(b.CreatedAt)
+		}
+		return matches[i].seq < matches[j].seq
+	})
+
+	jobs := make([]*Job, len(matches))
+	for i, mj := range matches {
+		jobs[i] = copyJob(&mj.job)
+	}
+	return jobs, nil
+}
+
+func (s *MemoryStore) ListJobsByConcurrencyKey(key string) ([]*Job, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var matches []*memoryJob
+	for _, mj := range s.jobs {
+		if mj.job.ConcurrencyKey == key && (mj.job.State == StateProcessing || mj.job.State == StatePending) {
+			matches = append(matches, mj)
+		}
+	}
+	sort.Slice(matches, func(i, j int) bool {
+		a, b := &matches[i].job, &matches[j].job
+		if (a.State == StateProcessing) != (b.State == StateProcessing) {
+			return a.State == StateProcessing
+		}
+		if a.Priority != b.Priority {
+			return a.Priority > b.Priority
+		}
+		if !a.CreatedAt.Equal(b.CreatedAt) {
+			return a.CreatedAt.Before(b.CreatedAt)
+		}
+		return matches[i].seq < matches[j].seq
+	})
+
+	jobs := make([]*Job, len(matches))
+	for i, mj := range matches {
+		jobs[i] = copyJob(&mj.job)
+	}
+	return jobs, nil
+}
+
+func (s *MemoryStore) GetStatusSummary(queue string) (map[JobState]int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now().UTC()
+	summary := make(map[JobState]int)
+	for _, mj := range s.jobs {
+		if queue != "" && mj.job.Queue != queue {
+			continue
+		}
+		summary[viewState(&mj.job, now)]++
+	}
+	return summary, nil
+}
+
+func (s *MemoryStore) GetQueueStats() ([]*QueueStats, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now().UTC()
+	byQueue := make(map[string]*QueueStats)
+	for _, mj := range s.jobs {
+		job := &mj.job
+		qs, ok := byQueue[job.Queue]
+		if !ok {
+			qs = &QueueStats{Queue: job.Queue, Counts: make(map[JobState]int)}
+			byQueue[job.Queue] = qs
+		}
+		state := viewState(job, now)
+		qs.Counts[state]++
+		if state == StatePending && (qs.OldestPending.IsZero() || job.CreatedAt.Before(qs.OldestPending)) {
+			qs.OldestPending = job.CreatedAt.UTC()
+		}
+	}
+
+	stats := make([]*QueueStats, 0, len(byQueue))
+	for _, qs := range byQueue {
+		stats = append(stats, qs)
+	}
+	sort.Slice(stats, func(i, j int) bool { return stats[i].Queue < stats[j].Queue })
+	return stats, nil
+}
+
+func (s *MemoryStore) AddSchedule(sched *Schedule) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.schedules[sched.Name]; ok {
+		return fmt.Errorf("schedule %s already exists", sched.Name)
+	}
+	c := *sched
+	s.schedules[sched.Name] = &c
+	return nil
+}
+
+func (s *MemoryStore) GetSchedule(name string) (*Schedule, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	sched, ok := s.schedules[name]
+	if !ok {
+		return nil, ErrScheduleNotFound
+	}
+	c := *sched
+	return &c, nil
+}
+
+func (s *MemoryStore) ListSchedules() ([]*Schedule, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	schedules := s.listSchedules(func(*Schedule) bool { return true })
+	sort.Slice(schedules, func(i, j int) bool { return schedules[i].Name < schedules[j].Name })
+	return schedules, nil
+}
+
+func (s *MemoryStore) ListDueSchedules(now time.Time) ([]*Schedule, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	schedules := s.listSchedules(func(sched *Schedule) bool { return !sched.Paused && !sched.NextRunAt.After(now) })
+	sort.Slice(schedules, func(i, j int) bool { return schedules[i].NextRunAt.Before(schedules[j].NextRunAt) })
+	return schedules, nil
+}
+
+// listSchedules returns copies of the schedules matching keep, in no particular order.
+func (s *MemoryStore) listSchedules(keep func(*Schedule) bool) []*Schedule {
+	var schedules []*Schedule
+	for _, sched := range s.schedules {
+		if keep(sched) {
+			c := *sched
+			schedules = append(schedules, &c)
+		}
+	}
+	return schedules
+}
+
+func (s *MemoryStore) UpdateSchedule(sched *Schedule) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stored, ok := s.schedules[sched.Name]
+	if !ok {
+		return ErrScheduleNotFound
+	}
+	createdAt := stored.CreatedAt
+	*stored = *sched
+	stored.CreatedAt = createdAt
+	return nil
+}
+
+func (s *MemoryStore) RemoveSchedule(name string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.schedules[name]; !ok {
+		return ErrScheduleNotFound
+	}
+	delete(s.schedules, name)
+	return nil
+}
+
+func (s *MemoryStore) SetRateLimit(limit *RateLimit) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	resetRateLimit(limit, time.Now().UTC())
+	stored := *limit
+	stored.Ready = 0
+	s.limits[limit.Name] = &stored
+	return nil
+}
+
+func (s *MemoryStore) RemoveRateLimit(name string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.limits[name]; !ok {
+		return ErrRateLimitNotFound
+	}
+	delete(s.limits, name)
+	return nil
+}
+
+func (s *MemoryStore) ListRateLimits() ([]*RateLimit, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if len(s.limits) == 0 {
+		return nil, nil
+	}
+	limits := make(map[string]*RateLimit, len(s.limits))
+	for name, limit := range s.limits {
+		c := *limit
+		limits[name] = &c
+	}
+	now := time.Now().UTC()
+	for _, mj := range s.jobs {
+		if mj.job.State != StatePending || mj.job.NextRunAt.After(now) {
+			continue
+		}
+		if limit, ok := limits[jobRateKey(&mj.job)]; ok {
+			limit.Ready++
+		}
+	}
+	return sortedRateLimits(limits), nil
+}
+
+func (s *MemoryStore) AdvanceSchedule(name string, expected, next time.Time, jobs []*Job) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	sched, ok := s.schedules[name]
+	if !ok || sched.Paused || !sched.NextRunAt.Equal(expected) {
+		return false, nil
+	}
+	if err := s.checkNewJobs(jobs); err != nil {
+		return false, err
+	}
+
+	sched.NextRunAt = next.UTC()
+	sched.LastRunAt = time.Now().UTC()
+	// Jobs that duplicate an existing job by their idempotency key are skipped.
+	for _, job := range jobs {
+		s.insertJob(job)
+	}
+	return true, nil
+}
+
+// checkNewJobs returns the error insertJob would return for one of jobs, if any, so that
+// a batch can be checked before anything changes.
+func (s *MemoryStore) checkNewJobs(jobs []*Job) error {
+	ids := make(map[string]bool)
+	for _, job := range jobs {
+		if _, ok := s.jobs[job.ID]; ok || ids[job.ID] {
+			return fmt.Errorf("%w: %s", ErrJobExists, job.ID)
+		}
+		if duplicateOf := s.findDuplicate(job); duplicateOf != "" {
+			return fmt.Errorf("enqueueing job %s: its idempotency key matches job %s", job.ID, duplicateOf)
+		}
+		for _, dep := range job.DependsOn {
+			if _, ok := s.jobs[dep]; !ok && !ids[dep] {
+				return fmt.Errorf("%w: %s", ErrDependencyNotFound, dep)
+			}
+		}
+		ids[job.ID] = true
+	}
+	return nil
+}
+
+func copyWorkflow(wf *Workflow) *Workflow {
+	c := *wf
+	c.Steps = make([]WorkflowStep, len(wf.Steps))
+	for i, step := range wf.Steps {
+		c.Steps[i] = step
+		c.Steps[i].DependsOn = append([]string(nil), step.DependsOn...)
+	}
+	return &c
+}
+
+func (s *MemoryStore) CreateWorkflow(wf *Workflow, jobs []*Job) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.workflows[wf.ID]; ok {
+		return fmt.Errorf("workflow %s already exists", wf.ID)
+	}
+	if err := s.checkNewJobs(jobs); err != nil {
+		return err
+	}
+	s.workflows[wf.ID] = copyWorkflow(wf)
+	for _, job := range jobs {
+		s.insertJob(job)
+	}
+	return nil
+}
+
+func (s *MemoryStore) GetWorkflow(id string) (*Workflow, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	wf, ok := s.workflows[id]
+	if !ok {
+		return nil, ErrWorkflowNotFound
+	}
+	return copyWorkflow(wf), nil
+}
+
+func (s *MemoryStore) RerunJobs(ids []string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// Check the jobs first, so that a failed batch changes nothing.
+	for _, id := range ids {
+		mj, ok := s.jobs[id]
+		if !ok {
+			return sql.ErrNoRows
+		}
+		if mj.job.State == StatePending || mj.job.State == StateProcessing {
+			return fmt.Errorf("%w: %s", ErrJobActive, id)
+		}
+	}
+
+	now := time.Now().UTC()
+	for _, id := range ids {
+		mj := s.jobs[id]
+		var states []JobState
+		for _, dep := range mj.dependsOn {
+			states = append(states, s.jobs[dep].job.State)
+		}
+		mj.job.State = stateAfterDependencies(StatePending, mj.job.OnDependencyFailure, states)
+		mj.job.Attempts = 0
+		mj.job.Reruns++
+		mj.job.UpdatedAt = now
+		mj.job.NextRunAt = now
+		mj.job.LeaseOwner = ""
+		mj.job.LeaseExpiresAt = time.Time{}
+		mj.cancelRequested = false
+		s.settleDependents(id, mj.job.State)
+	}
+	return nil
+}
+
+func (s *MemoryStore) RegisterWorker(w *WorkerRecord) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	c := *w
+	s.workers[w.ID] = &c
+	return nil
+}
+
+func (s *MemoryStore) HeartbeatWorker(id, currentJob string, at time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	w, ok := s.workers[id]
+	if !ok {
+		return ErrWorkerNotRegistered
+	}
+	w.CurrentJob = currentJob
+	w.LastSeen = at.UTC()
+	return nil
+}
+
+func (s *MemoryStore) UnregisterWorker(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.workers, id)
+	return nil
+}
+
+func (s *MemoryStore) ListWorkers(since time.Time) ([]*WorkerRecord, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var workers []*WorkerRecord
+	for _, w := range s.workers {
+		if w.LastSeen.Before(since) {
+			continue
+		}
+		c := *w
+		workers = append(workers, &c)
+	}
+	sort.Slice(workers, func(i, j int) bool {
+		a, b := workers[i], workers[j]
+		switch {
+		case a.Hostname != b.Hostname:
+			return a.Hostname < b.Hostname
+		case a.ManagerPID != b.ManagerPID:
+			return a.ManagerPID < b.ManagerPID
+		case !a.StartedAt.Equal(b.StartedAt):
+			return a.StartedAt.Before(b.StartedAt)
+		}
+		return a.ID < b.ID
+	})
+	return workers, nil
+}
+
+func (s *MemoryStore) PruneWorkers(cutoff time.Time) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	n := 0
+	for id, w := range s.workers {
+		if w.LastSeen.Before(cutoff) {
+			delete(s.workers, id)
+			n++
+		}
+	}
+	return n, nil
+}
+
+// Close does nothing; the store stays usable until it is garbage collected.
+func (s *MemoryStore) Close() error {
+	return nil
+}
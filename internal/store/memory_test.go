@@ -0,0 +1,14 @@
+package store_test
+
+import (
+	"testing"
+
+	"github.com/Trishvan/queuectl/internal/store"
+	"github.com/Trishvan/queuectl/internal/store/storetest"
+)
+
+func TestMemoryStore(t *testing.T) {
+	storetest.Run(t, func() (store.Store, error) {
+		return store.NewMemoryStore(), nil
+	})
+}
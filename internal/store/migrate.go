@@ -0,0 +1,164 @@
+package store
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ErrSchemaTooNew is returned when a database was migrated by a newer version of queuectl
+// than the one running. Using it could lose or corrupt data this version does not know about.
+var ErrSchemaTooNew = errors.New("database schema is newer than this version of queuectl supports")
+
+// Migration is one step of a store's schema history. Versions start at 1 and every
+// migration runs in its own transaction, recorded in the schema_migrations table.
+type Migration struct {
+	Version int
+	Name    string
+	up      func(tx *sql.Tx) error
+}
+
+// execMigration returns a migration step that runs a fixed script.
+func execMigration(script string) func(tx *sql.Tx) error {
+	return func(tx *sql.Tx) error {
+		_, err := tx.Exec(script)
+		return err
+	}
+}
+
+// Migrator is implemented by stores whose schema is versioned. NewSQLiteStore and
+// NewPostgresStore migrate the database when they open it; OpenForMigration opens it
+// untouched, so the migrations can be inspected first.
+type Migrator interface {
+	// SchemaVersion returns the version of the database's schema, 0 if it has none yet, and
+	// the latest version this build knows.
+	SchemaVersion() (current, latest int, err error)
+	// PendingMigrations returns the migrations Migrate would apply, oldest first.
+	PendingMigrations() ([]Migration, error)
+	// Migrate applies the pending migrations and returns them.
+	Migrate() ([]Migration, error)
+}
+
+// migrator runs a list of migrations against a database. The bookkeeping queries differ
+// between SQL dialects and are supplied by each store.
+type migrator struct {
+	db         *sql.DB
+	migrations []Migration
+
+	createTable string // Creates schema_migrations if it does not exist
+	tableExists string // Returns whether schema_migrations exists
+	insert      string // Records a migration, given its version, name and time
+	// lock, if set, is run first in every migration transaction so that processes opening
+	// the database at the same time migrate it one after the other.
+	lock string
+}
+
+func (m *migrator) latest() int {
+	if len(m.migrations) == 0 {
+		return 0
+	}
+	return m.migrations[len(m.migrations)-1].Version
+}
+
+func (m *migrator) SchemaVersion() (int, int, error) {
+	current, err := m.currentVersion(m.db)
+	return current, m.latest(), err
+}
+
+// currentVersion reads the schema version without creating anything.
+func (m *migrator) currentVersion(q queryRower) (int, error) {
+	var exists bool
+	if err := q.QueryRow(m.tableExists).Scan(&exists); err != nil {
+		return 0, err
+	}
+	if !exists {
+		return 0, nil
+	}
+	var version sql.NullInt64
+	if err := q.QueryRow(`SELECT MAX(version) FROM schema_migrations`).Scan(&version); err != nil {
+		return 0, err
+	}
+	return int(version.Int64), nil
+}
+
+// checkVersion returns ErrSchemaTooNew if current is beyond the latest known migration.
+func (m *migrator) checkVersion(current int) error {
+	if current > m.latest() {
+		return fmt.Errorf("%w: the database is at version %d, this queuectl knows up to %d", ErrSchemaTooNew, current, m.latest())
+	}
+	return nil
+}
+
+func (m *migrator) PendingMigrations() ([]Migration, error) {
+	current, err := m.currentVersion(m.db)
+	if err != nil {
+		return nil, err
+	}
+	if err := m.checkVersion(current); err != nil {
+		return nil, err
+	}
+	var pending []Migration
+	for _, mig := range m.migrations {
+		if mig.Version > current {
+			pending = append(pending, mig)
+		}
+	}
+	return pending, nil
+}
+
+func (m *migrator) Migrate() ([]Migration, error) {
+	var applied []Migration
+	for {
+		mig, err := m.applyNext()
+		if err != nil {
+			return applied, err
+		}
+		if mig == nil {
+			return applied, nil
+		}
+		applied = append(applied, *mig)
+	}
+}
+
+// applyNext applies the first migration the database has not had yet, if any. The version
+// is read inside the migration's transaction, so a migration another process has just
+// applied is never applied twice.
+func (m *migrator) applyNext() (*Migration, error) {
+	tx, err := m.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	if m.lock != "" {
+		if _, err := tx.Exec(m.lock); err != nil {
+			return nil, err
+		}
+	}
+	if _, err := tx.Exec(m.createTable); err != nil {
+		return nil, fmt.Errorf("creating schema_migrations: %w", err)
+	}
+	current, err := m.currentVersion(tx)
+	if err != nil {
+		return nil, err
+	}
+	if err := m.checkVersion(current); err != nil {
+		return nil, err
+	}
+
+	for i := range m.migrations {
+		mig := &m.migrations[i]
+		if mig.Version <= current {
+			continue
+		}
+		if err := mig.up(tx); err != nil {
+			return nil, fmt.Errorf("migration %d (%s): %w", mig.Version, mig.Name, err)
+		}
+		if _, err := tx.Exec(m.insert, mig.Version, mig.Name, time.Now().UTC()); err != nil {
+			return nil, err
+		}
+		return mig, tx.Commit()
+	}
+	return nil, tx.Commit()
+}
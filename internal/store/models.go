@@ -1,7 +1,13 @@
 package store
 
 import (
+	"database/sql/driver"
 	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/google/uuid"
@@ -9,12 +15,21 @@ import (
 
 type JobState string
 
+// DefaultQueue is the queue used for jobs that do not name one.
+const DefaultQueue = "default"
+
 const (
 	StatePending    JobState = "pending"
 	StateProcessing JobState = "processing"
 	StateCompleted  JobState = "completed"
 	StateFailed     JobState = "failed"
 	StateDead       JobState = "dead"
+	StateCancelled  JobState = "cancelled"
+	StateBlocked    JobState = "blocked" // Waiting for the jobs it depends on to complete
+
+	// StateScheduled is never stored. It names the pending jobs whose NextRunAt is
+	// still in the future, as opposed to pending jobs that are ready to run.
+	StateScheduled JobState = "scheduled"
 )
 
 type Job struct {
@@ -25,34 +40,566 @@ type Job struct {
 	MaxRetries int       `json:"max_retries"`
 	CreatedAt  time.Time `json:"created_at"`
 	UpdatedAt  time.Time `json:"updated_at"`
-	NextRunAt  time.Time `json:"-"` // Not exposed in JSON, used for scheduling
+	NextRunAt  time.Time `json:"next_run_at"` // The job is not claimed before this time
+	Queue      string    `json:"queue"`
+	Priority   int       `json:"priority"` // Higher runs first
+	// Reruns counts the times the job was put back in the queue with fresh attempts, by a
+	// DLQ retry or a rerun. It tells the attempts of each rerun apart in the history.
+	Reruns int `json:"reruns"`
+	// Timeout bounds a single attempt. Zero means the configured default applies.
+	Timeout time.Duration `json:"timeout"`
+	// Env is added to the environment the command runs in.
+	Env Env `json:"env,omitempty"`
+
+	// Retry policy overrides. Zero values fall back to the global configuration.
+	Backoff     BackoffStrategy `json:"backoff,omitempty"`
+	BackoffBase float64         `json:"backoff_base,omitempty"`
+	MaxBackoff  time.Duration   `json:"max_backoff,omitempty"` // Upper bound on a single retry delay
+	Jitter      float64         `json:"jitter,omitempty"`      // Fraction of the delay randomized away, 0 to 1
+
+	// Exit code classification. A failure with an exit code in FailFastExitCodes goes straight
+	// to the DLQ; if RetryOnExitCodes is set, only failures with those exit codes are retried.
+	RetryOnExitCodes  ExitCodes `json:"retry_on_exit_codes,omitempty"`
+	FailFastExitCodes ExitCodes `json:"fail_fast_exit_codes,omitempty"`
+
+	// DependsOn lists the jobs that must complete before this one can run. Until they have,
+	// the job is blocked. Enqueue stores them and GetJob loads them; job lists leave them out.
+	DependsOn []string `json:"depends_on,omitempty"`
+	// OnDependencyFailure decides what happens if a dependency dies or is cancelled instead.
+	// Empty means DependencyCancel.
+	OnDependencyFailure DependencyPolicy `json:"on_dependency_failure,omitempty"`
+
+	// IdempotencyKey, if set, makes Enqueue skip the job when a job with the same key
+	// already exists within IdempotencyScope. IdempotencyTTL is the window of IdempotencyTTLScope.
+	IdempotencyKey   string           `json:"idempotency_key,omitempty"`
+	IdempotencyScope IdempotencyScope `json:"idempotency_scope,omitempty"`
+	IdempotencyTTL   time.Duration    `json:"idempotency_ttl,omitempty"`
+
+	// ConcurrencyKey, if set, names a resource the job uses: no more than ConcurrencyLimit
+	// jobs with the same key are processing at once, across all workers and managers.
+	ConcurrencyKey   string `json:"concurrency_key,omitempty"`
+	ConcurrencyLimit int    `json:"concurrency_limit,omitempty"`
+	// RateKey names the rate limit the job counts against. Empty means the limit named after
+	// the job's queue, if there is one.
+	RateKey string `json:"rate_key,omitempty"`
+
+	// LeaseOwner and LeaseExpiresAt are set while a worker holds the job in
+	// the processing state. A lease that is not renewed before it expires is
+	// considered orphaned and the job is reclaimed.
+	LeaseOwner     string    `json:"lease_owner"`
+	LeaseExpiresAt time.Time `json:"lease_expires_at"`
+}
+
+// ResetForRetry puts a dead job back in the queue with a fresh set of attempts.
+func (j *Job) ResetForRetry() {
+	j.State = StatePending
+	j.Attempts = 0
+	j.Reruns++
+	j.NextRunAt = time.Now().UTC()
+}
+
+// JobResult is the outcome of an attempt: the attempt itself and the job's state after it.
+type JobResult struct {
+	Job     *Job
+	Attempt *Attempt
+	Lease   string // The lease owner the job was claimed for, as passed to UpdateJob
+}
+
+// QueueStats summarises the jobs in one queue.
+type QueueStats struct {
+	Queue string
+	// Counts holds the number of jobs in each state, with StateScheduled for pending jobs
+	// that are not yet due.
+	Counts map[JobState]int
+	// OldestPending is the creation time of the oldest pending job that is ready to run, or
+	// zero if there is none.
+	OldestPending time.Time
+}
+
+// WorkerRecord is a running worker's entry in the worker registry.
+type WorkerRecord struct {
+	// ID is the worker's lease owner, unique across hosts and processes.
+	ID         string    `json:"id"`
+	Hostname   string    `json:"hostname"`
+	ManagerPID int       `json:"manager_pid"`
+	Queue      string    `json:"queue"`       // Empty means any queue
+	CurrentJob string    `json:"current_job"` // Empty while idle
+	StartedAt  time.Time `json:"started_at"`
+	LastSeen   time.Time `json:"last_seen"`
+}
+
+// BackoffStrategy decides how the delay before a retry grows with the number of attempts.
+type BackoffStrategy string
+
+const (
+	BackoffExponential BackoffStrategy = "exponential" // base ^ attempts seconds
+	BackoffLinear      BackoffStrategy = "linear"      // base * attempts seconds
+	BackoffFixed       BackoffStrategy = "fixed"       // base seconds
+)
+
+// DependencyPolicy decides what happens to a blocked job when a job it depends on dies or
+// is cancelled, and so will not complete.
+type DependencyPolicy string
+
+const (
+	DependencyCancel DependencyPolicy = "cancel" // Cancel the job, and in turn the jobs that depend on it
+	DependencyWait   DependencyPolicy = "wait"   // Stay blocked, e.g. until the dependency is retried from the DLQ
+)
+
+// IdempotencyScope decides which existing jobs with the same idempotency key make an
+// enqueued job a duplicate.
+type IdempotencyScope string
+
+const (
+	IdempotencyPending  IdempotencyScope = "pending" // Jobs that have not started: pending, scheduled or blocked
+	IdempotencyActive   IdempotencyScope = "active"  // Jobs that have not finished: also processing
+	IdempotencyTTLScope IdempotencyScope = "ttl"     // Jobs created within IdempotencyTTL, in any state
+)
+
+// EnqueueResult says what Enqueue did with a job.
+type EnqueueResult struct {
+	// JobID is the ID of the enqueued job or, for a duplicate, of the existing job.
+	JobID string `json:"id"`
+	// Duplicate is set when the job was not enqueued because a job with the same
+	// idempotency key exists.
+	Duplicate bool `json:"duplicate"`
+}
+
+// ClaimOptions controls which job FindAndLockJob claims and how it is held.
+type ClaimOptions struct {
+	Queue string        // Only claim from this queue; empty means any queue
+	Owner string        // Lease owner recorded on the claimed job
+	Lease time.Duration // How long the claim is held without renewal
+
+	// PriorityAging raises a waiting job's effective priority by one for every
+	// PriorityAging it has waited, so low-priority jobs are not starved. Zero disables aging.
+	PriorityAging time.Duration
+}
+
+// Attempt records the outcome of a single execution of a job.
+type Attempt struct {
+	JobID      string    `json:"job_id"`
+	Rerun      int       `json:"rerun"` // The job's Reruns when it ran; attempts count from 1 in each
+	Attempt    int       `json:"attempt"`
+	Worker     string    `json:"worker"`
+	StartedAt  time.Time `json:"started_at"`
+	FinishedAt time.Time `json:"finished_at"`
+	ExitCode   int       `json:"exit_code"` // -1 if the command was killed by a signal or never started
+	Signal     string    `json:"signal,omitempty"`
+	Stdout     string    `json:"stdout"`
+	Stderr     string    `json:"stderr"`
+	Error      string    `json:"error,omitempty"`
+	// Reason classifies a failed attempt; it is empty when the attempt succeeded.
+	Reason FailureReason `json:"reason,omitempty"`
+	// Classification records the retry decision made for a failed attempt.
+	Classification Classification `json:"classification,omitempty"`
+}
+
+// Classification is the retry decision taken after a failed attempt.
+type Classification string
+
+const (
+	ClassRetry            Classification = "retry"             // The job was scheduled for another attempt
+	ClassRetriesExhausted Classification = "retries_exhausted" // The job used up its retries and was dead-lettered
+	ClassFailFast         Classification = "fail_fast"         // The exit code is listed as fail-fast
+	ClassNotRetryable     Classification = "not_retryable"     // The failure is not in the retryable set
+)
+
+// ExitCodes is a list of process exit codes, stored as a comma separated string.
+type ExitCodes []int
+
+func (c ExitCodes) Value() (driver.Value, error) {
+	parts := make([]string, len(c))
+	for i, code := range c {
+		parts[i] = strconv.Itoa(code)
+	}
+	return strings.Join(parts, ","), nil
+}
+
+func (c *ExitCodes) Scan(src interface{}) error {
+	var s string
+	switch v := src.(type) {
+	case string:
+		s = v
+	case []byte:
+		s = string(v)
+	case nil:
+	default:
+		return fmt.Errorf("cannot scan %T into ExitCodes", src)
+	}
+	codes, err := ParseExitCodes(s)
+	if err != nil {
+		return err
+	}
+	*c = codes
+	return nil
+}
+
+// Env holds environment variables for a job's command, stored as a JSON object.
+type Env map[string]string
+
+func (e Env) Value() (driver.Value, error) {
+	if len(e) == 0 {
+		return "", nil
+	}
+	b, err := json.Marshal(map[string]string(e))
+	return string(b), err
+}
+
+func (e *Env) Scan(src interface{}) error {
+	var b []byte
+	switch v := src.(type) {
+	case string:
+		b = []byte(v)
+	case []byte:
+		b = v
+	case nil:
+	default:
+		return fmt.Errorf("cannot scan %T into Env", src)
+	}
+	if len(b) == 0 {
+		*e = nil
+		return nil
+	}
+	return json.Unmarshal(b, (*map[string]string)(e))
+}
+
+// Environ returns the variables as KEY=value pairs, sorted by name.
+func (e Env) Environ() []string {
+	vars := make([]string, 0, len(e))
+	for k, v := range e {
+		vars = append(vars, k+"="+v)
+	}
+	sort.Strings(vars)
+	return vars
+}
+
+// ParseExitCodes parses a comma separated list of exit codes such as "64,65".
+func ParseExitCodes(s string) (ExitCodes, error) {
+	var codes ExitCodes
+	for _, part := range strings.Split(s, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		code, err := strconv.Atoi(part)
+		if err != nil || code < 0 || code > 255 {
+			return nil, fmt.Errorf("invalid exit code: %s", part)
+		}
+		codes = append(codes, code)
+	}
+	return codes, nil
+}
+
+// FailureReason says why an attempt failed.
+type FailureReason string
+
+const (
+	ReasonExitCode   FailureReason = "exit_code"   // The command exited with a non-zero status
+	ReasonSignal     FailureReason = "signal"      // The command was killed by a signal
+	ReasonStartError FailureReason = "start_error" // The command could not be started
+	ReasonTimedOut   FailureReason = "timed_out"   // The command ran past its timeout and was killed
+	ReasonCancelled  FailureReason = "cancelled"   // The job was cancelled while running and was killed
+	ReasonLeaseLost  FailureReason = "lease_lost"  // The job was reclaimed while running and was killed
+)
+
+// MisfirePolicy decides what happens to schedule ticks that were missed, for example
+// because no worker manager was running when they were due.
+type MisfirePolicy string
+
+const (
+	MisfireSkip    MisfirePolicy = "skip" // Drop missed ticks and wait for the next one
+	MisfireRunOnce MisfirePolicy = "once" // Enqueue a single job for all missed ticks
+	MisfireCatchUp MisfirePolicy = "all"  // Enqueue one job for every missed tick
+)
+
+// Schedule enqueues a job from Template at every tick of a cron expression.
+type Schedule struct {
+	Name          string        `json:"name"`
+	CronExpr      string        `json:"cron"`
+	Timezone      string        `json:"timezone"`
+	Template      string        `json:"template"` // JSON job spec, as accepted by NewJobFromSpec
+	MisfirePolicy MisfirePolicy `json:"misfire_policy"`
+	Paused        bool          `json:"paused"`
+	NextRunAt     time.Time     `json:"next_run_at"`
+	LastRunAt     time.Time     `json:"last_run_at"`
+	CreatedAt     time.Time     `json:"created_at"`
+}
+
+// RateLimit is a token bucket limiting how often jobs start. Each claim takes a token; the
+// bucket refills at Rate tokens per Per and holds at most Burst.
+type RateLimit struct {
+	Name  string        `json:"name"` // The queue it limits, or the rate_key of the jobs it limits
+	Rate  int           `json:"rate"`
+	Per   time.Duration `json:"per"`
+	Burst int           `json:"burst"`
+	// Tokens is the number of jobs that could start at UpdatedAt.
+	Tokens    float64   `json:"tokens"`
+	UpdatedAt time.Time `json:"updated_at"`
+	// Ready is the number of pending jobs under the limit that are due. Only ListRateLimits
+	// fills it in.
+	Ready int `json:"ready"`
+}
+
+// Workflow is one run of a workflow file. Each step is a job, and the jobs depend on each
+// other as the steps do.
+type Workflow struct {
+	ID        string         `json:"id"`
+	Name      string         `json:"name"`
+	Steps     []WorkflowStep `json:"steps"` // Every step comes after the steps it depends on
+	CreatedAt time.Time      `json:"created_at"`
+}
+
+// WorkflowStep is a step of a workflow run and the job that runs it.
+type WorkflowStep struct {
+	Name      string   `json:"name"`
+	JobID     string   `json:"job_id"`
+	DependsOn []string `json:"depends_on,omitempty"` // Names of other steps
+}
+
+// jobSpec is the JSON job specification accepted by NewJobFromSpec.
+type jobSpec struct {
+	ID       string `json:"id"`
+	Command  string `json:"command"`
+	Queue    string `json:"queue"`
+	Priority int    `json:"priority"`
+	RunAt    string `json:"run_at"` // RFC3339 timestamp
+	Delay    string `json:"delay"`  // Go duration, e.g. "10m"
+	Timeout  string `json:"timeout"`
+	Env      Env    `json:"env"`
+
+	IdempotencyKey   string           `json:"idempotency_key"`
+	IdempotencyScope IdempotencyScope `json:"idempotency_scope"`
+	IdempotencyTTL   string           `json:"idempotency_ttl"`
+
+	ConcurrencyKey   string `json:"concurrency_key"`
+	ConcurrencyLimit *int   `json:"concurrency_limit"`
+	RateKey          string `json:"rate_key"`
+
+	MaxRetries  *int            `json:"max_retries"`
+	Backoff     BackoffStrategy `json:"backoff"`
+	BackoffBase float64         `json:"backoff_base"`
+	MaxBackoff  string          `json:"max_backoff"`
+	Jitter      float64         `json:"jitter"`
+
+	RetryOnExitCodes  []int `json:"retry_on_exit_codes"`
+	FailFastExitCodes []int `json:"fail_fast_exit_codes"`
+
+	DependsOn           []string         `json:"depends_on"`
+	OnDependencyFailure DependencyPolicy `json:"on_dependency_failure"`
+}
+
+// specFields holds the JSON names of the fields of jobSpec.
+var specFields = func() map[string]bool {
+	fields := make(map[string]bool)
+	t := reflect.TypeOf(jobSpec{})
+	for i := 0; i < t.NumField(); i++ {
+		name, _, _ := strings.Cut(t.Field(i).Tag.Get("json"), ",")
+		fields[name] = true
+	}
+	return fields
+}()
+
+// IsSpecField reports whether name is a field of the job specification.
+func IsSpecField(name string) bool {
+	return specFields[name]
 }
 
 // NewJobFromSpec creates a job from a JSON string specification.
 func NewJobFromSpec(spec string, defaultMaxRetries int) (*Job, error) {
-	var partialJob struct {
-		ID      string `json:"id"`
-		Command string `json:"command"`
-	}
+	var partialJob jobSpec
 
 	if err := json.Unmarshal([]byte(spec), &partialJob); err != nil {
 		return nil, err
 	}
 
+	now := time.Now().UTC()
+	nextRunAt := now
+	switch {
+	case partialJob.RunAt != "" && partialJob.Delay != "":
+		return nil, fmt.Errorf("run_at and delay cannot both be set")
+	case partialJob.RunAt != "":
+		runAt, err := time.Parse(time.RFC3339, partialJob.RunAt)
+		if err != nil {
+			return nil, fmt.Errorf("invalid run_at: %w", err)
+		}
+		nextRunAt = runAt.UTC()
+	case partialJob.Delay != "":
+		delay, err := time.ParseDuration(partialJob.Delay)
+		if err != nil {
+			return nil, fmt.Errorf("invalid delay: %w", err)
+		}
+		if delay < 0 {
+			return nil, fmt.Errorf("invalid delay: %s is negative", partialJob.Delay)
+		}
+		nextRunAt = now.Add(delay)
+	}
+
 	jobID := partialJob.ID
 	if jobID == "" {
 		jobID = uuid.New().String()
 	}
 
-	now := time.Now().UTC()
+	var timeout time.Duration
+	if partialJob.Timeout != "" {
+		var err error
+		timeout, err = time.ParseDuration(partialJob.Timeout)
+		if err != nil {
+			return nil, fmt.Errorf("invalid timeout: %w", err)
+		}
+		if timeout <= 0 {
+			return nil, fmt.Errorf("invalid timeout: %s is not positive", partialJob.Timeout)
+		}
+	}
+
+	maxRetries := defaultMaxRetries
+	if partialJob.MaxRetries != nil {
+		if *partialJob.MaxRetries < 0 {
+			return nil, fmt.Errorf("invalid max_retries: %d is negative", *partialJob.MaxRetries)
+		}
+		maxRetries = *partialJob.MaxRetries
+	}
+
+	switch partialJob.Backoff {
+	case "", BackoffExponential, BackoffLinear, BackoffFixed:
+	default:
+		return nil, fmt.Errorf("invalid backoff: %s. valid strategies are exponential, linear, fixed", partialJob.Backoff)
+	}
+	if partialJob.BackoffBase < 0 {
+		return nil, fmt.Errorf("invalid backoff_base: %v is negative", partialJob.BackoffBase)
+	}
+	if partialJob.Jitter < 0 || partialJob.Jitter > 1 {
+		return nil, fmt.Errorf("invalid jitter: %v is not between 0 and 1", partialJob.Jitter)
+	}
+	var maxBackoff time.Duration
+	if partialJob.MaxBackoff != "" {
+		var err error
+		maxBackoff, err = time.ParseDuration(partialJob.MaxBackoff)
+		if err != nil {
+			return nil, fmt.Errorf("invalid max_backoff: %w", err)
+		}
+		if maxBackoff <= 0 {
+			return nil, fmt.Errorf("invalid max_backoff: %s is not positive", partialJob.MaxBackoff)
+		}
+	}
+
+	for _, code := range append(append([]int{}, partialJob.RetryOnExitCodes...), partialJob.FailFastExitCodes...) {
+		if code < 0 || code > 255 {
+			return nil, fmt.Errorf("invalid exit code: %d", code)
+		}
+	}
+
+	for name := range partialJob.Env {
+		if name == "" || strings.ContainsAny(name, "=\x00") {
+			return nil, fmt.Errorf("invalid env: %q is not a valid variable name", name)
+		}
+	}
+
+	var dependsOn []string
+	seen := make(map[string]bool)
+	for _, dep := range partialJob.DependsOn {
+		if dep == "" {
+			return nil, fmt.Errorf("invalid depends_on: job IDs cannot be empty")
+		}
+		if dep == jobID {
+			return nil, fmt.Errorf("invalid depends_on: job %s cannot depend on itself", jobID)
+		}
+		if !seen[dep] {
+			seen[dep] = true
+			dependsOn = append(dependsOn, dep)
+		}
+	}
+	switch partialJob.OnDependencyFailure {
+	case "", DependencyCancel, DependencyWait:
+	default:
+		return nil, fmt.Errorf("invalid on_dependency_failure: %s. valid policies are cancel, wait", partialJob.OnDependencyFailure)
+	}
+
+	scope := partialJob.IdempotencyScope
+	var idempotencyTTL time.Duration
+	if partialJob.IdempotencyTTL != "" {
+		var err error
+		idempotencyTTL, err = time.ParseDuration(partialJob.IdempotencyTTL)
+		if err != nil {
+			return nil, fmt.Errorf("invalid idempotency_ttl: %w", err)
+		}
+		if idempotencyTTL <= 0 {
+			return nil, fmt.Errorf("invalid idempotency_ttl: %s is not positive", partialJob.IdempotencyTTL)
+		}
+		if scope == "" {
+			scope = IdempotencyTTLScope
+		}
+	}
+	switch scope {
+	case "":
+		if partialJob.IdempotencyKey != "" {
+			scope = IdempotencyPending
+		}
+	case IdempotencyPending, IdempotencyActive:
+		if idempotencyTTL != 0 {
+			return nil, fmt.Errorf("invalid idempotency_ttl: only the ttl scope has one")
+		}
+	case IdempotencyTTLScope:
+		if idempotencyTTL == 0 {
+			return nil, fmt.Errorf("invalid idempotency_scope: the ttl scope needs an idempotency_ttl")
+		}
+	default:
+		return nil, fmt.Errorf("invalid idempotency_scope: %s. valid scopes are pending, active, ttl", scope)
+	}
+	if scope != "" && partialJob.IdempotencyKey == "" {
+		return nil, fmt.Errorf("invalid idempotency_scope: no idempotency_key is set")
+	}
+
+	var concurrencyLimit int
+	if partialJob.ConcurrencyKey != "" {
+		concurrencyLimit = 1
+	}
+	if partialJob.ConcurrencyLimit != nil {
+		if partialJob.ConcurrencyKey == "" {
+			return nil, fmt.Errorf("invalid concurrency_limit: no concurrency_key is set")
+		}
+		if *partialJob.ConcurrencyLimit < 1 {
+			return nil, fmt.Errorf("invalid concurrency_limit: %d is not positive", *partialJob.ConcurrencyLimit)
+		}
+		concurrencyLimit = *partialJob.ConcurrencyLimit
+	}
+
+	queue := partialJob.Queue
+	if queue == "" {
+		queue = DefaultQueue
+	}
+
 	return &Job{
 		ID:         jobID,
 		Command:    partialJob.Command,
 		State:      StatePending,
 		Attempts:   0,
-		MaxRetries: defaultMaxRetries,
+		MaxRetries: maxRetries,
 		CreatedAt:  now,
 		UpdatedAt:  now,
-		NextRunAt:  now,
+		NextRunAt:  nextRunAt,
+		Queue:      queue,
+		Priority:   partialJob.Priority,
+		Timeout:    timeout,
+		Env:        partialJob.Env,
+
+		Backoff:     partialJob.Backoff,
+		BackoffBase: partialJob.BackoffBase,
+		MaxBackoff:  maxBackoff,
+		Jitter:      partialJob.Jitter,
+
+		RetryOnExitCodes:  partialJob.RetryOnExitCodes,
+		FailFastExitCodes: partialJob.FailFastExitCodes,
+
+		DependsOn:           dependsOn,
+		OnDependencyFailure: partialJob.OnDependencyFailure,
+
+		IdempotencyKey:   partialJob.IdempotencyKey,
+		IdempotencyScope: scope,
+		IdempotencyTTL:   idempotencyTTL,
+
+		ConcurrencyKey:   partialJob.ConcurrencyKey,
+		ConcurrencyLimit: concurrencyLimit,
+		RateKey:          partialJob.RateKey,
 	}, nil
 }
@@ -0,0 +1,32 @@
+package store
+
+import (
+	"strings"
+)
+
+// Open opens the store at dsn and migrates it to the latest schema. A postgres:// or
+// postgresql:// URL selects PostgreSQL, and anything else is taken as the path of a SQLite
+// database.
+func Open(dsn string) (Store, error) {
+	if isPostgresURL(dsn) {
+		return NewPostgresStore(dsn)
+	}
+	return NewSQLiteStore(sqlitePath(dsn))
+}
+
+// OpenForMigration opens the store at dsn like Open, but leaves its schema alone so that
+// pending migrations can be listed before they are applied.
+func OpenForMigration(dsn string) (Store, error) {
+	if isPostgresURL(dsn) {
+		return openPostgresStore(dsn)
+	}
+	return openSQLiteStore(sqlitePath(dsn))
+}
+
+func isPostgresURL(dsn string) bool {
+	return strings.HasPrefix(dsn, "postgres://") || strings.HasPrefix(dsn, "postgresql://")
+}
+
+func sqlitePath(dsn string) string {
+	return strings.TrimPrefix(dsn, "sqlite://")
+}
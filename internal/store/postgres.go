@@ -0,0 +1,723 @@
+package store
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/url"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// PostgresStore keeps jobs in PostgreSQL, so that managers on many hosts can share one
+// queue. Claims lock the rows they take with FOR UPDATE SKIP LOCKED, so concurrent claimers
+// pass over each other's jobs instead of queueing behind them.
+type PostgresStore struct {
+	db *sql.DB
+}
+
+// NewPostgresStore connects to the database at a postgres:// URL and migrates it to the
+// latest schema.
+func NewPostgresStore(dbURL string) (*PostgresStore, error) {
+	store, err := openPostgresStore(dbURL)
+	if err != nil {
+		return nil, err
+	}
+	if err := store.Init(); err != nil {
+		store.Close()
+		return nil, err
+	}
+	return store, nil
+}
+
+// openPostgresStore connects to the database at dbURL without touching its schema.
+func openPostgresStore(dbURL string) (*PostgresStore, error) {
+	u, err := url.Parse(dbURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid database URL: %w", err)
+	}
+	// Times come back in the session time zone. Ask for UTC, which is what SQLite returns.
+	q := u.Query()
+	if q.Get("timezone") == "" {
+		q.Set("timezone", "UTC")
+		u.RawQuery = q.Encode()
+	}
+
+	db, err := sql.Open("postgres", u.String())
+	if err != nil {
+		return nil, err
+	}
+	return &PostgresStore{db: db}, nil
+}
+
+func (s *PostgresStore) Init() error {
+	_, err := s.migrator().Migrate()
+	return err
+}
+
+// pgArgs collects the arguments of a query built up piece by piece, numbering the
+// placeholders as it goes.
+type pgArgs []interface{}
+
+// add appends v and returns its placeholder.
+func (a *pgArgs) add(v interface{}) string {
+	*a = append(*a, v)
+	return "$" + strconv.Itoa(len(*a))
+}
+
+func (s *PostgresStore) Enqueue(job *Job) (EnqueueResult, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return EnqueueResult{}, err
+	}
+	defer tx.Rollback()
+
+	duplicateOf, err := pgInsertJob(tx, job)
+	if err != nil || duplicateOf != "" {
+		return EnqueueResult{JobID: duplicateOf, Duplicate: duplicateOf != ""}, err
+	}
+	return EnqueueResult{JobID: job.ID}, tx.Commit()
+}
+
+func pgInsertJob(tx *sql.Tx, job *Job) (string, error) {
+	if job.Queue == "" {
+		job.Queue = DefaultQueue
+	}
+	duplicateOf, err := pgFindDuplicate(tx, job)
+	if err != nil || duplicateOf != "" {
+		return duplicateOf, err
+	}
+	if len(job.DependsOn) > 0 {
+		states, err := pgDependencyStates(tx, job.DependsOn)
+		if err != nil {
+			return "", err
+		}
+		job.State = stateAfterDependencies(job.State, job.OnDependencyFailure, states)
+	}
+
+	query := `INSERT INTO jobs (id, command, state, attempts, max_retries, created_at, updated_at, next_run_at, queue, priority, timeout,
+                  backoff, backoff_base, max_backoff, jitter, retry_on_exit_codes, fail_fast_exit_codes, on_dependency_failure, env,
+                  idempotency_key, idempotency_scope, idempotency_ttl, concurrency_key, concurrency_limit, rate_key, reruns)
+              VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17, $18, $19, $20, $21, $22, $23, $24, $25, $26)`
+	_, err = tx.Exec(query, job.ID, job.Command, job.State, job.Attempts, job.MaxRetries, job.CreatedAt, job.UpdatedAt, job.NextRunAt,
+		job.Queue, job.Priority, job.Timeout, job.Backoff, job.BackoffBase, job.MaxBackoff, job.Jitter,
+		job.RetryOnExitCodes, job.FailFastExitCodes, job.OnDependencyFailure, job.Env,
+		job.IdempotencyKey, job.IdempotencyScope, job.IdempotencyTTL, job.ConcurrencyKey, job.ConcurrencyLimit, job.RateKey, job.Reruns)
+	if err != nil {
+		return "", pgJobExists(job.ID, err)
+	}
+
+	for _, dep := range job.DependsOn {
+		if _, err := tx.Exec(`INSERT INTO job_dependencies (job_id, depends_on) VALUES ($1, $2)`, job.ID, dep); err != nil {
+			return "", err
+		}
+	}
+	return "", nil
+}
+
+// pgJobExists turns the unique violation of inserting a job whose ID is taken into
+// ErrJobExists.
+func pgJobExists(id string, err error) error {
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) && pqErr.Code == "23505" && pqErr.Constraint == "jobs_pkey" {
+		return fmt.Errorf("%w: %s", ErrJobExists, id)
+	}
+	return err
+}
+
+// postgresIdempotencyLock is the first key of the advisory locks taken on idempotency keys;
+// the second is a hash of the key.
+const postgresIdempotencyLock = 0x69646d70 // "idmp"
+
+// pgFindDuplicate is findDuplicate for PostgreSQL. Nothing stops two transactions from both
+// finding no duplicate and inserting, so the key is locked until the caller commits first.
+func pgFindDuplicate(tx *sql.Tx, job *Job) (string, error) {
+	if job.IdempotencyKey == "" {
+		return "", nil
+	}
+	if _, err := tx.Exec(`SELECT pg_advisory_xact_lock($1, hashtext($2))`, postgresIdempotencyLock, job.IdempotencyKey); err != nil {
+		return "", err
+	}
+
+	var args pgArgs
+	where := `idempotency_key = ` + args.add(job.IdempotencyKey)
+	states, since := duplicateStates(job, time.Now().UTC())
+	if len(states) > 0 {
+		where += ` AND state IN (`
+		for i, state := range states {
+			if i > 0 {
+				where += `, `
+			}
+			where += args.add(state)
+		}
+		where += `)`
+	}
+	if !since.IsZero() {
+		where += ` AND created_at >= ` + args.add(since)
+	}
+
+	var id string
+	err := tx.QueryRow(`SELECT id FROM jobs WHERE `+where+` ORDER BY created_at ASC LIMIT 1`, args...).Scan(&id)
+	if err == sql.ErrNoRows {
+		return "", nil
+	}
+	return id, err
+}
+
+// pgDependencyStates returns the states of the jobs in deps. FOR SHARE makes a dependency
+// that is finishing right now wait until the caller commits, so that finishing it is sure
+// to see the jobs the caller has made depend on it.
+func pgDependencyStates(tx *sql.Tx, deps []string) ([]JobState, error) {
+	states := make([]JobState, len(deps))
+	for i, dep := range deps {
+		err := tx.QueryRow(`SELECT state FROM jobs WHERE id = $1 FOR SHARE`, dep).Scan(&states[i])
+		if err == sql.ErrNoRows {
+			return nil, fmt.Errorf("%w: %s", ErrDependencyNotFound, dep)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	return states, nil
+}
+
+// pgSettleDependents is settleDependents for PostgreSQL.
+func pgSettleDependents(tx *sql.Tx, id string, state JobState) error {
+	now := time.Now().UTC()
+	switch state {
+	case StateCompleted:
+		// Two dependencies of a job may complete at the same time, each in a transaction that
+		// cannot see the other. Locking the dependents first makes the second wait for the
+		// first to commit, so that its check below sees both completed.
+		_, err := tx.Exec(`SELECT id FROM jobs WHERE id IN (SELECT job_id FROM job_dependencies WHERE depends_on = $1)
+                           ORDER BY id FOR UPDATE`, id)
+		if err != nil {
+			return err
+		}
+		_, err = tx.Exec(`UPDATE jobs SET state = $1, updated_at = $2
+                          WHERE state = $3 AND id IN (SELECT job_id FROM job_dependencies WHERE depends_on = $4)
+                            AND NOT EXISTS (SELECT 1 FROM job_dependencies d JOIN jobs dep ON dep.id = d.depends_on
+                                            WHERE d.job_id = jobs.id AND dep.state != $5)`,
+			StatePending, now, StateBlocked, id, StateCompleted)
+		return err
+	case StateDead, StateCancelled:
+		failed := []string{id}
+		for len(failed) > 0 {
+			cancelled, err := queryIDs(tx, `UPDATE jobs SET state = $1, updated_at = $2
+                                            WHERE state = $3 AND on_dependency_failure != $4
+                                              AND id IN (SELECT job_id FROM job_dependencies WHERE depends_on = $5)
+                                            RETURNING id`,
+				StateCancelled, now, StateBlocked, DependencyWait, failed[0])
+			if err != nil {
+				return err
+			}
+			failed = append(failed[1:], cancelled...)
+		}
+	}
+	return nil
+}
+
+func (s *PostgresStore) FindAndLockJob(opts ClaimOptions) (*Job, error) {
+	jobs, err := s.ClaimJobs(opts, 1)
+	if err != nil || len(jobs) == 0 {
+		return nil, err
+	}
+	return jobs[0], nil
+}
+
+// pgClaimCriteria is claimCriteria for PostgreSQL, adding its arguments to args.
+func pgClaimCriteria(opts ClaimOptions, now time.Time, throttled []string, args *pgArgs) (where, orderBy string) {
+	where = `state = ` + args.add(StatePending) + ` AND next_run_at <= ` + args.add(now)
+	if opts.Queue != "" {
+		where += ` AND queue = ` + args.add(opts.Queue)
+	}
+	// Pass over jobs whose concurrency key is at its limit.
+	where += ` AND (concurrency_key = '' OR (SELECT COUNT(*) FROM jobs AS holder
+               WHERE holder.concurrency_key = jobs.concurrency_key AND holder.state = ` + args.add(StateProcessing) + `) < concurrency_limit)`
+	if len(throttled) > 0 {
+		where += ` AND ` + rateKeyColumn + ` <> ALL(` + args.add(pq.Array(throttled)) + `)`
+	}
+	orderBy = `priority DESC, created_at ASC`
+	if opts.PriorityAging > 0 {
+		// Effective priority grows by one per PriorityAging waited.
+		orderBy = `priority + EXTRACT(EPOCH FROM (` + args.add(now) + `::timestamptz - created_at)) / ` +
+			args.add(opts.PriorityAging.Seconds()) + ` DESC, created_at ASC`
+	}
+	return where, orderBy
+}
+
+// postgresConcurrencyLock is the first key of the advisory locks taken on concurrency keys;
+// the second is a hash of the key.
+const postgresConcurrencyLock = 0x636f6e63 // "conc"
+
+// ClaimJobs selects the jobs to claim, a page at a time until the batch is full (see
+// admission), and claims them with one UPDATE ... RETURNING. The rows to claim are locked
+// with SKIP LOCKED, so claimers running at the same time each take different jobs rather
+// than waiting for one another.
+func (s *PostgresStore) ClaimJobs(opts ClaimOptions, n int) ([]*Job, error) {
+	if n <= 0 {
+		return nil, nil
+	}
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	// The limits read here only decide which jobs to pass over. Those used are locked
+	// and read again below, before any tokens are taken.
+	now := time.Now().UTC()
+	limits, err := queryRateLimits(tx, `SELECT `+rateLimitColumns+` FROM rate_limits`)
+	if err != nil {
+		return nil, err
+	}
+	adm := newAdmission(n, limits, now)
+	held := make(map[string]int)
+	locked := make(map[string]bool)
+	for !adm.done() {
+		var args pgArgs
+		where, orderBy := pgClaimCriteria(opts, now, adm.throttled(), &args)
+		if keys := adm.fullKeys(); len(keys) > 0 {
+			where += ` AND concurrency_key <> ALL(` + args.add(pq.Array(keys)) + `)`
+		}
+		if len(adm.ids) > 0 {
+			where += ` AND id <> ALL(` + args.add(pq.Array(adm.ids)) + `)`
+		}
+		page := adm.remaining()
+		query := `SELECT id, concurrency_key, concurrency_limit, 0, ` + rateKeyColumn + ` FROM jobs
+                  WHERE ` + where + ` ORDER BY ` + orderBy + ` LIMIT ` + args.add(page) + `
+                  FOR UPDATE SKIP LOCKED`
+		candidates, err := claimCandidates(tx, query, args...)
+		if err != nil {
+			return nil, err
+		}
+		if err := pgCountHolders(tx, candidates, held); err != nil {
+			return nil, err
+		}
+		if err := pgLockRateLimits(tx, candidates, limits, locked, now); err != nil {
+			return nil, err
+		}
+		adm.admit(candidates)
+		if len(candidates) < page {
+			break
+		}
+	}
+	ids := adm.ids
+	if len(ids) == 0 {
+		return nil, nil
+	}
+	if err := pgSaveTokens(tx, adm.used); err != nil {
+		return nil, err
+	}
+
+	var args pgArgs
+	query := `UPDATE jobs SET state = ` + args.add(StateProcessing) + `, updated_at = ` + args.add(now) + `, attempts = attempts + 1,
+                  lease_owner = ` + args.add(opts.Owner) + `, lease_expires_at = ` + args.add(now.Add(opts.Lease)) + `
+              WHERE id = ANY(` + args.add(pq.Array(ids)) + `)
+              RETURNING ` + jobColumns
+	rows, err := tx.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var jobs []*Job
+	for rows.Next() {
+		job, err := scanJob(rows)
+		if err != nil {
+			return nil, err
+		}
+		jobs = append(jobs, job)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	// RETURNING gives no guarantee of order, so restore the claim order.
+	sort.SliceStable(jobs, func(i, j int) bool {
+		pi, pj := effectivePriority(jobs[i], opts, now), effectivePriority(jobs[j], opts, now)
+		if pi != pj {
+			return pi > pj
+		}
+		return jobs[i].CreatedAt.Before(jobs[j].CreatedAt)
+	})
+	return jobs, nil
+}
+
+// pgCountHolders fills in how many processing jobs hold the concurrency key of each
+// candidate. Claimers could otherwise each see a key below its limit and together take it
+// past, so the count is only taken once the key is locked until the caller commits. A key
+// locked by another claimer is reported as full; that claimer may be about to fill it.
+// held keeps the counts taken so far in the transaction, by key.
+func pgCountHolders(tx *sql.Tx, candidates []claimCandidate, held map[string]int) error {
+	for i := range candidates {
+		c := &candidates[i]
+		if c.key == "" {
+			continue
+		}
+		n, ok := held[c.key]
+		if !ok {
+			var locked bool
+			err := tx.QueryRow(`SELECT pg_try_advisory_xact_lock($1, hashtext($2))`, postgresConcurrencyLock, c.key).Scan(&locked)
+			if err != nil {
+				return err
+			}
+			n = c.limit
+			if locked {
+				err := tx.QueryRow(`SELECT COUNT(*) FROM jobs WHERE concurrency_key = $1 AND state = $2`, c.key, StateProcessing).Scan(&n)
+				if err != nil {
+					return err
+				}
+			}
+			held[c.key] = n
+		}
+		c.held = n
+	}
+	return nil
+}
+
+func (s *PostgresStore) RenewLease(id, owner string, lease time.Duration) (bool, error) {
+	now := time.Now().UTC()
+	query := `UPDATE jobs SET lease_expires_at = $1, updated_at = $2 WHERE id = $3 AND state = $4 AND lease_owner = $5
+              RETURNING cancel_requested`
+	var cancelRequested bool
+	err := s.db.QueryRow(query, now.Add(lease), now, id, StateProcessing, owner).Scan(&cancelRequested)
+	if err == sql.ErrNoRows {
+		return false, ErrLeaseLost
+	}
+	return cancelRequested, err
+}
+
+func (s *PostgresStore) CancelJob(id string) (bool, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	var state JobState
+	if err := tx.QueryRow(`SELECT state FROM jobs WHERE id = $1 FOR UPDATE`, id).Scan(&state); err != nil {
+		return false, err
+	}
+
+	now := time.Now().UTC()
+	cancelled := false
+	switch state {
+	case StatePending, StateBlocked:
+		_, err = tx.Exec(`UPDATE jobs SET state = $1, updated_at = $2 WHERE id = $3`, StateCancelled, now, id)
+		if err == nil {
+			err = pgSettleDependents(tx, id, StateCancelled)
+		}
+		cancelled = true
+	case StateProcessing:
+		_, err = tx.Exec(`UPDATE jobs SET cancel_requested = TRUE, updated_at = $1 WHERE id = $2`, now, id)
+	default:
+		return false, ErrJobNotCancellable
+	}
+	if err != nil {
+		return false, err
+	}
+	return cancelled, tx.Commit()
+}
+
+func (s *PostgresStore) ReclaimExpiredLeases(cutoff time.Time) (int, int, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return 0, 0, err
+	}
+	defer tx.Rollback()
+
+	now := time.Now().UTC()
+	expired := `state = $3 AND (lease_expires_at IS NULL OR lease_expires_at <= $4)`
+
+	// Jobs whose cancellation was requested are not retried.
+	cancelled, err := queryIDs(tx, `UPDATE jobs SET state = $1, lease_owner = '', lease_expires_at = NULL, updated_at = $2
+                                    WHERE `+expired+` AND cancel_requested
+                                    RETURNING id`,
+		StateCancelled, now, StateProcessing, cutoff.UTC())
+	if err != nil {
+		return 0, 0, err
+	}
+	for _, id := range cancelled {
+		if err := pgSettleDependents(tx, id, StateCancelled); err != nil {
+			return 0, 0, err
+		}
+	}
+
+	dead, err := queryIDs(tx, `UPDATE jobs SET state = $1, lease_owner = '', lease_expires_at = NULL, updated_at = $2
+                               WHERE `+expired+` AND attempts >= max_retries
+                               RETURNING id`,
+		StateDead, now, StateProcessing, cutoff.UTC())
+	if err != nil {
+		return 0, 0, err
+	}
+	for _, id := range dead {
+		if err := pgSettleDependents(tx, id, StateDead); err != nil {
+			return 0, 0, err
+		}
+	}
+
+	res, err := tx.Exec(`UPDATE jobs SET state = $1, lease_owner = '', lease_expires_at = NULL, updated_at = $2, next_run_at = $2
+                        WHERE `+expired,
+		StatePending, now, StateProcessing, cutoff.UTC())
+	if err != nil {
+		return 0, 0, err
+	}
+	requeued, err := res.RowsAffected()
+	if err != nil {
+		return 0, 0, err
+	}
+
+	return int(requeued), len(dead), tx.Commit()
+}
+
+func (s *PostgresStore) UpdateJob(job *Job, lease string) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := pgUpdateJob(tx, job, lease); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func pgUpdateJob(tx *sql.Tx, job *Job, lease string) error {
+	updatedAt := time.Now().UTC()
+	query := `UPDATE jobs SET state = CASE WHEN cancel_requested AND $1::text IN ($2, $3) THEN $4 ELSE $1::text END,
+              attempts = $5, reruns = $6, updated_at = $7, next_run_at = $8, lease_owner = $9, lease_expires_at = $10, cancel_requested = FALSE
+              WHERE id = $11`
+	args := []interface{}{job.State, StatePending, StateDead, StateCancelled,
+		job.Attempts, job.Reruns, updatedAt, job.NextRunAt, job.LeaseOwner, nullTime(job.LeaseExpiresAt), job.ID}
+	if lease != "" {
+		query += ` AND state = $12 AND lease_owner = $13`
+		args = append(args, StateProcessing, lease)
+	}
+	var state JobState
+	err := tx.QueryRow(query+` RETURNING state`, args...).Scan(&state)
+	if err == sql.ErrNoRows && lease != "" {
+		return ErrLeaseLost
+	}
+	if err != nil {
+		return err
+	}
+	job.State, job.UpdatedAt = state, updatedAt
+	return pgSettleDependents(tx, job.ID, job.State)
+}
+
+func (s *PostgresStore) SetPriority(id string, priority int) error {
+	query := `UPDATE jobs SET priority = $1, updated_at = $2 WHERE id = $3 AND state = $4`
+	res, err := s.db.Exec(query, priority, time.Now().UTC(), id, StatePending)
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		// Distinguish a missing job from one that is no longer pending.
+		if _, err := s.GetJob(id); err != nil {
+			return err
+		}
+		return ErrJobNotPending
+	}
+	return nil
+}
+
+func (s *PostgresStore) RecordAttempt(a *Attempt) error {
+	return pgRecordAttempt(s.db, a)
+}
+
+func (s *PostgresStore) FinishJobs(results []*JobResult) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, r := range results {
+		if r.Attempt != nil {
+			if err := pgRecordAttempt(tx, r.Attempt); err != nil {
+				return fmt.Errorf("recording attempt %d of job %s: %w", r.Attempt.Attempt, r.Job.ID, err)
+			}
+		}
+		if err := pgUpdateJob(tx, r.Job, r.Lease); err != nil && err != ErrLeaseLost {
+			return fmt.Errorf("updating job %s: %w", r.Job.ID, err)
+		}
+	}
+	return tx.Commit()
+}
+
+func pgRecordAttempt(e execer, a *Attempt) error {
+	query := `INSERT INTO job_attempts (job_id, rerun, attempt, worker, started_at, finished_at, exit_code, signal, stdout, stderr, error, reason, classification)
+              VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13)`
+	_, err := e.Exec(query, a.JobID, a.Rerun, a.Attempt, a.Worker, a.StartedAt, a.FinishedAt, a.ExitCode, a.Signal, a.Stdout, a.Stderr, a.Error,
+		a.Reason, a.Classification)
+	return err
+}
+
+func (s *PostgresStore) ListAttempts(jobID string) ([]*Attempt, error) {
+	query := `SELECT job_id, rerun, attempt, worker, started_at, finished_at, exit_code, signal, stdout, stderr, error, reason, classification
+              FROM job_attempts WHERE job_id = $1 ORDER BY rerun ASC, attempt ASC`
+	rows, err := s.db.Query(query, jobID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var attempts []*Attempt
+	for rows.Next() {
+		a := &Attempt{}
+		err := rows.Scan(&a.JobID, &a.Rerun, &a.Attempt, &a.Worker, &a.StartedAt, &a.FinishedAt, &a.ExitCode, &a.Signal, &a.Stdout, &a.Stderr, &a.Error, &a.Reason, &a.Classification)
+		if err != nil {
+			return nil, err
+		}
+		attempts = append(attempts, a)
+	}
+	return attempts, rows.Err()
+}
+
+func (s *PostgresStore) GetJob(id string) (*Job, error) {
+	query := `SELECT ` + jobColumns + ` FROM jobs WHERE id = $1`
+	job, err := scanJob(s.db.QueryRow(query, id))
+	if err != nil {
+		return nil, err
+	}
+	job.DependsOn, err = queryIDs(s.db, `SELECT depends_on FROM job_dependencies WHERE job_id = $1 ORDER BY depends_on`, id)
+	return job, err
+}
+
+func (s *PostgresStore) JobDependencies(id string) ([]string, []string, error) {
+	dependsOn, err := queryIDs(s.db, `SELECT depends_on FROM job_dependencies WHERE job_id = $1 ORDER BY depends_on`, id)
+	if err != nil {
+		return nil, nil, err
+	}
+	dependents, err := queryIDs(s.db, `SELECT job_id FROM job_dependencies WHERE depends_on = $1 ORDER BY job_id`, id)
+	return dependsOn, dependents, err
+}
+
+func (s *PostgresStore) ListJobsByState(state JobState, queue string) ([]*Job, error) {
+	var args pgArgs
+	var where string
+	orderBy := `created_at ASC`
+	switch state {
+	case StatePending:
+		where = `state = ` + args.add(state) + ` AND next_run_at <= ` + args.add(time.Now().UTC())
+	case StateScheduled:
+		where = `state = ` + args.add(StatePending) + ` AND next_run_at > ` + args.add(time.Now().UTC())
+		orderBy = `next_run_at ASC`
+	default:
+		where = `state = ` + args.add(state)
+	}
+	if queue != "" {
+		where += ` AND queue = ` + args.add(queue)
+	}
+	query := `SELECT ` + jobColumns + ` FROM jobs WHERE ` + where + ` ORDER BY ` + orderBy
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var jobs []*Job
+	for rows.Next() {
+		job, err := scanJob(rows)
+		if err != nil {
+			return nil, err
+		}
+		jobs = append(jobs, job)
+	}
+	return jobs, rows.Err()
+}
+
+func (s *PostgresStore) ListJobsByConcurrencyKey(key string) ([]*Job, error) {
+	query := `SELECT ` + jobColumns + ` FROM jobs WHERE concurrency_key = $1 AND state IN ($2, $3)
+              ORDER BY CASE WHEN state = $2 THEN 0 ELSE 1 END, priority DESC, created_at ASC`
+	rows, err := s.db.Query(query, key, StateProcessing, StatePending)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var jobs []*Job
+	for rows.Next() {
+		job, err := scanJob(rows)
+		if err != nil {
+			return nil, err
+		}
+		jobs = append(jobs, job)
+	}
+	return jobs, rows.Err()
+}
+
+func (s *PostgresStore) GetStatusSummary(queue string) (map[JobState]int, error) {
+	var args pgArgs
+	viewState := `CASE WHEN state = ` + args.add(StatePending) + ` AND next_run_at > ` + args.add(time.Now().UTC()) +
+		` THEN ` + args.add(StateScheduled) + `::text ELSE state END`
+	where := ``
+	if queue != "" {
+		where = `WHERE queue = ` + args.add(queue)
+	}
+	query := `SELECT ` + viewState + ` AS view_state, COUNT(*) FROM jobs ` + where + ` GROUP BY view_state`
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	summary := make(map[JobState]int)
+	for rows.Next() {
+		var state JobState
+		var count int
+		if err := rows.Scan(&state, &count); err != nil {
+			return nil, err
+		}
+		summary[state] = count
+	}
+	return summary, rows.Err()
+}
+
+func (s *PostgresStore) GetQueueStats() ([]*QueueStats, error) {
+	now := time.Now().UTC()
+	query := `SELECT queue, CASE WHEN state = $1 AND next_run_at > $2 THEN $3::text ELSE state END AS view_state, COUNT(*),
+                     MIN(CASE WHEN state = $1 AND next_run_at <= $2 THEN created_at END)
+              FROM jobs GROUP BY queue, view_state ORDER BY queue`
+	rows, err := s.db.Query(query, StatePending, now, StateScheduled)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var stats []*QueueStats
+	for rows.Next() {
+		var queue string
+		var state JobState
+		var count int
+		var oldest sql.NullTime
+		if err := rows.Scan(&queue, &state, &count, &oldest); err != nil {
+			return nil, err
+		}
+		if len(stats) == 0 || stats[len(stats)-1].Queue != queue {
+			stats = append(stats, &QueueStats{Queue: queue, Counts: make(map[JobState]int)})
+		}
+		qs := stats[len(stats)-1]
+		qs.Counts[state] = count
+		if oldest.Valid {
+			qs.OldestPending = oldest.Time.UTC()
+		}
+	}
+	return stats, rows.Err()
+}
+
+func (s *PostgresStore) Close() error {
+	return s.db.Close()
+}
@@ -0,0 +1,155 @@
+package store
+
+import (
+	"strconv"
+)
+
+// postgresMigrations is the schema history of the PostgreSQL store. Append new migrations
+// to the end; never edit or reorder one that has shipped.
+var postgresMigrations = []Migration{
+	{Version: 1, Name: "baseline", up: execMigration(postgresBaseline)},
+	{Version: 2, Name: "job dependencies", up: execMigration(`
+    ALTER TABLE jobs ADD COLUMN on_dependency_failure TEXT NOT NULL DEFAULT '';
+    CREATE TABLE job_dependencies (
+        job_id TEXT NOT NULL,
+        depends_on TEXT NOT NULL,
+        PRIMARY KEY (job_id, depends_on)
+    );
+    CREATE INDEX idx_job_dependencies_depends_on ON job_dependencies(depends_on);
+    `)},
+	{Version: 3, Name: "workflows", up: execMigration(`
+    ALTER TABLE jobs ADD COLUMN env TEXT NOT NULL DEFAULT '';
+    CREATE TABLE workflows (
+        id TEXT PRIMARY KEY,
+        name TEXT NOT NULL,
+        steps TEXT NOT NULL,
+        created_at TIMESTAMPTZ NOT NULL
+    );
+    `)},
+	{Version: 4, Name: "idempotency keys", up: execMigration(`
+    ALTER TABLE jobs ADD COLUMN idempotency_key TEXT NOT NULL DEFAULT '';
+    ALTER TABLE jobs ADD COLUMN idempotency_scope TEXT NOT NULL DEFAULT '';
+    ALTER TABLE jobs ADD COLUMN idempotency_ttl BIGINT NOT NULL DEFAULT 0;
+    CREATE INDEX idx_jobs_idempotency_key ON jobs(idempotency_key, created_at) WHERE idempotency_key != '';
+    `)},
+	{Version: 5, Name: "concurrency keys", up: execMigration(`
+    ALTER TABLE jobs ADD COLUMN concurrency_key TEXT NOT NULL DEFAULT '';
+    ALTER TABLE jobs ADD COLUMN concurrency_limit INTEGER NOT NULL DEFAULT 0;
+    CREATE INDEX idx_jobs_concurrency_key ON jobs(concurrency_key, state);
+    `)},
+	{Version: 6, Name: "rate limits", up: execMigration(`
+    ALTER TABLE jobs ADD COLUMN rate_key TEXT NOT NULL DEFAULT '';
+    CREATE TABLE rate_limits (
+        name TEXT PRIMARY KEY,
+        rate INTEGER NOT NULL,
+        per BIGINT NOT NULL,
+        burst INTEGER NOT NULL,
+        tokens DOUBLE PRECISION NOT NULL,
+        updated_at TIMESTAMPTZ NOT NULL
+    );
+    `)},
+	// Attempt numbers start again when a job is rerun, so the rerun joins the key of the
+	// attempt history.
+	{Version: 7, Name: "attempt reruns", up: execMigration(`
+    ALTER TABLE jobs ADD COLUMN reruns INTEGER NOT NULL DEFAULT 0;
+    ALTER TABLE job_attempts ADD COLUMN rerun INTEGER NOT NULL DEFAULT 0;
+    ALTER TABLE job_attempts DROP CONSTRAINT job_attempts_pkey;
+    ALTER TABLE job_attempts ADD PRIMARY KEY (job_id, rerun, attempt);
+    `)},
+}
+
+// postgresMigrationLock is the advisory lock key held by every migration transaction, so
+// that managers starting at the same time do not race to change the schema.
+const postgresMigrationLock = 0x71756575 // "queu"
+
+func (s *PostgresStore) migrator() *migrator {
+	return &migrator{
+		db:         s.db,
+		migrations: postgresMigrations,
+		createTable: `CREATE TABLE IF NOT EXISTS schema_migrations (
+            version INTEGER PRIMARY KEY,
+            name TEXT NOT NULL,
+            applied_at TIMESTAMPTZ NOT NULL
+        )`,
+		tableExists: `SELECT to_regclass('schema_migrations') IS NOT NULL`,
+		insert:      `INSERT INTO schema_migrations (version, name, applied_at) VALUES ($1, $2, $3)`,
+		lock:        `SELECT pg_advisory_xact_lock(` + strconv.Itoa(postgresMigrationLock) + `)`,
+	}
+}
+
+func (s *PostgresStore) SchemaVersion() (int, int, error) {
+	return s.migrator().SchemaVersion()
+}
+
+func (s *PostgresStore) PendingMigrations() ([]Migration, error) {
+	return s.migrator().PendingMigrations()
+}
+
+func (s *PostgresStore) Migrate() ([]Migration, error) {
+	return s.migrator().Migrate()
+}
+
+// postgresBaseline is the schema the PostgreSQL store was introduced with.
+const postgresBaseline = `
+CREATE TABLE IF NOT EXISTS jobs (
+    id TEXT PRIMARY KEY,
+    command TEXT NOT NULL,
+    state TEXT NOT NULL,
+    attempts INTEGER NOT NULL,
+    max_retries INTEGER NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL,
+    updated_at TIMESTAMPTZ NOT NULL,
+    next_run_at TIMESTAMPTZ NOT NULL,
+    lease_owner TEXT NOT NULL DEFAULT '',
+    lease_expires_at TIMESTAMPTZ,
+    queue TEXT NOT NULL DEFAULT '` + DefaultQueue + `',
+    priority INTEGER NOT NULL DEFAULT 0,
+    timeout BIGINT NOT NULL DEFAULT 0,
+    cancel_requested BOOLEAN NOT NULL DEFAULT FALSE,
+    backoff TEXT NOT NULL DEFAULT '',
+    backoff_base DOUBLE PRECISION NOT NULL DEFAULT 0,
+    max_backoff BIGINT NOT NULL DEFAULT 0,
+    jitter DOUBLE PRECISION NOT NULL DEFAULT 0,
+    retry_on_exit_codes TEXT NOT NULL DEFAULT '',
+    fail_fast_exit_codes TEXT NOT NULL DEFAULT ''
+);
+CREATE INDEX IF NOT EXISTS idx_jobs_state_next_run ON jobs(state, next_run_at);
+CREATE INDEX IF NOT EXISTS idx_jobs_state_lease ON jobs(state, lease_expires_at);
+CREATE INDEX IF NOT EXISTS idx_jobs_queue_state_next_run ON jobs(queue, state, next_run_at);
+CREATE INDEX IF NOT EXISTS idx_jobs_state_priority ON jobs(state, priority DESC, created_at);
+CREATE TABLE IF NOT EXISTS job_attempts (
+    job_id TEXT NOT NULL,
+    attempt INTEGER NOT NULL,
+    worker TEXT NOT NULL,
+    started_at TIMESTAMPTZ NOT NULL,
+    finished_at TIMESTAMPTZ NOT NULL,
+    exit_code INTEGER NOT NULL,
+    signal TEXT NOT NULL DEFAULT '',
+    stdout TEXT NOT NULL DEFAULT '',
+    stderr TEXT NOT NULL DEFAULT '',
+    error TEXT NOT NULL DEFAULT '',
+    reason TEXT NOT NULL DEFAULT '',
+    classification TEXT NOT NULL DEFAULT '',
+    PRIMARY KEY (job_id, attempt)
+);
+CREATE TABLE IF NOT EXISTS schedules (
+    name TEXT PRIMARY KEY,
+    cron_expr TEXT NOT NULL,
+    timezone TEXT NOT NULL,
+    template TEXT NOT NULL,
+    misfire_policy TEXT NOT NULL,
+    paused BOOLEAN NOT NULL DEFAULT FALSE,
+    next_run_at TIMESTAMPTZ NOT NULL,
+    last_run_at TIMESTAMPTZ,
+    created_at TIMESTAMPTZ NOT NULL
+);
+CREATE TABLE IF NOT EXISTS workers (
+    id TEXT PRIMARY KEY,
+    hostname TEXT NOT NULL,
+    manager_pid INTEGER NOT NULL,
+    queue TEXT NOT NULL DEFAULT '',
+    current_job TEXT NOT NULL DEFAULT '',
+    started_at TIMESTAMPTZ NOT NULL,
+    last_seen TIMESTAMPTZ NOT NULL
+);
+`
@@ -0,0 +1,102 @@
+package store
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// pgLockRateLimits locks the rate limits in limits that the candidates count against and
+// that are not in locked yet, and reads them again into limits, so that claimers taking
+// tokens from the same bucket do so one after the other. The first limits a claim locks
+// are locked in name order, which keeps claimers from deadlocking on each other. Any it
+// needs after that are only taken if they are free; one locked by another claimer is
+// treated as out of tokens for the rest of the claim.
+func pgLockRateLimits(tx *sql.Tx, candidates []claimCandidate, limits map[string]*RateLimit, locked map[string]bool, now time.Time) error {
+	var names []string
+	for _, c := range candidates {
+		if _, ok := limits[c.rateKey]; ok && !locked[c.rateKey] {
+			locked[c.rateKey] = true
+			names = append(names, c.rateKey)
+		}
+	}
+	if len(names) == 0 {
+		return nil
+	}
+	first := len(locked) == len(names)
+	query := `SELECT ` + rateLimitColumns + ` FROM rate_limits WHERE name = ANY($1) ORDER BY name FOR UPDATE`
+	if !first {
+		query += ` SKIP LOCKED`
+	}
+	fresh, err := queryRateLimits(tx, query, pq.Array(names))
+	if err != nil {
+		return err
+	}
+	for _, name := range names {
+		switch limit, ok := fresh[name]; {
+		case ok:
+			limits[name] = limit
+		case first:
+			delete(limits, name) // Removed since it was read
+		default:
+			limits[name] = &RateLimit{Name: name, Rate: limits[name].Rate, Per: limits[name].Per, UpdatedAt: now}
+		}
+	}
+	return nil
+}
+
+func pgSaveTokens(tx *sql.Tx, limits []*RateLimit) error {
+	for _, limit := range limits {
+		if _, err := tx.Exec(`UPDATE rate_limits SET tokens = $1, updated_at = $2 WHERE name = $3`, limit.Tokens, limit.UpdatedAt, limit.Name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *PostgresStore) SetRateLimit(limit *RateLimit) error {
+	resetRateLimit(limit, time.Now().UTC())
+	query := `INSERT INTO rate_limits (` + rateLimitColumns + `) VALUES ($1, $2, $3, $4, $5, $6)
+              ON CONFLICT (name) DO UPDATE SET rate = excluded.rate, per = excluded.per, burst = excluded.burst,
+                  tokens = excluded.tokens, updated_at = excluded.updated_at`
+	_, err := s.db.Exec(query, limit.Name, limit.Rate, limit.Per, limit.Burst, limit.Tokens, limit.UpdatedAt)
+	return err
+}
+
+func (s *PostgresStore) RemoveRateLimit(name string) error {
+	res, err := s.db.Exec(`DELETE FROM rate_limits WHERE name = $1`, name)
+	if err != nil {
+		return err
+	}
+	return requireRow(res, ErrRateLimitNotFound)
+}
+
+func (s *PostgresStore) ListRateLimits() ([]*RateLimit, error) {
+	limits, err := queryRateLimits(s.db, `SELECT `+rateLimitColumns+` FROM rate_limits`)
+	if err != nil || len(limits) == 0 {
+		return nil, err
+	}
+
+	query := `SELECT ` + rateKeyColumn + ` AS rate_key_name, COUNT(*) FROM jobs WHERE state = $1 AND next_run_at <= $2
+              GROUP BY rate_key_name`
+	rows, err := s.db.Query(query, StatePending, time.Now().UTC())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var name string
+		var ready int
+		if err := rows.Scan(&name, &ready); err != nil {
+			return nil, err
+		}
+		if limit, ok := limits[name]; ok {
+			limit.Ready = ready
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return sortedRateLimits(limits), nil
+}
@@ -0,0 +1,96 @@
+package store
+
+import (
+	"database/sql"
+	"time"
+)
+
+func (s *PostgresStore) AddSchedule(sched *Schedule) error {
+	query := `INSERT INTO schedules (` + scheduleColumns + `) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)`
+	_, err := s.db.Exec(query, sched.Name, sched.CronExpr, sched.Timezone, sched.Template, sched.MisfirePolicy, sched.Paused,
+		sched.NextRunAt, nullTime(sched.LastRunAt), sched.CreatedAt)
+	return err
+}
+
+func (s *PostgresStore) GetSchedule(name string) (*Schedule, error) {
+	sched, err := scanSchedule(s.db.QueryRow(`SELECT `+scheduleColumns+` FROM schedules WHERE name = $1`, name))
+	if err == sql.ErrNoRows {
+		return nil, ErrScheduleNotFound
+	}
+	return sched, err
+}
+
+func (s *PostgresStore) ListSchedules() ([]*Schedule, error) {
+	return s.querySchedules(`SELECT ` + scheduleColumns + ` FROM schedules ORDER BY name ASC`)
+}
+
+func (s *PostgresStore) ListDueSchedules(now time.Time) ([]*Schedule, error) {
+	query := `SELECT ` + scheduleColumns + ` FROM schedules WHERE NOT paused AND next_run_at <= $1 ORDER BY next_run_at ASC`
+	return s.querySchedules(query, now.UTC())
+}
+
+func (s *PostgresStore) querySchedules(query string, args ...interface{}) ([]*Schedule, error) {
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var schedules []*Schedule
+	for rows.Next() {
+		sched, err := scanSchedule(rows)
+		if err != nil {
+			return nil, err
+		}
+		schedules = append(schedules, sched)
+	}
+	return schedules, rows.Err()
+}
+
+func (s *PostgresStore) UpdateSchedule(sched *Schedule) error {
+	query := `UPDATE schedules SET cron_expr = $1, timezone = $2, template = $3, misfire_policy = $4, paused = $5, next_run_at = $6, last_run_at = $7
+              WHERE name = $8`
+	res, err := s.db.Exec(query, sched.CronExpr, sched.Timezone, sched.Template, sched.MisfirePolicy, sched.Paused,
+		sched.NextRunAt, nullTime(sched.LastRunAt), sched.Name)
+	if err != nil {
+		return err
+	}
+	return requireRow(res, ErrScheduleNotFound)
+}
+
+func (s *PostgresStore) RemoveSchedule(name string) error {
+	res, err := s.db.Exec(`DELETE FROM schedules WHERE name = $1`, name)
+	if err != nil {
+		return err
+	}
+	return requireRow(res, ErrScheduleNotFound)
+}
+
+// AdvanceSchedule uses the expected next tick as a compare-and-swap guard, as the SQLite
+// store does. The UPDATE locks the schedule's row, so a second manager racing for the same
+// tick waits for the first to commit and then matches no row.
+func (s *PostgresStore) AdvanceSchedule(name string, expected, next time.Time, jobs []*Job) (bool, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	now := time.Now().UTC()
+	query := `UPDATE schedules SET next_run_at = $1, last_run_at = $2 WHERE name = $3 AND next_run_at = $4 AND NOT paused`
+	res, err := tx.Exec(query, next.UTC(), now, name, expected.UTC())
+	if err != nil {
+		return false, err
+	}
+	if n, err := res.RowsAffected(); err != nil || n == 0 {
+		return false, err
+	}
+
+	// Jobs that duplicate an existing job by their idempotency key are skipped.
+	for _, job := range jobs {
+		if _, err := pgInsertJob(tx, job); err != nil {
+			return false, err
+		}
+	}
+	return true, tx.Commit()
+}
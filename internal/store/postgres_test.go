@@ -0,0 +1,28 @@
+package store_test
+
+import (
+	"testing"
+
+	"github.com/Trishvan/queuectl/internal/store"
+	"github.com/Trishvan/queuectl/internal/store/storetest"
+)
+
+// The PostgreSQL tests run against the database named by QUEUECTL_TEST_POSTGRES_DSN, and
+// are skipped without it. Its tables are dropped before every check.
+
+func TestPostgresStore(t *testing.T) {
+	dsn := storetest.Postgres(t)
+	storetest.Run(t, func() (store.Store, error) {
+		if err := storetest.ResetPostgres(dsn); err != nil {
+			return nil, err
+		}
+		return store.NewPostgresStore(dsn)
+	})
+}
+
+func TestPostgresNoDoubleClaims(t *testing.T) {
+	dsn := storetest.Postgres(t)
+	storetest.NoDoubleClaims(t, func() (store.Store, error) {
+		return store.NewPostgresStore(dsn)
+	}, storetest.StressOptions{Managers: 4, WorkersPerManager: 4, Jobs: 200})
+}
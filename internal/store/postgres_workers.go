@@ -0,0 +1,55 @@
+package store
+
+import (
+	"time"
+)
+
+func (s *PostgresStore) RegisterWorker(w *WorkerRecord) error {
+	query := `INSERT INTO workers (` + workerColumns + `) VALUES ($1, $2, $3, $4, $5, $6, $7)
+              ON CONFLICT (id) DO UPDATE SET hostname = EXCLUDED.hostname, manager_pid = EXCLUDED.manager_pid,
+                  queue = EXCLUDED.queue, current_job = EXCLUDED.current_job, started_at = EXCLUDED.started_at,
+                  last_seen = EXCLUDED.last_seen`
+	_, err := s.db.Exec(query, w.ID, w.Hostname, w.ManagerPID, w.Queue, w.CurrentJob, w.StartedAt, w.LastSeen)
+	return err
+}
+
+func (s *PostgresStore) HeartbeatWorker(id, currentJob string, at time.Time) error {
+	res, err := s.db.Exec(`UPDATE workers SET current_job = $1, last_seen = $2 WHERE id = $3`, currentJob, at.UTC(), id)
+	if err != nil {
+		return err
+	}
+	return requireRow(res, ErrWorkerNotRegistered)
+}
+
+func (s *PostgresStore) UnregisterWorker(id string) error {
+	_, err := s.db.Exec(`DELETE FROM workers WHERE id = $1`, id)
+	return err
+}
+
+func (s *PostgresStore) ListWorkers(since time.Time) ([]*WorkerRecord, error) {
+	query := `SELECT ` + workerColumns + ` FROM workers WHERE last_seen >= $1 ORDER BY hostname, manager_pid, started_at, id`
+	rows, err := s.db.Query(query, since.UTC())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var workers []*WorkerRecord
+	for rows.Next() {
+		w := &WorkerRecord{}
+		if err := rows.Scan(&w.ID, &w.Hostname, &w.ManagerPID, &w.Queue, &w.CurrentJob, &w.StartedAt, &w.LastSeen); err != nil {
+			return nil, err
+		}
+		workers = append(workers, w)
+	}
+	return workers, rows.Err()
+}
+
+func (s *PostgresStore) PruneWorkers(cutoff time.Time) (int, error) {
+	res, err := s.db.Exec(`DELETE FROM workers WHERE last_seen < $1`, cutoff.UTC())
+	if err != nil {
+		return 0, err
+	}
+	n, err := res.RowsAffected()
+	return int(n), err
+}
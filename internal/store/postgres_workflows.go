@@ -0,0 +1,87 @@
+package store
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+func (s *PostgresStore) CreateWorkflow(wf *Workflow, jobs []*Job) error {
+	steps, err := json.Marshal(wf.Steps)
+	if err != nil {
+		return err
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	query := `INSERT INTO workflows (id, name, steps, created_at) VALUES ($1, $2, $3, $4)`
+	if _, err := tx.Exec(query, wf.ID, wf.Name, string(steps), wf.CreatedAt); err != nil {
+		return err
+	}
+	for _, job := range jobs {
+		duplicateOf, err := pgInsertJob(tx, job)
+		if err == nil && duplicateOf != "" {
+			err = fmt.Errorf("its idempotency key matches job %s", duplicateOf)
+		}
+		if err != nil {
+			return fmt.Errorf("enqueueing job %s: %w", job.ID, err)
+		}
+	}
+	return tx.Commit()
+}
+
+func (s *PostgresStore) GetWorkflow(id string) (*Workflow, error) {
+	return scanWorkflow(s.db.QueryRow(`SELECT id, name, steps, created_at FROM workflows WHERE id = $1`, id))
+}
+
+func (s *PostgresStore) RerunJobs(ids []string) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, id := range ids {
+		if err := pgRerunJob(tx, id); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// pgRerunJob is rerunJob for PostgreSQL.
+func pgRerunJob(tx *sql.Tx, id string) error {
+	var state JobState
+	var policy DependencyPolicy
+	err := tx.QueryRow(`SELECT state, on_dependency_failure FROM jobs WHERE id = $1 FOR UPDATE`, id).Scan(&state, &policy)
+	if err != nil {
+		return err
+	}
+	if state == StatePending || state == StateProcessing {
+		return fmt.Errorf("%w: %s", ErrJobActive, id)
+	}
+
+	deps, err := queryIDs(tx, `SELECT depends_on FROM job_dependencies WHERE job_id = $1`, id)
+	if err != nil {
+		return err
+	}
+	states, err := pgDependencyStates(tx, deps)
+	if err != nil {
+		return err
+	}
+	state = stateAfterDependencies(StatePending, policy, states)
+
+	now := time.Now().UTC()
+	query := `UPDATE jobs SET state = $1, attempts = 0, reruns = reruns + 1, updated_at = $2, next_run_at = $2, lease_owner = '', lease_expires_at = NULL,
+              cancel_requested = FALSE
+              WHERE id = $3`
+	if _, err := tx.Exec(query, state, now, id); err != nil {
+		return err
+	}
+	return pgSettleDependents(tx, id, state)
+}
@@ -0,0 +1,129 @@
+package store
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ParseRate parses a rate such as "100/m": a number of jobs per second (s), minute (m),
+// hour (h) or Go duration, as in "5/30s".
+func ParseRate(s string) (rate int, per time.Duration, err error) {
+	count, unit, ok := strings.Cut(s, "/")
+	if !ok {
+		return 0, 0, fmt.Errorf("invalid rate %q: use <jobs>/<interval>, e.g. 100/m", s)
+	}
+	rate, err = strconv.Atoi(count)
+	if err != nil || rate < 1 {
+		return 0, 0, fmt.Errorf("invalid rate %q: %s is not a positive number of jobs", s, count)
+	}
+	switch unit {
+	case "s":
+		per = time.Second
+	case "m":
+		per = time.Minute
+	case "h":
+		per = time.Hour
+	default:
+		per, err = time.ParseDuration(unit)
+		if err != nil || per <= 0 {
+			return 0, 0, fmt.Errorf("invalid rate %q: %s is not an interval such as s, m, h or 30s", s, unit)
+		}
+	}
+	return rate, per, nil
+}
+
+// FormatRate formats a rate as ParseRate reads it.
+func FormatRate(rate int, per time.Duration) string {
+	unit := per.String()
+	switch per {
+	case time.Second:
+		unit = "s"
+	case time.Minute:
+		unit = "m"
+	case time.Hour:
+		unit = "h"
+	}
+	return fmt.Sprintf("%d/%s", rate, unit)
+}
+
+// Available returns the tokens in the bucket at now.
+func (r *RateLimit) Available(now time.Time) float64 {
+	elapsed := now.Sub(r.UpdatedAt)
+	if elapsed < 0 {
+		elapsed = 0 // UpdatedAt was set by a host whose clock is ahead
+	}
+	tokens := r.Tokens + elapsed.Seconds()*float64(r.Rate)/r.Per.Seconds()
+	if tokens > float64(r.Burst) {
+		tokens = float64(r.Burst)
+	}
+	return tokens
+}
+
+// NextToken returns how long after now the bucket next holds a whole token, or 0 if it
+// holds one already.
+func (r *RateLimit) NextToken(now time.Time) time.Duration {
+	missing := 1 - r.Available(now)
+	if missing <= 0 {
+		return 0
+	}
+	return time.Duration(missing * float64(r.Per) / float64(r.Rate))
+}
+
+// take refills the bucket to now and takes a token from it, if it holds one.
+func (r *RateLimit) take(now time.Time) bool {
+	if now.After(r.UpdatedAt) {
+		r.Tokens = r.Available(now)
+		r.UpdatedAt = now
+	}
+	if r.Tokens < 1 {
+		return false
+	}
+	r.Tokens--
+	return true
+}
+
+// throttledNames returns the names of the limits that hold no whole token at now, sorted.
+func throttledNames(limits map[string]*RateLimit, now time.Time) []string {
+	var names []string
+	for name, limit := range limits {
+		if limit.Available(now) < 1 {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// jobRateKey returns the name of the rate limit job counts against: its rate key, or else
+// its queue.
+func jobRateKey(job *Job) string {
+	if job.RateKey != "" {
+		return job.RateKey
+	}
+	return job.Queue
+}
+
+// rateKeyColumn is jobRateKey in SQL.
+const rateKeyColumn = `CASE WHEN rate_key = '' THEN queue ELSE rate_key END`
+
+// resetRateLimit fills in what SetRateLimit stores besides the limit itself: a burst of one
+// interval's jobs unless one is given, and a full bucket.
+func resetRateLimit(limit *RateLimit, now time.Time) {
+	if limit.Burst <= 0 {
+		limit.Burst = limit.Rate
+	}
+	limit.Tokens = float64(limit.Burst)
+	limit.UpdatedAt = now
+}
+
+func sortedRateLimits(limits map[string]*RateLimit) []*RateLimit {
+	sorted := make([]*RateLimit, 0, len(limits))
+	for _, limit := range limits {
+		sorted = append(sorted, limit)
+	}
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Name < sorted[j].Name })
+	return sorted
+}
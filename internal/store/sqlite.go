@@ -2,22 +2,137 @@ package store
 
 import (
 	"database/sql"
+	"errors"
+	"fmt"
 	"os"
 	"path/filepath"
+	"sort"
+	"strings"
 	"time"
 
 	_ "modernc.org/sqlite"
 )
 
+// ErrLeaseLost is returned when a worker tries to renew a lease it no longer holds,
+// either because the lease expired and the job was reclaimed or the job moved on.
+var ErrLeaseLost = errors.New("job lease is no longer held by this owner")
+
+// ErrScheduleNotFound is returned when a named schedule does not exist.
+var ErrScheduleNotFound = errors.New("schedule not found")
+
+// ErrRateLimitNotFound is returned when a named rate limit does not exist.
+var ErrRateLimitNotFound = errors.New("rate limit not found")
+
+// ErrJobExists is returned when enqueueing a job with the ID of an existing job.
+var ErrJobExists = errors.New("a job with this ID already exists")
+
+// ErrJobNotCancellable is returned when cancelling a job that has already finished.
+var ErrJobNotCancellable = errors.New("job has already finished and cannot be cancelled")
+
+// ErrJobNotPending is returned by operations that only apply to pending jobs.
+var ErrJobNotPending = errors.New("job is not pending")
+
+// ErrWorkflowNotFound is returned when a workflow run does not exist.
+var ErrWorkflowNotFound = errors.New("workflow not found")
+
+// ErrJobActive is returned when rerunning a job that is still queued or running.
+var ErrJobActive = errors.New("job is pending or running")
+
+// ErrWorkerNotRegistered is returned when heartbeating a worker that is not in the
+// registry, for example because it stalled for long enough to be pruned.
+var ErrWorkerNotRegistered = errors.New("worker is not registered")
+
 // Store defines the interface for job persistence.
 type Store interface {
 	Init() error
-	Enqueue(job *Job) error
-	FindAndLockJob() (*Job, error)
-	UpdateJob(job *Job) error
+	// Enqueue stores a new job. If the job has an idempotency key and a job with the same key
+	// exists within its idempotency scope, nothing is stored and the result is a duplicate
+	// naming the existing job. A job whose ID is taken is an error, ErrJobExists.
+	Enqueue(job *Job) (EnqueueResult, error)
+	// FindAndLockJob claims the highest priority runnable job for opts.Owner, holding it
+	// for opts.Lease.
+	FindAndLockJob(opts ClaimOptions) (*Job, error)
+	// ClaimJobs claims up to n runnable jobs at once, in the order FindAndLockJob would
+	// claim them. All of them are leased to opts.Owner.
+	ClaimJobs(opts ClaimOptions, n int) ([]*Job, error)
+	// RenewLease extends the lease on a processing job held by owner. It reports whether
+	// cancellation of the job has been requested.
+	RenewLease(id, owner string, lease time.Duration) (cancelRequested bool, err error)
+	// ReclaimExpiredLeases returns processing jobs whose lease expired before cutoff to
+	// pending, or to dead when they have used up their retries.
+	ReclaimExpiredLeases(cutoff time.Time) (requeued int, dead int, err error)
+	// UpdateJob saves a job's state. A job with a pending cancellation request is saved as
+	// cancelled instead of being retried or moved to the DLQ. If lease is not empty, the job
+	// is only saved while it is processing under that lease, the owner it was claimed for,
+	// and ErrLeaseLost is returned once it is not: it has been reclaimed and may be running
+	// elsewhere.
+	UpdateJob(job *Job, lease string) error
+	// FinishJobs records a batch of attempts and saves their jobs, as RecordAttempt and
+	// UpdateJob would, in a single transaction. A job whose lease has been lost is left as
+	// it is, though its attempt is still recorded.
+	FinishJobs(results []*JobResult) error
+	// CancelJob cancels a pending or blocked job immediately and returns true. For a processing job it
+	// records a cancellation request for the owning worker and returns false.
+	CancelJob(id string) (cancelled bool, err error)
+	// SetPriority changes the priority of a pending job.
+	SetPriority(id string, priority int) error
+	// RecordAttempt stores the result of one execution of a job.
+	RecordAttempt(attempt *Attempt) error
+	// ListAttempts returns the recorded attempts for a job, oldest first.
+	ListAttempts(jobID string) ([]*Attempt, error)
+	// GetJob returns a job, including the IDs of the jobs it depends on.
 	GetJob(id string) (*Job, error)
-	ListJobsByState(state JobState) ([]*Job, error)
-	GetStatusSummary() (map[JobState]int, error)
+	// JobDependencies returns the IDs of the jobs id depends on and of the jobs that depend
+	// on it, sorted.
+	JobDependencies(id string) (dependsOn, dependents []string, err error)
+	// ListJobsByState and GetStatusSummary are restricted to queue unless it is empty.
+	// Both report pending jobs that are not yet due under StateScheduled.
+	ListJobsByState(state JobState, queue string) ([]*Job, error)
+	GetStatusSummary(queue string) (map[JobState]int, error)
+	// ListJobsByConcurrencyKey returns the processing jobs holding a concurrency key, then
+	// the pending jobs waiting for it, each by priority and then age.
+	ListJobsByConcurrencyKey(key string) ([]*Job, error)
+	// GetQueueStats returns job counts by state for every queue that has jobs.
+	GetQueueStats() ([]*QueueStats, error)
+
+	AddSchedule(sched *Schedule) error
+	GetSchedule(name string) (*Schedule, error)
+	ListSchedules() ([]*Schedule, error)
+	UpdateSchedule(sched *Schedule) error
+	RemoveSchedule(name string) error
+	// ListDueSchedules returns unpaused schedules whose next tick is at or before now.
+	ListDueSchedules(now time.Time) ([]*Schedule, error)
+	// AdvanceSchedule moves a schedule's next tick from expected to next and enqueues jobs,
+	// atomically. It returns false without enqueuing anything if the schedule's next tick is
+	// no longer expected, i.e. another manager has already fired it.
+	AdvanceSchedule(name string, expected, next time.Time, jobs []*Job) (bool, error)
+
+	// SetRateLimit adds or replaces the rate limit named limit.Name. Its bucket starts full.
+	SetRateLimit(limit *RateLimit) error
+	RemoveRateLimit(name string) error
+	// ListRateLimits returns the rate limits sorted by name, with Ready filled in. Their
+	// tokens are as last stored; Available gives the tokens now.
+	ListRateLimits() ([]*RateLimit, error)
+
+	// CreateWorkflow stores a workflow run and enqueues the jobs of its steps, atomically.
+	// The jobs are enqueued in order, so each must come after the jobs it depends on.
+	CreateWorkflow(wf *Workflow, jobs []*Job) error
+	GetWorkflow(id string) (*Workflow, error)
+	// RerunJobs puts finished or blocked jobs back in the queue with fresh attempts,
+	// atomically. Each starts in the state Enqueue would give it, so ids must list the jobs
+	// depended on before the jobs that depend on them. It returns ErrJobActive without
+	// changing anything if one of them is pending or running.
+	RerunJobs(ids []string) error
+
+	// RegisterWorker adds a worker to the registry, replacing any entry with the same ID.
+	RegisterWorker(w *WorkerRecord) error
+	// HeartbeatWorker records that a worker is alive and the job it is running, if any.
+	HeartbeatWorker(id, currentJob string, at time.Time) error
+	UnregisterWorker(id string) error
+	// ListWorkers returns the registered workers last seen at or after since.
+	ListWorkers(since time.Time) ([]*WorkerRecord, error)
+	// PruneWorkers removes workers last seen before cutoff from the registry.
+	PruneWorkers(cutoff time.Time) (int, error)
 	Close() error
 }
 
@@ -25,52 +140,244 @@ type SQLiteStore struct {
 	db *sql.DB
 }
 
+// NewSQLiteStore opens the database at dbPath, creating it if needed, and migrates it to
+// the latest schema.
 func NewSQLiteStore(dbPath string) (*SQLiteStore, error) {
-	if err := os.MkdirAll(filepath.Dir(dbPath), 0755); err != nil {
+	store, err := openSQLiteStore(dbPath)
+	if err != nil {
 		return nil, err
 	}
+	if err := store.Init(); err != nil {
+		store.Close()
+		return nil, err
+	}
+	return store, nil
+}
 
-	db, err := sql.Open("sqlite", dbPath+"?_journal_mode=WAL")
-	if err != nil {
+// openSQLiteStore opens the database at dbPath without touching its schema.
+func openSQLiteStore(dbPath string) (*SQLiteStore, error) {
+	if err := os.MkdirAll(filepath.Dir(dbPath), 0755); err != nil {
 		return nil, err
 	}
 
-	store := &SQLiteStore{db: db}
-	if err := store.Init(); err != nil {
+	// Transactions begin IMMEDIATE so a claim takes the write lock up front, and
+	// busy_timeout makes concurrent writers wait for it instead of failing.
+	db, err := sql.Open("sqlite", dbPath+"?_pragma=journal_mode(WAL)&_pragma=busy_timeout(5000)&_txlock=immediate")
+	if err != nil {
 		return nil, err
 	}
 
-	return store, nil
+	return &SQLiteStore{db: db}, nil
 }
 
 func (s *SQLiteStore) Init() error {
-	query := `
-    CREATE TABLE IF NOT EXISTS jobs (
-        id TEXT PRIMARY KEY,
-        command TEXT NOT NULL,
-        state TEXT NOT NULL,
-        attempts INTEGER NOT NULL,
-        max_retries INTEGER NOT NULL,
-        created_at DATETIME NOT NULL,
-        updated_at DATETIME NOT NULL,
-        next_run_at DATETIME NOT NULL
-    );
-    CREATE INDEX IF NOT EXISTS idx_jobs_state_next_run ON jobs(state, next_run_at);
-    `
-	_, err := s.db.Exec(query)
+	_, err := s.migrator().Migrate()
 	return err
 }
 
-func (s *SQLiteStore) Enqueue(job *Job) error {
-	query := `INSERT INTO jobs (id, command, state, attempts, max_retries, created_at, updated_at, next_run_at)
-              VALUES (?, ?, ?, ?, ?, ?, ?, ?)`
-	_, err := s.db.Exec(query, job.ID, job.Command, job.State, job.Attempts, job.MaxRetries, job.CreatedAt, job.UpdatedAt, job.NextRunAt)
-	return err
+// jobColumns is the column list shared by every query that loads a full Job.
+const jobColumns = `id, command, state, attempts, max_retries, created_at, updated_at, next_run_at, lease_owner, lease_expires_at, queue, priority, timeout,
+    backoff, backoff_base, max_backoff, jitter, retry_on_exit_codes, fail_fast_exit_codes, on_dependency_failure, env,
+    idempotency_key, idempotency_scope, idempotency_ttl, concurrency_key, concurrency_limit, rate_key, reruns`
+
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanJob(row rowScanner) (*Job, error) {
+	job := &Job{}
+	var leaseExpiresAt sql.NullTime
+	err := row.Scan(&job.ID, &job.Command, &job.State, &job.Attempts, &job.MaxRetries, &job.CreatedAt, &job.UpdatedAt, &job.NextRunAt,
+		&job.LeaseOwner, &leaseExpiresAt, &job.Queue, &job.Priority, &job.Timeout,
+		&job.Backoff, &job.BackoffBase, &job.MaxBackoff, &job.Jitter, &job.RetryOnExitCodes, &job.FailFastExitCodes,
+		&job.OnDependencyFailure, &job.Env, &job.IdempotencyKey, &job.IdempotencyScope, &job.IdempotencyTTL,
+		&job.ConcurrencyKey, &job.ConcurrencyLimit, &job.RateKey, &job.Reruns)
+	if err != nil {
+		return nil, err
+	}
+	if leaseExpiresAt.Valid {
+		job.LeaseExpiresAt = leaseExpiresAt.Time
+	}
+	return job, nil
+}
+
+// nullTime maps the zero time to SQL NULL.
+func nullTime(t time.Time) sql.NullTime {
+	return sql.NullTime{Time: t, Valid: !t.IsZero()}
+}
+
+// execer, queryRower and querier are satisfied by both *sql.DB and *sql.Tx.
+type execer interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+}
+
+type queryRower interface {
+	QueryRow(query string, args ...interface{}) *sql.Row
+}
+
+type querier interface {
+	Query(query string, args ...interface{}) (*sql.Rows, error)
+}
+
+// Enqueue stores a new job. A job with dependencies that have not all completed is stored
+// as blocked, or as cancelled if one of them will never complete and the job does not wait.
+func (s *SQLiteStore) Enqueue(job *Job) (EnqueueResult, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return EnqueueResult{}, err
+	}
+	defer tx.Rollback()
+
+	duplicateOf, err := insertJob(tx, job)
+	if err != nil || duplicateOf != "" {
+		return EnqueueResult{JobID: duplicateOf, Duplicate: duplicateOf != ""}, err
+	}
+	return EnqueueResult{JobID: job.ID}, tx.Commit()
+}
+
+// insertJob stores job unless it duplicates an existing job by its idempotency key, in
+// which case it returns the ID of that job instead.
+func insertJob(tx *sql.Tx, job *Job) (string, error) {
+	if job.Queue == "" {
+		job.Queue = DefaultQueue
+	}
+	duplicateOf, err := findDuplicate(tx, job)
+	if err != nil || duplicateOf != "" {
+		return duplicateOf, err
+	}
+	var exists bool
+	if err := tx.QueryRow(`SELECT COUNT(*) > 0 FROM jobs WHERE id = ?`, job.ID).Scan(&exists); err != nil {
+		return "", err
+	}
+	if exists {
+		return "", fmt.Errorf("%w: %s", ErrJobExists, job.ID)
+	}
+	if len(job.DependsOn) > 0 {
+		states, err := dependencyStates(tx, job.DependsOn)
+		if err != nil {
+			return "", err
+		}
+		job.State = stateAfterDependencies(job.State, job.OnDependencyFailure, states)
+	}
+
+	query := `INSERT INTO jobs (id, command, state, attempts, max_retries, created_at, updated_at, next_run_at, queue, priority, timeout,
+                  backoff, backoff_base, max_backoff, jitter, retry_on_exit_codes, fail_fast_exit_codes, on_dependency_failure, env,
+                  idempotency_key, idempotency_scope, idempotency_ttl, concurrency_key, concurrency_limit, rate_key, reruns)
+              VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
+	_, err = tx.Exec(query, job.ID, job.Command, job.State, job.Attempts, job.MaxRetries, job.CreatedAt, job.UpdatedAt, job.NextRunAt,
+		job.Queue, job.Priority, job.Timeout, job.Backoff, job.BackoffBase, job.MaxBackoff, job.Jitter,
+		job.RetryOnExitCodes, job.FailFastExitCodes, job.OnDependencyFailure, job.Env,
+		job.IdempotencyKey, job.IdempotencyScope, job.IdempotencyTTL, job.ConcurrencyKey, job.ConcurrencyLimit, job.RateKey, job.Reruns)
+	if err != nil {
+		return "", err
+	}
+
+	for _, dep := range job.DependsOn {
+		if _, err := tx.Exec(`INSERT INTO job_dependencies (job_id, depends_on) VALUES (?, ?)`, job.ID, dep); err != nil {
+			return "", err
+		}
+	}
+	return "", nil
+}
+
+// findDuplicate returns the ID of the oldest job that job duplicates under its idempotency
+// key and scope, or "" if there is none.
+func findDuplicate(tx *sql.Tx, job *Job) (string, error) {
+	if job.IdempotencyKey == "" {
+		return "", nil
+	}
+	where := `idempotency_key = ?`
+	args := []interface{}{job.IdempotencyKey}
+	states, since := duplicateStates(job, time.Now().UTC())
+	if len(states) > 0 {
+		where += ` AND state IN (?` + strings.Repeat(`, ?`, len(states)-1) + `)`
+		for _, state := range states {
+			args = append(args, state)
+		}
+	}
+	if !since.IsZero() {
+		where += ` AND created_at >= ?`
+		args = append(args, since)
+	}
+
+	var id string
+	err := tx.QueryRow(`SELECT id FROM jobs WHERE `+where+` ORDER BY created_at ASC LIMIT 1`, args...).Scan(&id)
+	if err == sql.ErrNoRows {
+		return "", nil
+	}
+	return id, err
+}
+
+// dependencyStates returns the states of the jobs in deps.
+func dependencyStates(tx *sql.Tx, deps []string) ([]JobState, error) {
+	states := make([]JobState, len(deps))
+	for i, dep := range deps {
+		err := tx.QueryRow(`SELECT state FROM jobs WHERE id = ?`, dep).Scan(&states[i])
+		if err == sql.ErrNoRows {
+			return nil, fmt.Errorf("%w: %s", ErrDependencyNotFound, dep)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	return states, nil
+}
+
+// settleDependents updates the blocked jobs that depend on id now that it has reached
+// state. Once id completes, those whose dependencies have all completed become pending.
+// If id died or was cancelled, those that do not wait are cancelled, and so on down the
+// graph.
+func settleDependents(tx *sql.Tx, id string, state JobState) error {
+	now := time.Now().UTC()
+	switch state {
+	case StateCompleted:
+		_, err := tx.Exec(`UPDATE jobs SET state = ?, updated_at = ?
+                           WHERE state = ? AND id IN (SELECT job_id FROM job_dependencies WHERE depends_on = ?)
+                             AND NOT EXISTS (SELECT 1 FROM job_dependencies d JOIN jobs dep ON dep.id = d.depends_on
+                                             WHERE d.job_id = jobs.id AND dep.state != ?)`,
+			StatePending, now, StateBlocked, id, StateCompleted)
+		return err
+	case StateDead, StateCancelled:
+		failed := []string{id}
+		for len(failed) > 0 {
+			cancelled, err := queryIDs(tx, `UPDATE jobs SET state = ?, updated_at = ?
+                                              WHERE state = ? AND on_dependency_failure != ?
+                                                AND id IN (SELECT job_id FROM job_dependencies WHERE depends_on = ?)
+                                              RETURNING id`,
+				StateCancelled, now, StateBlocked, DependencyWait, failed[0])
+			if err != nil {
+				return err
+			}
+			failed = append(failed[1:], cancelled...)
+		}
+	}
+	return nil
+}
+
+// queryIDs runs a query selecting a single column of job IDs, such as an
+// UPDATE ... RETURNING id, and returns them.
+func queryIDs(q querier, query string, args ...interface{}) ([]string, error) {
+	rows, err := q.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ids []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
 }
 
 // FindAndLockJob finds a pending job, locks it by changing its state to 'processing', and returns it.
+// The job is leased to opts.Owner until now+opts.Lease; the owner must renew it to keep the job.
 // This is the critical section for concurrency.
-func (s *SQLiteStore) FindAndLockJob() (*Job, error) {
+func (s *SQLiteStore) FindAndLockJob(opts ClaimOptions) (*Job, error) {
 	tx, err := s.db.Begin()
 	if err != nil {
 		return nil, err
@@ -79,17 +386,21 @@ func (s *SQLiteStore) FindAndLockJob() (*Job, error) {
 
 	// Find a pending job that is ready to run.
 	// The "FOR UPDATE" clause is implicit in SQLite's transaction model.
-	// We select the oldest, ready-to-run job.
-	query := `SELECT id, command, state, attempts, max_retries, created_at, updated_at, next_run_at
+	// We select the highest priority ready-to-run job, oldest first among equals.
+	now := time.Now().UTC()
+	limits, err := queryRateLimits(tx, `SELECT `+rateLimitColumns+` FROM rate_limits`)
+	if err != nil {
+		return nil, err
+	}
+	where, args, orderBy, orderArgs := claimCriteria(opts, now, throttledNames(limits, now))
+	args = append(args, orderArgs...)
+	query := `SELECT ` + jobColumns + `
               FROM jobs
-              WHERE state = ? AND next_run_at <= ?
-              ORDER BY created_at ASC
+              WHERE ` + where + `
+              ORDER BY ` + orderBy + `
               LIMIT 1`
 
-	row := tx.QueryRow(query, StatePending, time.Now().UTC())
-
-	job := &Job{}
-	err = row.Scan(&job.ID, &job.Command, &job.State, &job.Attempts, &job.MaxRetries, &job.CreatedAt, &job.UpdatedAt, &job.NextRunAt)
+	job, err := scanJob(tx.QueryRow(query, args...))
 	if err != nil {
 		if err == sql.ErrNoRows {
 			return nil, nil // No job available
@@ -99,40 +410,441 @@ func (s *SQLiteStore) FindAndLockJob() (*Job, error) {
 
 	// Lock the job by updating its state
 	job.State = StateProcessing
-	job.UpdatedAt = time.Now().UTC()
+	job.UpdatedAt = now
 	job.Attempts++
+	job.LeaseOwner = opts.Owner
+	job.LeaseExpiresAt = now.Add(opts.Lease)
 
-	updateQuery := `UPDATE jobs SET state = ?, updated_at = ?, attempts = ? WHERE id = ?`
-	_, err = tx.Exec(updateQuery, job.State, job.UpdatedAt, job.Attempts, job.ID)
+	// The transaction holds the write lock, but the claim still only succeeds if the job is
+	// pending, so no two managers sharing the database can ever hold the same job.
+	updateQuery := `UPDATE jobs SET state = ?, updated_at = ?, attempts = ?, lease_owner = ?, lease_expires_at = ?
+                    WHERE id = ? AND state = ?`
+	res, err := tx.Exec(updateQuery, job.State, job.UpdatedAt, job.Attempts, job.LeaseOwner, job.LeaseExpiresAt, job.ID, StatePending)
+	if err != nil {
+		return nil, err
+	}
+	n, err := res.RowsAffected()
 	if err != nil {
 		return nil, err
 	}
+	if n == 0 {
+		return nil, nil // Claimed by someone else
+	}
+	if limit, ok := limits[jobRateKey(job)]; ok {
+		limit.take(now)
+		if err := saveTokens(tx, []*RateLimit{limit}); err != nil {
+			return nil, err
+		}
+	}
 
 	return job, tx.Commit()
 }
 
-func (s *SQLiteStore) UpdateJob(job *Job) error {
-	job.UpdatedAt = time.Now().UTC()
-	query := `UPDATE jobs SET state = ?, attempts = ?, updated_at = ?, next_run_at = ? WHERE id = ?`
-	_, err := s.db.Exec(query, job.State, job.Attempts, job.UpdatedAt, job.NextRunAt, job.ID)
+// claimCriteria returns the WHERE and ORDER BY clauses selecting the jobs opts may claim,
+// best first, with the arguments of each. Jobs under the rate limits named in throttled are
+// left out. The arguments are kept apart so that callers can add to the WHERE clause.
+func claimCriteria(opts ClaimOptions, now time.Time, throttled []string) (where string, whereArgs []interface{}, orderBy string, orderArgs []interface{}) {
+	where = `state = ? AND next_run_at <= ?`
+	whereArgs = []interface{}{StatePending, now}
+	if opts.Queue != "" {
+		where += ` AND queue = ?`
+		whereArgs = append(whereArgs, opts.Queue)
+	}
+	// Pass over jobs whose concurrency key is at its limit.
+	where += ` AND (concurrency_key = '' OR (` + heldQuery + `) < concurrency_limit)`
+	whereArgs = append(whereArgs, StateProcessing)
+	if len(throttled) > 0 {
+		where += ` AND ` + rateKeyColumn + ` NOT IN (?` + strings.Repeat(`, ?`, len(throttled)-1) + `)`
+		for _, name := range throttled {
+			whereArgs = append(whereArgs, name)
+		}
+	}
+	orderBy = `priority DESC, created_at ASC`
+	if opts.PriorityAging > 0 {
+		// Effective priority grows by one per PriorityAging waited. Timestamps are stored
+		// in UTC, so their first 19 characters are a datetime julianday understands.
+		orderBy = `priority + (julianday(?) - julianday(substr(created_at, 1, 19))) * 86400.0 / ? DESC, created_at ASC`
+		orderArgs = []interface{}{now.Format("2006-01-02 15:04:05"), opts.PriorityAging.Seconds()}
+	}
+	return where, whereArgs, orderBy, orderArgs
+}
+
+// heldQuery counts the processing jobs sharing the concurrency key of the row of jobs being
+// looked at. Its argument is StateProcessing.
+const heldQuery = `SELECT COUNT(*) FROM jobs AS holder WHERE holder.concurrency_key = jobs.concurrency_key AND holder.state = ?`
+
+// ClaimJobs selects the jobs to claim, a page at a time until the batch is full (see
+// admission), and claims them with one UPDATE ... RETURNING. The transaction begins
+// IMMEDIATE, so the batch is selected and claimed under the write lock.
+func (s *SQLiteStore) ClaimJobs(opts ClaimOptions, n int) ([]*Job, error) {
+	if n <= 0 {
+		return nil, nil
+	}
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	now := time.Now().UTC()
+	limits, err := queryRateLimits(tx, `SELECT `+rateLimitColumns+` FROM rate_limits`)
+	if err != nil {
+		return nil, err
+	}
+	adm := newAdmission(n, limits, now)
+	for !adm.done() {
+		where, whereArgs, orderBy, orderArgs := claimCriteria(opts, now, adm.throttled())
+		if keys := adm.fullKeys(); len(keys) > 0 {
+			where += ` AND concurrency_key NOT IN (?` + strings.Repeat(`, ?`, len(keys)-1) + `)`
+			for _, key := range keys {
+				whereArgs = append(whereArgs, key)
+			}
+		}
+		if len(adm.ids) > 0 {
+			where += ` AND id NOT IN (?` + strings.Repeat(`, ?`, len(adm.ids)-1) + `)`
+			for _, id := range adm.ids {
+				whereArgs = append(whereArgs, id)
+			}
+		}
+		query := `SELECT id, concurrency_key, concurrency_limit, (` + heldQuery + `), ` + rateKeyColumn + `
+                  FROM jobs WHERE ` + where + ` ORDER BY ` + orderBy + ` LIMIT ?`
+		args := []interface{}{StateProcessing}
+		args = append(args, whereArgs...)
+		args = append(args, orderArgs...)
+		page := adm.remaining()
+		args = append(args, page)
+		candidates, err := claimCandidates(tx, query, args...)
+		if err != nil {
+			return nil, err
+		}
+		adm.admit(candidates)
+		if len(candidates) < page {
+			break
+		}
+	}
+	ids := adm.ids
+	if len(ids) == 0 {
+		return nil, nil
+	}
+	if err := saveTokens(tx, adm.used); err != nil {
+		return nil, err
+	}
+
+	query := `UPDATE jobs SET state = ?, updated_at = ?, attempts = attempts + 1, lease_owner = ?, lease_expires_at = ?
+              WHERE id IN (?` + strings.Repeat(`, ?`, len(ids)-1) + `)
+              RETURNING ` + jobColumns
+	args := []interface{}{StateProcessing, now, opts.Owner, now.Add(opts.Lease)}
+	for _, id := range ids {
+		args = append(args, id)
+	}
+
+	rows, err := tx.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var jobs []*Job
+	for rows.Next() {
+		job, err := scanJob(rows)
+		if err != nil {
+			return nil, err
+		}
+		jobs = append(jobs, job)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	// RETURNING gives no guarantee of order, so restore the claim order.
+	sort.SliceStable(jobs, func(i, j int) bool {
+		pi, pj := effectivePriority(jobs[i], opts, now), effectivePriority(jobs[j], opts, now)
+		if pi != pj {
+			return pi > pj
+		}
+		return jobs[i].CreatedAt.Before(jobs[j].CreatedAt)
+	})
+	return jobs, nil
+}
+
+// claimCandidates runs a query returning the ID, concurrency key and limit of jobs that
+// may be claimed, the number of processing jobs holding that key and the job's rate key.
+func claimCandidates(q querier, query string, args ...interface{}) ([]claimCandidate, error) {
+	rows, err := q.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var candidates []claimCandidate
+	for rows.Next() {
+		var c claimCandidate
+		if err := rows.Scan(&c.id, &c.key, &c.limit, &c.held, &c.rateKey); err != nil {
+			return nil, err
+		}
+		candidates = append(candidates, c)
+	}
+	return candidates, rows.Err()
+}
+
+// effectivePriority mirrors the ORDER BY of claimCriteria.
+func effectivePriority(job *Job, opts ClaimOptions, now time.Time) float64 {
+	p := float64(job.Priority)
+	if opts.PriorityAging > 0 {
+		p += now.Sub(job.CreatedAt).Seconds() / opts.PriorityAging.Seconds()
+	}
+	return p
+}
+
+func (s *SQLiteStore) RenewLease(id, owner string, lease time.Duration) (bool, error) {
+	now := time.Now().UTC()
+	query := `UPDATE jobs SET lease_expires_at = ?, updated_at = ? WHERE id = ? AND state = ? AND lease_owner = ?
+              RETURNING cancel_requested`
+	var cancelRequested bool
+	err := s.db.QueryRow(query, now.Add(lease), now, id, StateProcessing, owner).Scan(&cancelRequested)
+	if err == sql.ErrNoRows {
+		return false, ErrLeaseLost
+	}
+	return cancelRequested, err
+}
+
+func (s *SQLiteStore) CancelJob(id string) (bool, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	var state JobState
+	if err := tx.QueryRow(`SELECT state FROM jobs WHERE id = ?`, id).Scan(&state); err != nil {
+		return false, err
+	}
+
+	now := time.Now().UTC()
+	cancelled := false
+	switch state {
+	case StatePending, StateBlocked:
+		_, err = tx.Exec(`UPDATE jobs SET state = ?, updated_at = ? WHERE id = ?`, StateCancelled, now, id)
+		if err == nil {
+			err = settleDependents(tx, id, StateCancelled)
+		}
+		cancelled = true
+	case StateProcessing:
+		_, err = tx.Exec(`UPDATE jobs SET cancel_requested = 1, updated_at = ? WHERE id = ?`, now, id)
+	default:
+		return false, ErrJobNotCancellable
+	}
+	if err != nil {
+		return false, err
+	}
+	return cancelled, tx.Commit()
+}
+
+// ReclaimExpiredLeases recovers jobs orphaned in the processing state, e.g. after the
+// manager process was killed. The attempt that was running is counted, so a job that
+// has no retries left goes to the DLQ instead of back to pending.
+func (s *SQLiteStore) ReclaimExpiredLeases(cutoff time.Time) (int, int, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return 0, 0, err
+	}
+	defer tx.Rollback()
+
+	now := time.Now().UTC()
+	// Jobs claimed before leases existed have no expiry and are always considered expired.
+	expired := `state = ? AND (lease_expires_at IS NULL OR lease_expires_at <= ?)`
+
+	// Jobs whose cancellation was requested are not retried.
+	cancelled, err := queryIDs(tx, `UPDATE jobs SET state = ?, lease_owner = '', lease_expires_at = NULL, updated_at = ?
+                                      WHERE `+expired+` AND cancel_requested = 1
+                                      RETURNING id`,
+		StateCancelled, now, StateProcessing, cutoff.UTC())
+	if err != nil {
+		return 0, 0, err
+	}
+	for _, id := range cancelled {
+		if err := settleDependents(tx, id, StateCancelled); err != nil {
+			return 0, 0, err
+		}
+	}
+
+	dead, err := queryIDs(tx, `UPDATE jobs SET state = ?, lease_owner = '', lease_expires_at = NULL, updated_at = ?
+                                 WHERE `+expired+` AND attempts >= max_retries
+                                 RETURNING id`,
+		StateDead, now, StateProcessing, cutoff.UTC())
+	if err != nil {
+		return 0, 0, err
+	}
+	for _, id := range dead {
+		if err := settleDependents(tx, id, StateDead); err != nil {
+			return 0, 0, err
+		}
+	}
+
+	res, err := tx.Exec(`UPDATE jobs SET state = ?, lease_owner = '', lease_expires_at = NULL, updated_at = ?, next_run_at = ?
+                        WHERE `+expired,
+		StatePending, now, now, StateProcessing, cutoff.UTC())
+	if err != nil {
+		return 0, 0, err
+	}
+	requeued, err := res.RowsAffected()
+	if err != nil {
+		return 0, 0, err
+	}
+
+	return int(requeued), len(dead), tx.Commit()
+}
+
+func (s *SQLiteStore) UpdateJob(job *Job, lease string) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := updateJob(tx, job, lease); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func updateJob(tx *sql.Tx, job *Job, lease string) error {
+	updatedAt := time.Now().UTC()
+	query := `UPDATE jobs SET state = CASE WHEN cancel_requested = 1 AND ? IN (?, ?) THEN ? ELSE ? END,
+              attempts = ?, reruns = ?, updated_at = ?, next_run_at = ?, lease_owner = ?, lease_expires_at = ?, cancel_requested = 0
+              WHERE id = ?`
+	args := []interface{}{job.State, StatePending, StateDead, StateCancelled, job.State,
+		job.Attempts, job.Reruns, updatedAt, job.NextRunAt, job.LeaseOwner, nullTime(job.LeaseExpiresAt), job.ID}
+	if lease != "" {
+		query += ` AND state = ? AND lease_owner = ?`
+		args = append(args, StateProcessing, lease)
+	}
+	var state JobState
+	err := tx.QueryRow(query+` RETURNING state`, args...).Scan(&state)
+	if err == sql.ErrNoRows && lease != "" {
+		return ErrLeaseLost
+	}
+	if err != nil {
+		return err
+	}
+	job.State, job.UpdatedAt = state, updatedAt
+	return settleDependents(tx, job.ID, job.State)
+}
+
+func (s *SQLiteStore) SetPriority(id string, priority int) error {
+	query := `UPDATE jobs SET priority = ?, updated_at = ? WHERE id = ? AND state = ?`
+	res, err := s.db.Exec(query, priority, time.Now().UTC(), id, StatePending)
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		// Distinguish a missing job from one that is no longer pending.
+		if _, err := s.GetJob(id); err != nil {
+			return err
+		}
+		return ErrJobNotPending
+	}
+	return nil
+}
+
+func (s *SQLiteStore) RecordAttempt(a *Attempt) error {
+	return recordAttempt(s.db, a)
+}
+
+func (s *SQLiteStore) FinishJobs(results []*JobResult) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, r := range results {
+		if r.Attempt != nil {
+			if err := recordAttempt(tx, r.Attempt); err != nil {
+				return fmt.Errorf("recording attempt %d of job %s: %w", r.Attempt.Attempt, r.Job.ID, err)
+			}
+		}
+		if err := updateJob(tx, r.Job, r.Lease); err != nil && err != ErrLeaseLost {
+			return fmt.Errorf("updating job %s: %w", r.Job.ID, err)
+		}
+	}
+	return tx.Commit()
+}
+
+func recordAttempt(e execer, a *Attempt) error {
+	query := `INSERT INTO job_attempts (job_id, rerun, attempt, worker, started_at, finished_at, exit_code, signal, stdout, stderr, error, reason, classification)
+              VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
+	_, err := e.Exec(query, a.JobID, a.Rerun, a.Attempt, a.Worker, a.StartedAt, a.FinishedAt, a.ExitCode, a.Signal, a.Stdout, a.Stderr, a.Error,
+		a.Reason, a.Classification)
 	return err
 }
 
-func (s *SQLiteStore) GetJob(id string) (*Job, error) {
-	query := `SELECT id, command, state, attempts, max_retries, created_at, updated_at, next_run_at FROM jobs WHERE id = ?`
-	row := s.db.QueryRow(query, id)
+func (s *SQLiteStore) ListAttempts(jobID string) ([]*Attempt, error) {
+	query := `SELECT job_id, rerun, attempt, worker, started_at, finished_at, exit_code, signal, stdout, stderr, error, reason, classification
+              FROM job_attempts WHERE job_id = ? ORDER BY rerun ASC, attempt ASC`
+	rows, err := s.db.Query(query, jobID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
 
-	job := &Job{}
-	err := row.Scan(&job.ID, &job.Command, &job.State, &job.Attempts, &job.MaxRetries, &job.CreatedAt, &job.UpdatedAt, &job.NextRunAt)
+	var attempts []*Attempt
+	for rows.Next() {
+		a := &Attempt{}
+		err := rows.Scan(&a.JobID, &a.Rerun, &a.Attempt, &a.Worker, &a.StartedAt, &a.FinishedAt, &a.ExitCode, &a.Signal, &a.Stdout, &a.Stderr, &a.Error, &a.Reason, &a.Classification)
+		if err != nil {
+			return nil, err
+		}
+		attempts = append(attempts, a)
+	}
+	return attempts, rows.Err()
+}
+
+func (s *SQLiteStore) GetJob(id string) (*Job, error) {
+	query := `SELECT ` + jobColumns + ` FROM jobs WHERE id = ?`
+	job, err := scanJob(s.db.QueryRow(query, id))
 	if err != nil {
 		return nil, err
 	}
-	return job, nil
+	job.DependsOn, err = queryIDs(s.db, `SELECT depends_on FROM job_dependencies WHERE job_id = ? ORDER BY depends_on`, id)
+	return job, err
 }
 
-func (s *SQLiteStore) ListJobsByState(state JobState) ([]*Job, error) {
-	query := `SELECT id, command, state, attempts, max_retries, created_at, updated_at FROM jobs WHERE state = ? ORDER BY created_at ASC`
-	rows, err := s.db.Query(query, state)
+func (s *SQLiteStore) JobDependencies(id string) ([]string, []string, error) {
+	dependsOn, err := queryIDs(s.db, `SELECT depends_on FROM job_dependencies WHERE job_id = ? ORDER BY depends_on`, id)
+	if err != nil {
+		return nil, nil, err
+	}
+	dependents, err := queryIDs(s.db, `SELECT job_id FROM job_dependencies WHERE depends_on = ? ORDER BY job_id`, id)
+	return dependsOn, dependents, err
+}
+
+func (s *SQLiteStore) ListJobsByState(state JobState, queue string) ([]*Job, error) {
+	where := `state = ?`
+	args := []interface{}{state}
+	orderBy := `created_at ASC`
+	switch state {
+	case StatePending:
+		where += ` AND next_run_at <= ?`
+		args = append(args, time.Now().UTC())
+	case StateScheduled:
+		where = `state = ? AND next_run_at > ?`
+		args = []interface{}{StatePending, time.Now().UTC()}
+		orderBy = `next_run_at ASC`
+	}
+	if queue != "" {
+		where += ` AND queue = ?`
+		args = append(args, queue)
+	}
+	query := `SELECT ` + jobColumns + ` FROM jobs WHERE ` + where + ` ORDER BY ` + orderBy
+	rows, err := s.db.Query(query, args...)
 	if err != nil {
 		return nil, err
 	}
@@ -140,9 +852,7 @@ func (s *SQLiteStore) ListJobsByState(state JobState) ([]*Job, error) {
 
 	var jobs []*Job
 	for rows.Next() {
-		job := &Job{}
-		// Note: next_run_at is not scanned here as it's less relevant for listing
-		err := rows.Scan(&job.ID, &job.Command, &job.State, &job.Attempts, &job.MaxRetries, &job.CreatedAt, &job.UpdatedAt)
+		job, err := scanJob(rows)
 		if err != nil {
 			return nil, err
 		}
@@ -151,9 +861,36 @@ func (s *SQLiteStore) ListJobsByState(state JobState) ([]*Job, error) {
 	return jobs, nil
 }
 
-func (s *SQLiteStore) GetStatusSummary() (map[JobState]int, error) {
-	query := `SELECT state, COUNT(*) FROM jobs GROUP BY state`
-	rows, err := s.db.Query(query)
+func (s *SQLiteStore) ListJobsByConcurrencyKey(key string) ([]*Job, error) {
+	query := `SELECT ` + jobColumns + ` FROM jobs WHERE concurrency_key = ? AND state IN (?, ?)
+              ORDER BY CASE WHEN state = ? THEN 0 ELSE 1 END, priority DESC, created_at ASC`
+	rows, err := s.db.Query(query, key, StateProcessing, StatePending, StateProcessing)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var jobs []*Job
+	for rows.Next() {
+		job, err := scanJob(rows)
+		if err != nil {
+			return nil, err
+		}
+		jobs = append(jobs, job)
+	}
+	return jobs, rows.Err()
+}
+
+func (s *SQLiteStore) GetStatusSummary(queue string) (map[JobState]int, error) {
+	where := ``
+	args := []interface{}{StatePending, time.Now().UTC(), StateScheduled}
+	if queue != "" {
+		where = `WHERE queue = ?`
+		args = append(args, queue)
+	}
+	query := `SELECT CASE WHEN state = ? AND next_run_at > ? THEN ? ELSE state END AS view_state, COUNT(*)
+              FROM jobs ` + where + ` GROUP BY view_state`
+	rows, err := s.db.Query(query, args...)
 	if err != nil {
 		return nil, err
 	}
@@ -171,6 +908,46 @@ func (s *SQLiteStore) GetStatusSummary() (map[JobState]int, error) {
 	return summary, nil
 }
 
+// storedTimeLayout is the format the driver writes times in. Aggregates such as MIN lose
+// the column type, so their results come back as text and have to be parsed by hand.
+const storedTimeLayout = "2006-01-02 15:04:05.999999999 -0700 MST"
+
+func (s *SQLiteStore) GetQueueStats() ([]*QueueStats, error) {
+	now := time.Now().UTC()
+	query := `SELECT queue, CASE WHEN state = ? AND next_run_at > ? THEN ? ELSE state END AS view_state, COUNT(*),
+                     MIN(CASE WHEN state = ? AND next_run_at <= ? THEN created_at END)
+              FROM jobs GROUP BY queue, view_state ORDER BY queue`
+	rows, err := s.db.Query(query, StatePending, now, StateScheduled, StatePending, now)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var stats []*QueueStats
+	for rows.Next() {
+		var queue string
+		var state JobState
+		var count int
+		var oldest sql.NullString
+		if err := rows.Scan(&queue, &state, &count, &oldest); err != nil {
+			return nil, err
+		}
+		if len(stats) == 0 || stats[len(stats)-1].Queue != queue {
+			stats = append(stats, &QueueStats{Queue: queue, Counts: make(map[JobState]int)})
+		}
+		qs := stats[len(stats)-1]
+		qs.Counts[state] = count
+		if oldest.Valid {
+			t, err := time.Parse(storedTimeLayout, oldest.String)
+			if err != nil {
+				return nil, fmt.Errorf("invalid created_at %q: %w", oldest.String, err)
+			}
+			qs.OldestPending = t.UTC()
+		}
+	}
+	return stats, rows.Err()
+}
+
 func (s *SQLiteStore) Close() error {
 	return s.db.Close()
 }
@@ -0,0 +1,246 @@
+package store
+
+import (
+	"database/sql"
+	"fmt"
+)
+
+// sqliteMigrations is the schema history of the SQLite store. Append new migrations to the
+// end; never edit or reorder one that has shipped.
+var sqliteMigrations = []Migration{
+	{Version: 1, Name: "baseline", up: sqliteBaseline},
+	{Version: 2, Name: "job dependencies", up: execMigration(`
+    ALTER TABLE jobs ADD COLUMN on_dependency_failure TEXT NOT NULL DEFAULT '';
+    CREATE TABLE job_dependencies (
+        job_id TEXT NOT NULL,
+        depends_on TEXT NOT NULL,
+        PRIMARY KEY (job_id, depends_on)
+    );
+    CREATE INDEX idx_job_dependencies_depends_on ON job_dependencies(depends_on);
+    `)},
+	{Version: 3, Name: "workflows", up: execMigration(`
+    ALTER TABLE jobs ADD COLUMN env TEXT NOT NULL DEFAULT '';
+    CREATE TABLE workflows (
+        id TEXT PRIMARY KEY,
+        name TEXT NOT NULL,
+        steps TEXT NOT NULL,
+        created_at DATETIME NOT NULL
+    );
+    `)},
+	{Version: 4, Name: "idempotency keys", up: execMigration(`
+    ALTER TABLE jobs ADD COLUMN idempotency_key TEXT NOT NULL DEFAULT '';
+    ALTER TABLE jobs ADD COLUMN idempotency_scope TEXT NOT NULL DEFAULT '';
+    ALTER TABLE jobs ADD COLUMN idempotency_ttl INTEGER NOT NULL DEFAULT 0;
+    CREATE INDEX idx_jobs_idempotency_key ON jobs(idempotency_key, created_at) WHERE idempotency_key != '';
+    `)},
+	{Version: 5, Name: "concurrency keys", up: execMigration(`
+    ALTER TABLE jobs ADD COLUMN concurrency_key TEXT NOT NULL DEFAULT '';
+    ALTER TABLE jobs ADD COLUMN concurrency_limit INTEGER NOT NULL DEFAULT 0;
+    CREATE INDEX idx_jobs_concurrency_key ON jobs(concurrency_key, state);
+    `)},
+	{Version: 6, Name: "rate limits", up: execMigration(`
+    ALTER TABLE jobs ADD COLUMN rate_key TEXT NOT NULL DEFAULT '';
+    CREATE TABLE rate_limits (
+        name TEXT PRIMARY KEY,
+        rate INTEGER NOT NULL,
+        per INTEGER NOT NULL,
+        burst INTEGER NOT NULL,
+        tokens REAL NOT NULL,
+        updated_at DATETIME NOT NULL
+    );
+    `)},
+	// Attempt numbers start again when a job is rerun, so the rerun joins the key of the
+	// attempt history. SQLite cannot change a primary key in place; the table is rebuilt.
+	{Version: 7, Name: "attempt reruns", up: execMigration(`
+    ALTER TABLE jobs ADD COLUMN reruns INTEGER NOT NULL DEFAULT 0;
+    CREATE TABLE job_attempts_reruns (
+        job_id TEXT NOT NULL,
+        rerun INTEGER NOT NULL DEFAULT 0,
+        attempt INTEGER NOT NULL,
+        worker TEXT NOT NULL,
+        started_at DATETIME NOT NULL,
+        finished_at DATETIME NOT NULL,
+        exit_code INTEGER NOT NULL,
+        signal TEXT NOT NULL DEFAULT '',
+        stdout TEXT NOT NULL DEFAULT '',
+        stderr TEXT NOT NULL DEFAULT '',
+        error TEXT NOT NULL DEFAULT '',
+        reason TEXT NOT NULL DEFAULT '',
+        classification TEXT NOT NULL DEFAULT '',
+        PRIMARY KEY (job_id, rerun, attempt)
+    );
+    INSERT INTO job_attempts_reruns (job_id, attempt, worker, started_at, finished_at, exit_code, signal, stdout, stderr, error, reason, classification)
+        SELECT job_id, attempt, worker, started_at, finished_at, exit_code, signal, stdout, stderr, error, reason, classification
+        FROM job_attempts;
+    DROP TABLE job_attempts;
+    ALTER TABLE job_attempts_reruns RENAME TO job_attempts;
+    `)},
+}
+
+func (s *SQLiteStore) migrator() *migrator {
+	return &migrator{
+		db:         s.db,
+		migrations: sqliteMigrations,
+		createTable: `CREATE TABLE IF NOT EXISTS schema_migrations (
+            version INTEGER PRIMARY KEY,
+            name TEXT NOT NULL,
+            applied_at DATETIME NOT NULL
+        )`,
+		tableExists: `SELECT COUNT(*) > 0 FROM sqlite_master WHERE type = 'table' AND name = 'schema_migrations'`,
+		insert:      `INSERT INTO schema_migrations (version, name, applied_at) VALUES (?, ?, ?)`,
+		// Transactions begin IMMEDIATE, so each migration already holds the write lock.
+	}
+}
+
+func (s *SQLiteStore) SchemaVersion() (int, int, error) {
+	return s.migrator().SchemaVersion()
+}
+
+func (s *SQLiteStore) PendingMigrations() ([]Migration, error) {
+	return s.migrator().PendingMigrations()
+}
+
+func (s *SQLiteStore) Migrate() ([]Migration, error) {
+	return s.migrator().Migrate()
+}
+
+type columnUpgrade struct {
+	name string
+	ddl  string
+}
+
+// jobColumnUpgrades lists columns added to the jobs table before schema versions existed.
+// The baseline migration adds any that are missing, so databases created by those older
+// versions are brought up to the same schema as new ones.
+var jobColumnUpgrades = []columnUpgrade{
+	{"lease_owner", "lease_owner TEXT NOT NULL DEFAULT ''"},
+	{"lease_expires_at", "lease_expires_at DATETIME"},
+	{"queue", "queue TEXT NOT NULL DEFAULT '" + DefaultQueue + "'"},
+	{"priority", "priority INTEGER NOT NULL DEFAULT 0"},
+	{"timeout", "timeout INTEGER NOT NULL DEFAULT 0"},
+	{"cancel_requested", "cancel_requested INTEGER NOT NULL DEFAULT 0"},
+	{"backoff", "backoff TEXT NOT NULL DEFAULT ''"},
+	{"backoff_base", "backoff_base REAL NOT NULL DEFAULT 0"},
+	{"max_backoff", "max_backoff INTEGER NOT NULL DEFAULT 0"},
+	{"jitter", "jitter REAL NOT NULL DEFAULT 0"},
+	{"retry_on_exit_codes", "retry_on_exit_codes TEXT NOT NULL DEFAULT ''"},
+	{"fail_fast_exit_codes", "fail_fast_exit_codes TEXT NOT NULL DEFAULT ''"},
+}
+
+// attemptColumnUpgrades does the same for the job_attempts table.
+var attemptColumnUpgrades = []columnUpgrade{
+	{"reason", "reason TEXT NOT NULL DEFAULT ''"},
+	{"classification", "classification TEXT NOT NULL DEFAULT ''"},
+}
+
+// sqliteBaseline creates the schema as it was when migrations were introduced. It works on
+// an empty database and on one from any earlier version.
+func sqliteBaseline(tx *sql.Tx) error {
+	query := `
+    CREATE TABLE IF NOT EXISTS jobs (
+        id TEXT PRIMARY KEY,
+        command TEXT NOT NULL,
+        state TEXT NOT NULL,
+        attempts INTEGER NOT NULL,
+        max_retries INTEGER NOT NULL,
+        created_at DATETIME NOT NULL,
+        updated_at DATETIME NOT NULL,
+        next_run_at DATETIME NOT NULL
+    );
+    CREATE INDEX IF NOT EXISTS idx_jobs_state_next_run ON jobs(state, next_run_at);
+    `
+	if _, err := tx.Exec(query); err != nil {
+		return err
+	}
+
+	if err := addMissingColumns(tx, "jobs", jobColumnUpgrades); err != nil {
+		return err
+	}
+
+	query = `
+    CREATE INDEX IF NOT EXISTS idx_jobs_state_lease ON jobs(state, lease_expires_at);
+    CREATE INDEX IF NOT EXISTS idx_jobs_queue_state_next_run ON jobs(queue, state, next_run_at);
+    CREATE INDEX IF NOT EXISTS idx_jobs_state_priority ON jobs(state, priority DESC, created_at);
+    CREATE TABLE IF NOT EXISTS job_attempts (
+        job_id TEXT NOT NULL,
+        attempt INTEGER NOT NULL,
+        worker TEXT NOT NULL,
+        started_at DATETIME NOT NULL,
+        finished_at DATETIME NOT NULL,
+        exit_code INTEGER NOT NULL,
+        signal TEXT NOT NULL DEFAULT '',
+        stdout TEXT NOT NULL DEFAULT '',
+        stderr TEXT NOT NULL DEFAULT '',
+        error TEXT NOT NULL DEFAULT '',
+        PRIMARY KEY (job_id, attempt)
+    );
+    CREATE TABLE IF NOT EXISTS schedules (
+        name TEXT PRIMARY KEY,
+        cron_expr TEXT NOT NULL,
+        timezone TEXT NOT NULL,
+        template TEXT NOT NULL,
+        misfire_policy TEXT NOT NULL,
+        paused INTEGER NOT NULL DEFAULT 0,
+        next_run_at DATETIME NOT NULL,
+        last_run_at DATETIME,
+        created_at DATETIME NOT NULL
+    );
+    CREATE TABLE IF NOT EXISTS workers (
+        id TEXT PRIMARY KEY,
+        hostname TEXT NOT NULL,
+        manager_pid INTEGER NOT NULL,
+        queue TEXT NOT NULL DEFAULT '',
+        current_job TEXT NOT NULL DEFAULT '',
+        started_at DATETIME NOT NULL,
+        last_seen DATETIME NOT NULL
+    );
+    `
+	if _, err := tx.Exec(query); err != nil {
+		return err
+	}
+
+	return addMissingColumns(tx, "job_attempts", attemptColumnUpgrades)
+}
+
+// addMissingColumns adds the columns in upgrades that table does not have yet.
+func addMissingColumns(tx *sql.Tx, table string, upgrades []columnUpgrade) error {
+	existing, err := tableColumns(tx, table)
+	if err != nil {
+		return err
+	}
+	for _, col := range upgrades {
+		if existing[col.name] {
+			continue
+		}
+		if _, err := tx.Exec(fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s", table, col.ddl)); err != nil {
+			return fmt.Errorf("adding column %s.%s: %w", table, col.name, err)
+		}
+	}
+	return nil
+}
+
+// tableColumns returns the set of column names currently defined on table.
+func tableColumns(tx *sql.Tx, table string) (map[string]bool, error) {
+	rows, err := tx.Query(fmt.Sprintf("PRAGMA table_info(%s)", table))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	columns := make(map[string]bool)
+	for rows.Next() {
+		var (
+			cid       int
+			name      string
+			colType   string
+			notNull   int
+			dfltValue sql.NullString
+			pk        int
+		)
+		if err := rows.Scan(&cid, &name, &colType, &notNull, &dfltValue, &pk); err != nil {
+			return nil, err
+		}
+		columns[name] = true
+	}
+	return columns, rows.Err()
+}
@@ -0,0 +1,91 @@
+package store
+
+import (
+	"time"
+)
+
+const rateLimitColumns = `name, rate, per, burst, tokens, updated_at`
+
+func scanRateLimit(row rowScanner) (*RateLimit, error) {
+	limit := &RateLimit{}
+	err := row.Scan(&limit.Name, &limit.Rate, &limit.Per, &limit.Burst, &limit.Tokens, &limit.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return limit, nil
+}
+
+// queryRateLimits returns the rate limits selected by query, by name.
+func queryRateLimits(q querier, query string, args ...interface{}) (map[string]*RateLimit, error) {
+	rows, err := q.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	limits := make(map[string]*RateLimit)
+	for rows.Next() {
+		limit, err := scanRateLimit(rows)
+		if err != nil {
+			return nil, err
+		}
+		limits[limit.Name] = limit
+	}
+	return limits, rows.Err()
+}
+
+// saveTokens stores the buckets of limits after tokens were taken from them.
+func saveTokens(e execer, limits []*RateLimit) error {
+	for _, limit := range limits {
+		if _, err := e.Exec(`UPDATE rate_limits SET tokens = ?, updated_at = ? WHERE name = ?`, limit.Tokens, limit.UpdatedAt, limit.Name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *SQLiteStore) SetRateLimit(limit *RateLimit) error {
+	resetRateLimit(limit, time.Now().UTC())
+	query := `INSERT INTO rate_limits (` + rateLimitColumns + `) VALUES (?, ?, ?, ?, ?, ?)
+              ON CONFLICT (name) DO UPDATE SET rate = excluded.rate, per = excluded.per, burst = excluded.burst,
+                  tokens = excluded.tokens, updated_at = excluded.updated_at`
+	_, err := s.db.Exec(query, limit.Name, limit.Rate, limit.Per, limit.Burst, limit.Tokens, limit.UpdatedAt)
+	return err
+}
+
+func (s *SQLiteStore) RemoveRateLimit(name string) error {
+	res, err := s.db.Exec(`DELETE FROM rate_limits WHERE name = ?`, name)
+	if err != nil {
+		return err
+	}
+	return requireRow(res, ErrRateLimitNotFound)
+}
+
+func (s *SQLiteStore) ListRateLimits() ([]*RateLimit, error) {
+	limits, err := queryRateLimits(s.db, `SELECT `+rateLimitColumns+` FROM rate_limits`)
+	if err != nil || len(limits) == 0 {
+		return nil, err
+	}
+
+	query := `SELECT ` + rateKeyColumn + ` AS rate_key_name, COUNT(*) FROM jobs WHERE state = ? AND next_run_at <= ?
+              GROUP BY rate_key_name`
+	rows, err := s.db.Query(query, StatePending, time.Now().UTC())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var name string
+		var ready int
+		if err := rows.Scan(&name, &ready); err != nil {
+			return nil, err
+		}
+		if limit, ok := limits[name]; ok {
+			limit.Ready = ready
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return sortedRateLimits(limits), nil
+}
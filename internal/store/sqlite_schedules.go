@@ -0,0 +1,123 @@
+package store
+
+import (
+	"database/sql"
+	"time"
+)
+
+const scheduleColumns = `name, cron_expr, timezone, template, misfire_policy, paused, next_run_at, last_run_at, created_at`
+
+func scanSchedule(row rowScanner) (*Schedule, error) {
+	sched := &Schedule{}
+	var lastRunAt sql.NullTime
+	err := row.Scan(&sched.Name, &sched.CronExpr, &sched.Timezone, &sched.Template, &sched.MisfirePolicy, &sched.Paused,
+		&sched.NextRunAt, &lastRunAt, &sched.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	if lastRunAt.Valid {
+		sched.LastRunAt = lastRunAt.Time
+	}
+	return sched, nil
+}
+
+func (s *SQLiteStore) AddSchedule(sched *Schedule) error {
+	query := `INSERT INTO schedules (` + scheduleColumns + `) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`
+	_, err := s.db.Exec(query, sched.Name, sched.CronExpr, sched.Timezone, sched.Template, sched.MisfirePolicy, sched.Paused,
+		sched.NextRunAt, nullTime(sched.LastRunAt), sched.CreatedAt)
+	return err
+}
+
+func (s *SQLiteStore) GetSchedule(name string) (*Schedule, error) {
+	sched, err := scanSchedule(s.db.QueryRow(`SELECT `+scheduleColumns+` FROM schedules WHERE name = ?`, name))
+	if err == sql.ErrNoRows {
+		return nil, ErrScheduleNotFound
+	}
+	return sched, err
+}
+
+func (s *SQLiteStore) ListSchedules() ([]*Schedule, error) {
+	return s.querySchedules(`SELECT ` + scheduleColumns + ` FROM schedules ORDER BY name ASC`)
+}
+
+func (s *SQLiteStore) ListDueSchedules(now time.Time) ([]*Schedule, error) {
+	query := `SELECT ` + scheduleColumns + ` FROM schedules WHERE paused = 0 AND next_run_at <= ? ORDER BY next_run_at ASC`
+	return s.querySchedules(query, now.UTC())
+}
+
+func (s *SQLiteStore) querySchedules(query string, args ...interface{}) ([]*Schedule, error) {
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var schedules []*Schedule
+	for rows.Next() {
+		sched, err := scanSchedule(rows)
+		if err != nil {
+			return nil, err
+		}
+		schedules = append(schedules, sched)
+	}
+	return schedules, rows.Err()
+}
+
+func (s *SQLiteStore) UpdateSchedule(sched *Schedule) error {
+	query := `UPDATE schedules SET cron_expr = ?, timezone = ?, template = ?, misfire_policy = ?, paused = ?, next_run_at = ?, last_run_at = ?
+              WHERE name = ?`
+	res, err := s.db.Exec(query, sched.CronExpr, sched.Timezone, sched.Template, sched.MisfirePolicy, sched.Paused,
+		sched.NextRunAt, nullTime(sched.LastRunAt), sched.Name)
+	if err != nil {
+		return err
+	}
+	return requireRow(res, ErrScheduleNotFound)
+}
+
+func (s *SQLiteStore) RemoveSchedule(name string) error {
+	res, err := s.db.Exec(`DELETE FROM schedules WHERE name = ?`, name)
+	if err != nil {
+		return err
+	}
+	return requireRow(res, ErrScheduleNotFound)
+}
+
+// AdvanceSchedule uses the expected next tick as a compare-and-swap guard, so when several
+// managers share a database exactly one of them enqueues the jobs for a tick.
+func (s *SQLiteStore) AdvanceSchedule(name string, expected, next time.Time, jobs []*Job) (bool, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	now := time.Now().UTC()
+	query := `UPDATE schedules SET next_run_at = ?, last_run_at = ? WHERE name = ? AND next_run_at = ? AND paused = 0`
+	res, err := tx.Exec(query, next.UTC(), now, name, expected.UTC())
+	if err != nil {
+		return false, err
+	}
+	if n, err := res.RowsAffected(); err != nil || n == 0 {
+		return false, err
+	}
+
+	// Jobs that duplicate an existing job by their idempotency key are skipped.
+	for _, job := range jobs {
+		if _, err := insertJob(tx, job); err != nil {
+			return false, err
+		}
+	}
+	return true, tx.Commit()
+}
+
+// requireRow returns notFound if res affected no rows.
+func requireRow(res sql.Result, notFound error) error {
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return notFound
+	}
+	return nil
+}
@@ -0,0 +1,24 @@
+package store_test
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/Trishvan/queuectl/internal/store"
+	"github.com/Trishvan/queuectl/internal/store/storetest"
+)
+
+func TestSQLiteStore(t *testing.T) {
+	storetest.Run(t, func() (store.Store, error) {
+		return store.NewSQLiteStore(filepath.Join(t.TempDir(), "jobs.db"))
+	})
+}
+
+// TestSQLiteNoDoubleClaims opens one connection per manager on the same file, so claims
+// contend for SQLite's write lock as separate manager processes would.
+func TestSQLiteNoDoubleClaims(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "jobs.db")
+	storetest.NoDoubleClaims(t, func() (store.Store, error) {
+		return store.NewSQLiteStore(path)
+	}, storetest.StressOptions{Managers: 4, WorkersPerManager: 4, Jobs: 200})
+}
@@ -0,0 +1,54 @@
+package store
+
+import (
+	"time"
+)
+
+const workerColumns = `id, hostname, manager_pid, queue, current_job, started_at, last_seen`
+
+func (s *SQLiteStore) RegisterWorker(w *WorkerRecord) error {
+	query := `INSERT OR REPLACE INTO workers (` + workerColumns + `) VALUES (?, ?, ?, ?, ?, ?, ?)`
+	_, err := s.db.Exec(query, w.ID, w.Hostname, w.ManagerPID, w.Queue, w.CurrentJob, w.StartedAt, w.LastSeen)
+	return err
+}
+
+func (s *SQLiteStore) HeartbeatWorker(id, currentJob string, at time.Time) error {
+	res, err := s.db.Exec(`UPDATE workers SET current_job = ?, last_seen = ? WHERE id = ?`, currentJob, at.UTC(), id)
+	if err != nil {
+		return err
+	}
+	return requireRow(res, ErrWorkerNotRegistered)
+}
+
+func (s *SQLiteStore) UnregisterWorker(id string) error {
+	_, err := s.db.Exec(`DELETE FROM workers WHERE id = ?`, id)
+	return err
+}
+
+func (s *SQLiteStore) ListWorkers(since time.Time) ([]*WorkerRecord, error) {
+	query := `SELECT ` + workerColumns + ` FROM workers WHERE last_seen >= ? ORDER BY hostname, manager_pid, started_at, id`
+	rows, err := s.db.Query(query, since.UTC())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var workers []*WorkerRecord
+	for rows.Next() {
+		w := &WorkerRecord{}
+		if err := rows.Scan(&w.ID, &w.Hostname, &w.ManagerPID, &w.Queue, &w.CurrentJob, &w.StartedAt, &w.LastSeen); err != nil {
+			return nil, err
+		}
+		workers = append(workers, w)
+	}
+	return workers, rows.Err()
+}
+
+func (s *SQLiteStore) PruneWorkers(cutoff time.Time) (int, error) {
+	res, err := s.db.Exec(`DELETE FROM workers WHERE last_seen < ?`, cutoff.UTC())
+	if err != nil {
+		return 0, err
+	}
+	n, err := res.RowsAffected()
+	return int(n), err
+}
@@ -0,0 +1,102 @@
+package store
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+func (s *SQLiteStore) CreateWorkflow(wf *Workflow, jobs []*Job) error {
+	steps, err := json.Marshal(wf.Steps)
+	if err != nil {
+		return err
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	query := `INSERT INTO workflows (id, name, steps, created_at) VALUES (?, ?, ?, ?)`
+	if _, err := tx.Exec(query, wf.ID, wf.Name, string(steps), wf.CreatedAt); err != nil {
+		return err
+	}
+	for _, job := range jobs {
+		duplicateOf, err := insertJob(tx, job)
+		if err == nil && duplicateOf != "" {
+			err = fmt.Errorf("its idempotency key matches job %s", duplicateOf)
+		}
+		if err != nil {
+			return fmt.Errorf("enqueueing job %s: %w", job.ID, err)
+		}
+	}
+	return tx.Commit()
+}
+
+func (s *SQLiteStore) GetWorkflow(id string) (*Workflow, error) {
+	return scanWorkflow(s.db.QueryRow(`SELECT id, name, steps, created_at FROM workflows WHERE id = ?`, id))
+}
+
+func scanWorkflow(row rowScanner) (*Workflow, error) {
+	wf := &Workflow{}
+	var steps string
+	err := row.Scan(&wf.ID, &wf.Name, &steps, &wf.CreatedAt)
+	if err == sql.ErrNoRows {
+		return nil, ErrWorkflowNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal([]byte(steps), &wf.Steps); err != nil {
+		return nil, fmt.Errorf("invalid steps of workflow %s: %w", wf.ID, err)
+	}
+	return wf, nil
+}
+
+func (s *SQLiteStore) RerunJobs(ids []string) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, id := range ids {
+		if err := rerunJob(tx, id); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// rerunJob resets one job for RerunJobs.
+func rerunJob(tx *sql.Tx, id string) error {
+	var state JobState
+	var policy DependencyPolicy
+	if err := tx.QueryRow(`SELECT state, on_dependency_failure FROM jobs WHERE id = ?`, id).Scan(&state, &policy); err != nil {
+		return err
+	}
+	if state == StatePending || state == StateProcessing {
+		return fmt.Errorf("%w: %s", ErrJobActive, id)
+	}
+
+	deps, err := queryIDs(tx, `SELECT depends_on FROM job_dependencies WHERE job_id = ?`, id)
+	if err != nil {
+		return err
+	}
+	states, err := dependencyStates(tx, deps)
+	if err != nil {
+		return err
+	}
+	state = stateAfterDependencies(StatePending, policy, states)
+
+	now := time.Now().UTC()
+	query := `UPDATE jobs SET state = ?, attempts = 0, reruns = reruns + 1, updated_at = ?, next_run_at = ?, lease_owner = '', lease_expires_at = NULL,
+              cancel_requested = 0
+              WHERE id = ?`
+	if _, err := tx.Exec(query, state, now, now, id); err != nil {
+		return err
+	}
+	return settleDependents(tx, id, state)
+}
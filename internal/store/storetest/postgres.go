@@ -0,0 +1,60 @@
+package storetest
+
+import (
+	"database/sql"
+	"os"
+	"strings"
+	"testing"
+
+	_ "github.com/lib/pq"
+)
+
+// PostgresDSNEnv names the environment variable that points the PostgreSQL checks at an
+// existing, disposable database. Every reset drops all of its tables.
+const PostgresDSNEnv = "QUEUECTL_TEST_POSTGRES_DSN"
+
+// Postgres returns the URL of the database named by PostgresDSNEnv, with every table in
+// its public schema dropped. t is skipped if PostgresDSNEnv is not set.
+func Postgres(t testing.TB) string {
+	t.Helper()
+	dsn := os.Getenv(PostgresDSNEnv)
+	if dsn == "" {
+		t.Skipf("PostgreSQL not available: set %s to a disposable database", PostgresDSNEnv)
+	}
+	if err := ResetPostgres(dsn); err != nil {
+		t.Fatalf("resetting %s: %v", PostgresDSNEnv, err)
+	}
+	return dsn
+}
+
+// ResetPostgres drops every table in the public schema of the database at dbURL.
+func ResetPostgres(dbURL string) error {
+	db, err := sql.Open("postgres", dbURL)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	rows, err := db.Query(`SELECT tablename FROM pg_tables WHERE schemaname = 'public'`)
+	if err != nil {
+		return err
+	}
+	var tables []string
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			rows.Close()
+			return err
+		}
+		tables = append(tables, `"`+strings.ReplaceAll(name, `"`, `""`)+`"`)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	if len(tables) == 0 {
+		return nil
+	}
+	_, err = db.Exec(`DROP TABLE ` + strings.Join(tables, ", ") + ` CASCADE`)
+	return err
+}
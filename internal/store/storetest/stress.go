@@ -0,0 +1,124 @@
+// Package storetest contains checks that any store.Store implementation must pass. The
+// checks take a testing.TB so they can be run from tests and benchmarks alike.
+package storetest
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/Trishvan/queuectl/internal/store"
+)
+
+// StressOptions configures NoDoubleClaims.
+type StressOptions struct {
+	Managers          int // Independent store connections, standing in for manager processes
+	WorkersPerManager int // Goroutines claiming through each connection
+	Jobs              int
+	Lease             time.Duration
+}
+
+// NoDoubleClaims has several managers, each with its own connection from open, race to
+// claim and complete the same set of jobs. It fails t if any job is claimed twice or if
+// any job is left unprocessed.
+//
+// open must return a new connection to the same, initially empty, database on every call.
+// For SQLite that is a new *store.SQLiteStore on the same file, which takes the same
+// locks as a separate process would. For PostgreSQL it is a new *store.PostgresStore on
+// the URL returned by Postgres.
+func NoDoubleClaims(t testing.TB, open func() (store.Store, error), opts StressOptions) {
+	t.Helper()
+	if opts.Lease == 0 {
+		opts.Lease = time.Minute
+	}
+
+	stores := make([]store.Store, opts.Managers)
+	for i := range stores {
+		s, err := open()
+		if err != nil {
+			t.Fatalf("opening store for manager %d: %v", i, err)
+		}
+		defer s.Close()
+		stores[i] = s
+	}
+
+	now := time.Now().UTC()
+	for i := 0; i < opts.Jobs; i++ {
+		job := &store.Job{
+			ID:         fmt.Sprintf("stress-%d", i),
+			Command:    "true",
+			State:      store.StatePending,
+			MaxRetries: 3,
+			CreatedAt:  now,
+			UpdatedAt:  now,
+			NextRunAt:  now,
+		}
+		if _, err := stores[0].Enqueue(job); err != nil {
+			t.Fatalf("enqueueing %s: %v", job.ID, err)
+		}
+	}
+
+	var (
+		claims    sync.Map // job ID -> owner
+		processed int64
+		retried   int64 // Failed operations, retried like Worker.Run does; SQLITE_BUSY under contention
+		firstErr  sync.Once
+		wg        sync.WaitGroup
+	)
+	retry := func(err error) {
+		firstErr.Do(func() { t.Logf("retrying failed store operation: %v", err) })
+		atomic.AddInt64(&retried, 1)
+		time.Sleep(10 * time.Millisecond)
+	}
+	for m, s := range stores {
+		for w := 0; w < opts.WorkersPerManager; w++ {
+			wg.Add(1)
+			go func(s store.Store, owner string) {
+				defer wg.Done()
+				for atomic.LoadInt64(&processed) < int64(opts.Jobs) {
+					job, err := s.FindAndLockJob(store.ClaimOptions{Owner: owner, Lease: opts.Lease})
+					if err != nil {
+						retry(err)
+						continue
+					}
+					if job == nil {
+						time.Sleep(time.Millisecond)
+						continue
+					}
+					if prev, loaded := claims.LoadOrStore(job.ID, owner); loaded {
+						t.Errorf("job %s claimed by %s after already being claimed by %s", job.ID, owner, prev)
+					}
+					if job.Attempts != 1 {
+						t.Errorf("job %s claimed with %d attempts, want 1", job.ID, job.Attempts)
+					}
+
+					job.State = store.StateCompleted
+					job.LeaseOwner = ""
+					job.LeaseExpiresAt = time.Time{}
+					for {
+						err := s.UpdateJob(job, owner)
+						if err == nil {
+							break
+						}
+						retry(err)
+					}
+					atomic.AddInt64(&processed, 1)
+				}
+			}(s, fmt.Sprintf("manager-%d:worker-%d", m, w))
+		}
+	}
+	wg.Wait()
+	if n := atomic.LoadInt64(&retried); n > 0 {
+		t.Logf("%d store operations failed and were retried", n)
+	}
+
+	summary, err := stores[0].GetStatusSummary("")
+	if err != nil {
+		t.Fatalf("getting status summary: %v", err)
+	}
+	if summary[store.StateCompleted] != opts.Jobs {
+		t.Errorf("%d of %d jobs completed, summary %v", summary[store.StateCompleted], opts.Jobs, summary)
+	}
+}
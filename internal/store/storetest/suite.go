@@ -0,0 +1,1229 @@
+package storetest
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/Trishvan/queuectl/internal/store"
+)
+
+// Factory returns a new, empty store each time it is called.
+type Factory func() (store.Store, error)
+
+// Run checks that the stores made by newStore behave as a store.Store must. Every check
+// runs as a subtest with a store of its own, so a backend is tested with, for example:
+//
+//	func TestSQLiteStore(t *testing.T) {
+//		storetest.Run(t, func() (store.Store, error) {
+//			return store.NewSQLiteStore(filepath.Join(t.TempDir(), "jobs.db"))
+//		})
+//	}
+func Run(t *testing.T, newStore Factory) {
+	checks := []struct {
+		name string
+		fn   func(t testing.TB, s store.Store)
+	}{
+		{"Enqueue", testEnqueue},
+		{"Idempotency", testIdempotency},
+		{"ClaimOrder", testClaimOrder},
+		{"ClaimQueue", testClaimQueue},
+		{"PriorityAging", testPriorityAging},
+		{"NextRunAtGating", testNextRunAtGating},
+		{"ClaimJobs", testClaimJobs},
+		{"ConcurrencyKeys", testConcurrencyKeys},
+		{"RateLimits", testRateLimits},
+		{"CompleteAndRetry", testCompleteAndRetry},
+		{"Leases", testLeases},
+		{"ReclaimExpiredLeases", testReclaimExpiredLeases},
+		{"Cancel", testCancel},
+		{"Dependencies", testDependencies},
+		{"DependencyFailure", testDependencyFailure},
+		{"Workflows", testWorkflows},
+		{"RerunJobs", testRerunJobs},
+		{"SetPriority", testSetPriority},
+		{"Attempts", testAttempts},
+		{"FinishJobs", testFinishJobs},
+		{"StatusSummary", testStatusSummary},
+		{"ListJobsByState", testListJobsByState},
+		{"QueueStats", testQueueStats},
+		{"Schedules", testSchedules},
+		{"Workers", testWorkers},
+		{"ConcurrentClaims", testConcurrentClaims},
+	}
+	for _, c := range checks {
+		c := c
+		t.Run(c.name, func(t *testing.T) {
+			s, err := newStore()
+			if err != nil {
+				t.Fatalf("creating store: %v", err)
+			}
+			defer s.Close()
+			c.fn(t, s)
+		})
+	}
+}
+
+// now is the base time of every fixture. Times are kept to whole milliseconds so they
+// survive a round trip through any backend.
+func now() time.Time {
+	return time.Now().UTC().Truncate(time.Millisecond)
+}
+
+var jobSeq int64
+
+// newJob returns a pending job that is due now, with three retries. Each job is created a
+// millisecond after the one before, so jobs of equal priority are claimed in the order
+// they were made.
+func newJob(id string) *store.Job {
+	t := now()
+	return &store.Job{
+		ID:         id,
+		Command:    "echo " + id,
+		State:      store.StatePending,
+		MaxRetries: 3,
+		CreatedAt:  t.Add(time.Duration(atomic.AddInt64(&jobSeq, 1)) * time.Millisecond),
+		UpdatedAt:  t,
+		NextRunAt:  t,
+	}
+}
+
+func enqueue(t testing.TB, s store.Store, jobs ...*store.Job) {
+	t.Helper()
+	for _, job := range jobs {
+		if _, err := s.Enqueue(job); err != nil {
+			t.Fatalf("enqueueing %s: %v", job.ID, err)
+		}
+	}
+}
+
+func getJob(t testing.TB, s store.Store, id string) *store.Job {
+	t.Helper()
+	job, err := s.GetJob(id)
+	if err != nil {
+		t.Fatalf("getting %s: %v", id, err)
+	}
+	return job
+}
+
+// claim claims a single job as owner, failing t on error.
+func claim(t testing.TB, s store.Store, opts store.ClaimOptions) *store.Job {
+	t.Helper()
+	if opts.Owner == "" {
+		opts.Owner = "owner"
+	}
+	if opts.Lease == 0 {
+		opts.Lease = time.Minute
+	}
+	job, err := s.FindAndLockJob(opts)
+	if err != nil {
+		t.Fatalf("claiming: %v", err)
+	}
+	return job
+}
+
+// claimOrder claims jobs until none is left and returns their IDs in claim order.
+func claimOrder(t testing.TB, s store.Store, opts store.ClaimOptions) []string {
+	t.Helper()
+	var ids []string
+	for {
+		job := claim(t, s, opts)
+		if job == nil {
+			return ids
+		}
+		ids = append(ids, job.ID)
+	}
+}
+
+func wantIDs(t testing.TB, what string, got []string, want ...string) {
+	t.Helper()
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("%s = %v, want %v", what, got, want)
+	}
+}
+
+func jobIDs(jobs []*store.Job) []string {
+	ids := make([]string, len(jobs))
+	for i, job := range jobs {
+		ids[i] = job.ID
+	}
+	return ids
+}
+
+func testEnqueue(t testing.TB, s store.Store) {
+	job := newJob("a")
+	job.Priority = 5
+	job.Timeout = 90 * time.Second
+	job.Backoff = store.BackoffLinear
+	job.BackoffBase = 1.5
+	job.MaxBackoff = time.Hour
+	job.Jitter = 0.25
+	job.RetryOnExitCodes = store.ExitCodes{75}
+	job.FailFastExitCodes = store.ExitCodes{64, 65}
+	enqueue(t, s, job)
+	if job.Queue != store.DefaultQueue {
+		t.Errorf("Enqueue left Queue %q, want %q", job.Queue, store.DefaultQueue)
+	}
+
+	got := getJob(t, s, "a")
+	if got.Command != job.Command || got.State != store.StatePending || got.Queue != store.DefaultQueue ||
+		got.MaxRetries != 3 || got.Priority != 5 || got.Timeout != job.Timeout ||
+		got.Backoff != job.Backoff || got.BackoffBase != job.BackoffBase || got.MaxBackoff != job.MaxBackoff || got.Jitter != job.Jitter ||
+		fmt.Sprint(got.RetryOnExitCodes) != "[75]" || fmt.Sprint(got.FailFastExitCodes) != "[64 65]" {
+		t.Errorf("GetJob = %+v, want the fields of %+v", got, job)
+	}
+	if !got.CreatedAt.Equal(job.CreatedAt) || !got.NextRunAt.Equal(job.NextRunAt) {
+		t.Errorf("GetJob times = %v/%v, want %v/%v", got.CreatedAt, got.NextRunAt, job.CreatedAt, job.NextRunAt)
+	}
+	if got.Attempts != 0 || got.LeaseOwner != "" || !got.LeaseExpiresAt.IsZero() {
+		t.Errorf("new job has attempts %d, lease %q until %v", got.Attempts, got.LeaseOwner, got.LeaseExpiresAt)
+	}
+
+	if _, err := s.Enqueue(newJob("a")); !errors.Is(err, store.ErrJobExists) {
+		t.Errorf("enqueueing a duplicate ID returned %v, want ErrJobExists", err)
+	}
+	if _, err := s.GetJob("missing"); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("GetJob of a missing job returned %v, want sql.ErrNoRows", err)
+	}
+}
+
+// enqueueKeyed enqueues a job with an idempotency key in its own queue and returns the result.
+func enqueueKeyed(t testing.TB, s store.Store, id, key string, scope store.IdempotencyScope, ttl time.Duration) store.EnqueueResult {
+	t.Helper()
+	job := newJob(id)
+	job.Queue = key
+	job.IdempotencyKey = key
+	job.IdempotencyScope = scope
+	job.IdempotencyTTL = ttl
+	res, err := s.Enqueue(job)
+	if err != nil {
+		t.Fatalf("enqueueing %s: %v", id, err)
+	}
+	return res
+}
+
+func wantEnqueueResult(t testing.TB, id string, got store.EnqueueResult, wantID string, duplicate bool) {
+	t.Helper()
+	if got.JobID != wantID || got.Duplicate != duplicate {
+		t.Errorf("enqueueing %s = %+v, want {JobID:%s Duplicate:%v}", id, got, wantID, duplicate)
+	}
+}
+
+func testIdempotency(t testing.TB, s store.Store) {
+	// The pending scope only matches jobs that have not started.
+	wantEnqueueResult(t, "p1", enqueueKeyed(t, s, "p1", "p", store.IdempotencyPending, 0), "p1", false)
+	if got := getJob(t, s, "p1"); got.IdempotencyKey != "p" || got.IdempotencyScope != store.IdempotencyPending {
+		t.Errorf("stored idempotency key %q, scope %q", got.IdempotencyKey, got.IdempotencyScope)
+	}
+	wantEnqueueResult(t, "p2", enqueueKeyed(t, s, "p2", "p", store.IdempotencyPending, 0), "p1", true)
+	if _, err := s.GetJob("p2"); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("duplicate job was stored: %v", err)
+	}
+	claim(t, s, store.ClaimOptions{Queue: "p"})
+	wantEnqueueResult(t, "p3", enqueueKeyed(t, s, "p3", "p", store.IdempotencyPending, 0), "p3", false)
+
+	// The active scope also matches running jobs, but not finished ones.
+	enqueueKeyed(t, s, "a1", "a", store.IdempotencyActive, 0)
+	running := claim(t, s, store.ClaimOptions{Queue: "a"})
+	wantEnqueueResult(t, "a2", enqueueKeyed(t, s, "a2", "a", store.IdempotencyActive, 0), "a1", true)
+	finish(t, s, running, store.StateCompleted)
+	wantEnqueueResult(t, "a3", enqueueKeyed(t, s, "a3", "a", store.IdempotencyActive, 0), "a3", false)
+
+	// The ttl scope matches jobs in any state created within the window.
+	old := newJob("t1")
+	old.Queue, old.IdempotencyKey = "t", "t"
+	old.CreatedAt = now().Add(-2 * time.Hour)
+	enqueue(t, s, old)
+	wantEnqueueResult(t, "t2", enqueueKeyed(t, s, "t2", "t", store.IdempotencyTTLScope, time.Hour), "t2", false)
+	wantIDs(t, "claimed", claimOrder(t, s, store.ClaimOptions{Queue: "t"}), "t1", "t2")
+	finish(t, s, getJob(t, s, "t2"), store.StateCompleted)
+	wantEnqueueResult(t, "t3", enqueueKeyed(t, s, "t3", "t", store.IdempotencyTTLScope, time.Hour), "t2", true)
+
+	// Jobs without a key are never duplicates, and a taken ID is still an error.
+	if _, err := s.Enqueue(newJob("t3")); err != nil {
+		t.Errorf("enqueueing a job without a key: %v", err)
+	}
+	if _, err := s.Enqueue(newJob("p1")); !errors.Is(err, store.ErrJobExists) {
+		t.Errorf("enqueueing a taken ID returned %v, want ErrJobExists", err)
+	}
+}
+
+func testClaimOrder(t testing.TB, s store.Store) {
+	base := now().Add(-time.Minute)
+	for i, spec := range []struct {
+		id       string
+		priority int
+	}{
+		{"low-old", 0}, {"high-new", 10}, {"low-new", 0}, {"high-old", 10}, {"negative", -1},
+	} {
+		job := newJob(spec.id)
+		job.Priority = spec.priority
+		job.CreatedAt = base.Add(time.Duration(i) * time.Second)
+		if spec.id == "high-old" {
+			job.CreatedAt = base.Add(-time.Second)
+		}
+		enqueue(t, s, job)
+	}
+	wantIDs(t, "claim order", claimOrder(t, s, store.ClaimOptions{}), "high-old", "high-new", "low-old", "low-new", "negative")
+}
+
+func testClaimQueue(t testing.TB, s store.Store) {
+	a, b := newJob("emails-1"), newJob("reports-1")
+	a.Queue, b.Queue = "emails", "reports"
+	enqueue(t, s, a, b, newJob("default-1"))
+
+	wantIDs(t, "claims from emails", claimOrder(t, s, store.ClaimOptions{Queue: "emails"}), "emails-1")
+	wantIDs(t, "claims from any queue", claimOrder(t, s, store.ClaimOptions{}), "reports-1", "default-1")
+}
+
+func testPriorityAging(t testing.TB, s store.Store) {
+	old, fresh := newJob("old"), newJob("fresh")
+	old.CreatedAt = now().Add(-time.Hour)
+	fresh.Priority = 10
+	enqueue(t, s, old, fresh)
+
+	// An hour's wait at one point per minute outranks ten points of priority.
+	wantIDs(t, "claim order with aging", claimOrder(t, s, store.ClaimOptions{PriorityAging: time.Minute}), "old", "fresh")
+
+	// A batch claim takes jobs in the same order, over more than one page when jobs are
+	// held back by their concurrency key.
+	var jobs []*store.Job
+	for _, id := range []string{"old-1", "old-2", "fresh-1", "fresh-2", "mid"} {
+		job := newJob(id)
+		switch id {
+		case "old-1", "old-2":
+			job.CreatedAt = job.CreatedAt.Add(-time.Hour)
+			job.ConcurrencyKey, job.ConcurrencyLimit = "k", 1
+		case "mid":
+			job.Priority = 5
+		default:
+			job.Priority = 10
+		}
+		jobs = append(jobs, job)
+	}
+	enqueue(t, s, jobs...)
+	claimed, err := s.ClaimJobs(store.ClaimOptions{Owner: "owner", Lease: time.Minute, PriorityAging: time.Minute}, 3)
+	if err != nil {
+		t.Fatalf("ClaimJobs: %v", err)
+	}
+	wantIDs(t, "batch claimed with aging", jobIDs(claimed), "old-1", "fresh-1", "fresh-2")
+}
+
+func testNextRunAtGating(t testing.TB, s store.Store) {
+	later, past := newJob("later"), newJob("past")
+	later.NextRunAt = now().Add(time.Hour)
+	past.NextRunAt = now().Add(-time.Hour)
+	soon := newJob("soon")
+	soon.NextRunAt = now().Add(300 * time.Millisecond)
+	enqueue(t, s, later, past, soon)
+
+	wantIDs(t, "claims before soon is due", claimOrder(t, s, store.ClaimOptions{}), "past")
+	time.Sleep(400 * time.Millisecond)
+	wantIDs(t, "claims once soon is due", claimOrder(t, s, store.ClaimOptions{}), "soon")
+	if got := getJob(t, s, "later"); got.State != store.StatePending || got.Attempts != 0 {
+		t.Errorf("job not yet due is %s after %d attempts", got.State, got.Attempts)
+	}
+}
+
+func testClaimJobs(t testing.TB, s store.Store) {
+	for i := 0; i < 5; i++ {
+		job := newJob(fmt.Sprintf("job-%d", i))
+		job.Priority = i % 2
+		job.CreatedAt = job.CreatedAt.Add(time.Duration(i) * time.Second)
+		enqueue(t, s, job)
+	}
+
+	opts := store.ClaimOptions{Owner: "batch", Lease: time.Minute}
+	jobs, err := s.ClaimJobs(opts, 3)
+	if err != nil {
+		t.Fatalf("ClaimJobs: %v", err)
+	}
+	wantIDs(t, "first batch", jobIDs(jobs), "job-1", "job-3", "job-0")
+	for _, job := range jobs {
+		if job.State != store.StateProcessing || job.Attempts != 1 || job.LeaseOwner != "batch" {
+			t.Errorf("claimed %s is %s after %d attempts, leased to %q", job.ID, job.State, job.Attempts, job.LeaseOwner)
+		}
+	}
+
+	jobs, err = s.ClaimJobs(opts, 3)
+	if err != nil {
+		t.Fatalf("ClaimJobs: %v", err)
+	}
+	wantIDs(t, "second batch", jobIDs(jobs), "job-2", "job-4")
+
+	if jobs, err := s.ClaimJobs(opts, 3); err != nil || len(jobs) != 0 {
+		t.Errorf("ClaimJobs on an empty queue = %v, %v", jobIDs(jobs), err)
+	}
+}
+
+func testConcurrencyKeys(t testing.TB, s store.Store) {
+	keyed := func(id, key string, limit int) *store.Job {
+		job := newJob(id)
+		job.ConcurrencyKey, job.ConcurrencyLimit = key, limit
+		return job
+	}
+	enqueue(t, s, keyed("repo-1", "repo", 1), keyed("repo-2", "repo", 1),
+		keyed("acct-1", "acct", 2), keyed("acct-2", "acct", 2), keyed("acct-3", "acct", 2), newJob("free"))
+	if got := getJob(t, s, "acct-1"); got.ConcurrencyKey != "acct" || got.ConcurrencyLimit != 2 {
+		t.Errorf("stored concurrency key %q, limit %d", got.ConcurrencyKey, got.ConcurrencyLimit)
+	}
+
+	// One batch never takes a key past its limit.
+	jobs, err := s.ClaimJobs(store.ClaimOptions{Owner: "owner", Lease: time.Minute}, 10)
+	if err != nil {
+		t.Fatalf("ClaimJobs: %v", err)
+	}
+	wantIDs(t, "claimed in one batch", jobIDs(jobs), "repo-1", "acct-1", "acct-2", "free")
+	if job := claim(t, s, store.ClaimOptions{}); job != nil {
+		t.Errorf("claimed %s while its concurrency key was at its limit", job.ID)
+	}
+
+	held, err := s.ListJobsByConcurrencyKey("acct")
+	if err != nil {
+		t.Fatalf("ListJobsByConcurrencyKey: %v", err)
+	}
+	wantIDs(t, "jobs with key acct", jobIDs(held), "acct-1", "acct-2", "acct-3")
+
+	// A holder finishing frees its slot for the next job waiting.
+	finish(t, s, held[0], store.StateCompleted)
+	wantIDs(t, "claims after a holder finished", claimOrder(t, s, store.ClaimOptions{}), "acct-3")
+
+	// Jobs waiting for a key do not keep a batch from filling with the jobs behind them.
+	enqueue(t, s, keyed("deploy-1", "deploy", 1), keyed("deploy-2", "deploy", 1), keyed("deploy-3", "deploy", 1),
+		newJob("late-1"), newJob("late-2"))
+	jobs, err = s.ClaimJobs(store.ClaimOptions{Owner: "owner", Lease: time.Minute}, 3)
+	if err != nil {
+		t.Fatalf("ClaimJobs: %v", err)
+	}
+	wantIDs(t, "claimed past jobs waiting for a key", jobIDs(jobs), "deploy-1", "late-1", "late-2")
+
+	// The same holds when claim order takes age into account.
+	enqueue(t, s, keyed("build-1", "build", 1), keyed("build-2", "build", 1), keyed("build-3", "build", 1),
+		newJob("aged-1"), newJob("aged-2"), newJob("aged-3"))
+	jobs, err = s.ClaimJobs(store.ClaimOptions{Owner: "owner", Lease: time.Minute, PriorityAging: time.Minute}, 4)
+	if err != nil {
+		t.Fatalf("ClaimJobs: %v", err)
+	}
+	wantIDs(t, "claimed with aging past jobs waiting for a key", jobIDs(jobs), "build-1", "aged-1", "aged-2", "aged-3")
+}
+
+func testRateLimits(t testing.TB, s store.Store) {
+	if err := s.SetRateLimit(&store.RateLimit{Name: "emails", Rate: 2, Per: time.Hour}); err != nil {
+		t.Fatalf("SetRateLimit: %v", err)
+	}
+	e1, e2, e3, keyed := newJob("e1"), newJob("e2"), newJob("e3"), newJob("keyed")
+	e1.Queue, e2.Queue, e3.Queue = "emails", "emails", "emails"
+	keyed.RateKey = "emails"
+	enqueue(t, s, e1, e2, e3, keyed, newJob("free"))
+
+	limits, err := s.ListRateLimits()
+	if err != nil {
+		t.Fatalf("ListRateLimits: %v", err)
+	}
+	if len(limits) != 1 || limits[0].Burst != 2 || limits[0].Tokens != 2 || limits[0].Ready != 4 {
+		t.Fatalf("ListRateLimits = %+v, want emails with a full burst of 2 and 4 jobs ready", limits)
+	}
+
+	// Each claim takes a token; jobs under an empty bucket are passed over, and the batch
+	// is filled with the jobs behind them.
+	jobs, err := s.ClaimJobs(store.ClaimOptions{Owner: "owner", Lease: time.Minute}, 3)
+	if err != nil {
+		t.Fatalf("ClaimJobs: %v", err)
+	}
+	wantIDs(t, "claimed in one batch", jobIDs(jobs), "e1", "e2", "free")
+	if job := claim(t, s, store.ClaimOptions{}); job != nil {
+		t.Errorf("claimed %s while its rate limit was out of tokens", job.ID)
+	}
+	limits, err = s.ListRateLimits()
+	if err != nil {
+		t.Fatalf("ListRateLimits: %v", err)
+	}
+	if len(limits) != 1 || limits[0].Available(time.Now()) >= 1 || limits[0].Ready != 2 {
+		t.Errorf("ListRateLimits after the bucket emptied = %+v, want no token and 2 jobs ready", limits)
+	}
+
+	// The bucket refills over time.
+	if err := s.SetRateLimit(&store.RateLimit{Name: "emails", Rate: 1, Per: 50 * time.Millisecond}); err != nil {
+		t.Fatalf("SetRateLimit: %v", err)
+	}
+	wantIDs(t, "claims with a new limit", claimOrder(t, s, store.ClaimOptions{}), "e3")
+	time.Sleep(60 * time.Millisecond)
+	wantIDs(t, "claims after a refill", claimOrder(t, s, store.ClaimOptions{}), "keyed")
+
+	if err := s.RemoveRateLimit("emails"); err != nil {
+		t.Errorf("RemoveRateLimit: %v", err)
+	}
+	if err := s.RemoveRateLimit("emails"); !errors.Is(err, store.ErrRateLimitNotFound) {
+		t.Errorf("removing a missing rate limit returned %v, want ErrRateLimitNotFound", err)
+	}
+}
+
+func testCompleteAndRetry(t testing.TB, s store.Store) {
+	enqueue(t, s, newJob("a"))
+
+	start := time.Now()
+	job := claim(t, s, store.ClaimOptions{Owner: "w1", Lease: time.Minute})
+	if job == nil {
+		t.Fatal("no job claimed")
+	}
+	if job.State != store.StateProcessing || job.Attempts != 1 || job.LeaseOwner != "w1" {
+		t.Errorf("claimed job is %s after %d attempts, leased to %q", job.State, job.Attempts, job.LeaseOwner)
+	}
+	if job.LeaseExpiresAt.Before(start.Add(59*time.Second)) || job.LeaseExpiresAt.After(time.Now().Add(time.Minute)) {
+		t.Errorf("lease expires at %v, want a minute after the claim at %v", job.LeaseExpiresAt, start)
+	}
+	if stored := getJob(t, s, "a"); stored.State != store.StateProcessing || stored.LeaseOwner != "w1" {
+		t.Errorf("stored job is %s, leased to %q", stored.State, stored.LeaseOwner)
+	}
+	if again := claim(t, s, store.ClaimOptions{}); again != nil {
+		t.Errorf("claimed %s while it was processing", again.ID)
+	}
+
+	// A failed attempt is retried later.
+	job.State = store.StatePending
+	job.NextRunAt = now().Add(-time.Second)
+	lease := job.LeaseOwner
+	job.LeaseOwner = ""
+	job.LeaseExpiresAt = time.Time{}
+	if err := s.UpdateJob(job, lease); err != nil {
+		t.Fatalf("UpdateJob: %v", err)
+	}
+	stored := getJob(t, s, "a")
+	if stored.State != store.StatePending || stored.Attempts != 1 || stored.LeaseOwner != "" || !stored.LeaseExpiresAt.IsZero() {
+		t.Errorf("retried job is %s after %d attempts, leased to %q until %v", stored.State, stored.Attempts, stored.LeaseOwner, stored.LeaseExpiresAt)
+	}
+
+	job = claim(t, s, store.ClaimOptions{Owner: "w2"})
+	if job == nil || job.Attempts != 2 {
+		t.Fatalf("claimed %+v on retry, want attempt 2", job)
+	}
+	job.State = store.StateCompleted
+	lease = job.LeaseOwner
+	job.LeaseOwner = ""
+	job.LeaseExpiresAt = time.Time{}
+	if err := s.UpdateJob(job, lease); err != nil {
+		t.Fatalf("UpdateJob: %v", err)
+	}
+	if stored := getJob(t, s, "a"); stored.State != store.StateCompleted || stored.Attempts != 2 {
+		t.Errorf("completed job is %s after %d attempts", stored.State, stored.Attempts)
+	}
+	if again := claim(t, s, store.ClaimOptions{}); again != nil {
+		t.Errorf("claimed completed job %s", again.ID)
+	}
+}
+
+func testLeases(t testing.TB, s store.Store) {
+	enqueue(t, s, newJob("a"))
+	job := claim(t, s, store.ClaimOptions{Owner: "w1", Lease: time.Second})
+
+	if _, err := s.RenewLease(job.ID, "w2", time.Minute); !errors.Is(err, store.ErrLeaseLost) {
+		t.Errorf("renewing another owner's lease returned %v, want ErrLeaseLost", err)
+	}
+	cancelRequested, err := s.RenewLease(job.ID, "w1", time.Hour)
+	if err != nil || cancelRequested {
+		t.Fatalf("RenewLease = %v, %v", cancelRequested, err)
+	}
+	if stored := getJob(t, s, "a"); stored.LeaseExpiresAt.Before(time.Now().Add(59 * time.Minute)) {
+		t.Errorf("renewed lease expires at %v, want an hour from now", stored.LeaseExpiresAt)
+	}
+
+	job.State = store.StateCompleted
+	lease := job.LeaseOwner
+	job.LeaseOwner = ""
+	job.LeaseExpiresAt = time.Time{}
+	if err := s.UpdateJob(job, "w2"); !errors.Is(err, store.ErrLeaseLost) {
+		t.Errorf("saving the job under another owner's lease returned %v, want ErrLeaseLost", err)
+	}
+	if stored := getJob(t, s, "a"); stored.State != store.StateProcessing || stored.LeaseOwner != "w1" {
+		t.Errorf("job saved under another lease is %s, leased to %q", stored.State, stored.LeaseOwner)
+	}
+	if err := s.UpdateJob(job, lease); err != nil {
+		t.Fatalf("UpdateJob: %v", err)
+	}
+	if err := s.UpdateJob(job, lease); !errors.Is(err, store.ErrLeaseLost) {
+		t.Errorf("saving the job again under its released lease returned %v, want ErrLeaseLost", err)
+	}
+	if _, err := s.RenewLease(job.ID, "w1", time.Minute); !errors.Is(err, store.ErrLeaseLost) {
+		t.Errorf("renewing the lease of a completed job returned %v, want ErrLeaseLost", err)
+	}
+}
+
+func testReclaimExpiredLeases(t testing.TB, s store.Store) {
+	retry, last, held := newJob("retry"), newJob("last"), newJob("held")
+	last.MaxRetries = 1
+	enqueue(t, s, retry, last, held)
+	for _, id := range []string{"retry", "last"} {
+		if job := claim(t, s, store.ClaimOptions{Owner: "gone", Lease: time.Millisecond}); job == nil || job.ID != id {
+			t.Fatalf("claimed %+v, want %s", job, id)
+		}
+	}
+	claim(t, s, store.ClaimOptions{Owner: "alive", Lease: time.Hour})
+
+	time.Sleep(10 * time.Millisecond)
+	requeued, dead, err := s.ReclaimExpiredLeases(time.Now())
+	if err != nil {
+		t.Fatalf("ReclaimExpiredLeases: %v", err)
+	}
+	if requeued != 1 || dead != 1 {
+		t.Errorf("ReclaimExpiredLeases = %d requeued, %d dead, want 1 and 1", requeued, dead)
+	}
+	for id, want := range map[string]store.JobState{"retry": store.StatePending, "last": store.StateDead, "held": store.StateProcessing} {
+		if got := getJob(t, s, id); got.State != want || got.Attempts != 1 {
+			t.Errorf("%s is %s after %d attempts, want %s after 1", id, got.State, got.Attempts, want)
+		}
+	}
+	if got := getJob(t, s, "retry"); got.LeaseOwner != "" || !got.LeaseExpiresAt.IsZero() {
+		t.Errorf("requeued job still leased to %q until %v", got.LeaseOwner, got.LeaseExpiresAt)
+	}
+}
+
+func testCancel(t testing.TB, s store.Store) {
+	enqueue(t, s, newJob("running"))
+	running := claim(t, s, store.ClaimOptions{Owner: "w1"})
+	enqueue(t, s, newJob("pending"))
+
+	if cancelled, err := s.CancelJob("pending"); err != nil || !cancelled {
+		t.Errorf("cancelling a pending job = %v, %v, want true", cancelled, err)
+	}
+	if got := getJob(t, s, "pending"); got.State != store.StateCancelled {
+		t.Errorf("cancelled pending job is %s", got.State)
+	}
+	if job := claim(t, s, store.ClaimOptions{}); job != nil {
+		t.Errorf("claimed %s after cancelling it", job.ID)
+	}
+
+	// A running job is only asked to stop, and is cancelled rather than retried.
+	if cancelled, err := s.CancelJob("running"); err != nil || cancelled {
+		t.Errorf("cancelling a processing job = %v, %v, want false", cancelled, err)
+	}
+	if requested, err := s.RenewLease("running", "w1", time.Minute); err != nil || !requested {
+		t.Errorf("RenewLease after a cancel request = %v, %v, want true", requested, err)
+	}
+	running.State = store.StatePending
+	lease := running.LeaseOwner
+	running.LeaseOwner = ""
+	running.LeaseExpiresAt = time.Time{}
+	if err := s.UpdateJob(running, lease); err != nil {
+		t.Fatalf("UpdateJob: %v", err)
+	}
+	if running.State != store.StateCancelled {
+		t.Errorf("UpdateJob left the caller's job %s, want cancelled", running.State)
+	}
+	if got := getJob(t, s, "running"); got.State != store.StateCancelled {
+		t.Errorf("job retried after a cancel request is %s, want cancelled", got.State)
+	}
+
+	if _, err := s.CancelJob("running"); !errors.Is(err, store.ErrJobNotCancellable) {
+		t.Errorf("cancelling a finished job returned %v, want ErrJobNotCancellable", err)
+	}
+	if _, err := s.CancelJob("missing"); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("cancelling a missing job returned %v, want sql.ErrNoRows", err)
+	}
+}
+
+// finish saves job in state, as a worker does when an attempt ends.
+func finish(t testing.TB, s store.Store, job *store.Job, state store.JobState) {
+	t.Helper()
+	job.State = state
+	lease := job.LeaseOwner
+	job.LeaseOwner = ""
+	job.LeaseExpiresAt = time.Time{}
+	if err := s.UpdateJob(job, lease); err != nil {
+		t.Fatalf("UpdateJob(%s): %v", job.ID, err)
+	}
+}
+
+func testDependencies(t testing.TB, s store.Store) {
+	a, b, c := newJob("a"), newJob("b"), newJob("c")
+	c.DependsOn = []string{"b", "a"}
+	enqueue(t, s, a, b, c)
+	if c.State != store.StateBlocked {
+		t.Errorf("Enqueue left a job with unfinished dependencies %s, want blocked", c.State)
+	}
+	got := getJob(t, s, "c")
+	if got.State != store.StateBlocked {
+		t.Errorf("stored job with unfinished dependencies is %s, want blocked", got.State)
+	}
+	wantIDs(t, "GetJob DependsOn", got.DependsOn, "a", "b")
+	dependsOn, dependents, err := s.JobDependencies("a")
+	if err != nil {
+		t.Fatalf("JobDependencies: %v", err)
+	}
+	wantIDs(t, "dependencies of a", dependsOn)
+	wantIDs(t, "dependents of a", dependents, "c")
+
+	first := claim(t, s, store.ClaimOptions{})
+	second := claim(t, s, store.ClaimOptions{})
+	if job := claim(t, s, store.ClaimOptions{}); job != nil {
+		t.Fatalf("claimed blocked job %s", job.ID)
+	}
+	finish(t, s, first, store.StateCompleted)
+	if got := getJob(t, s, "c"); got.State != store.StateBlocked {
+		t.Errorf("job with one of two dependencies completed is %s, want blocked", got.State)
+	}
+	finish(t, s, second, store.StateCompleted)
+	if got := getJob(t, s, "c"); got.State != store.StatePending {
+		t.Errorf("job with all dependencies completed is %s, want pending", got.State)
+	}
+	if job := claim(t, s, store.ClaimOptions{}); job == nil || job.ID != "c" {
+		t.Errorf("claimed %+v once its dependencies completed, want c", job)
+	}
+
+	// A job whose dependencies have already completed is not blocked.
+	d := newJob("d")
+	d.DependsOn = []string{"a"}
+	enqueue(t, s, d)
+	if d.State != store.StatePending {
+		t.Errorf("job depending on a completed job is %s, want pending", d.State)
+	}
+
+	missing := newJob("missing")
+	missing.DependsOn = []string{"a", "nope"}
+	if _, err := s.Enqueue(missing); !errors.Is(err, store.ErrDependencyNotFound) {
+		t.Errorf("enqueueing a job with a missing dependency returned %v, want ErrDependencyNotFound", err)
+	}
+	if _, err := s.GetJob("missing"); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("job with a missing dependency was stored: %v", err)
+	}
+}
+
+func testDependencyFailure(t testing.TB, s store.Store) {
+	a, b, c, w := newJob("a"), newJob("b"), newJob("c"), newJob("w")
+	b.DependsOn = []string{"a"}
+	c.DependsOn = []string{"b"}
+	w.DependsOn = []string{"a"}
+	w.OnDependencyFailure = store.DependencyWait
+	enqueue(t, s, a, b, c, w)
+
+	// A dead dependency cancels its dependents, and theirs in turn, unless they wait.
+	finish(t, s, claim(t, s, store.ClaimOptions{}), store.StateDead)
+	for id, want := range map[string]store.JobState{"b": store.StateCancelled, "c": store.StateCancelled, "w": store.StateBlocked} {
+		if got := getJob(t, s, id); got.State != want {
+			t.Errorf("after its dependency died %s is %s, want %s", id, got.State, want)
+		}
+	}
+
+	// Jobs enqueued after a dependency died start cancelled, or blocked if they wait.
+	late, waiting := newJob("late"), newJob("waiting")
+	late.DependsOn = []string{"a"}
+	waiting.DependsOn = []string{"a"}
+	waiting.OnDependencyFailure = store.DependencyWait
+	enqueue(t, s, late, waiting)
+	if late.State != store.StateCancelled || waiting.State != store.StateBlocked {
+		t.Errorf("jobs depending on a dead job are %s and %s, want cancelled and blocked", late.State, waiting.State)
+	}
+
+	// A blocked job can be cancelled, which cancels its own dependents.
+	after := newJob("after")
+	after.DependsOn = []string{"waiting"}
+	enqueue(t, s, after)
+	if cancelled, err := s.CancelJob("waiting"); err != nil || !cancelled {
+		t.Errorf("cancelling a blocked job = %v, %v, want true", cancelled, err)
+	}
+	if got := getJob(t, s, "after"); got.State != store.StateCancelled {
+		t.Errorf("dependent of a cancelled job is %s, want cancelled", got.State)
+	}
+
+	// Jobs that die when their lease is reclaimed cascade too.
+	lost, next := newJob("lost"), newJob("next")
+	lost.MaxRetries = 1
+	next.DependsOn = []string{"lost"}
+	enqueue(t, s, lost, next)
+	if job := claim(t, s, store.ClaimOptions{Owner: "gone", Lease: time.Millisecond}); job == nil || job.ID != "lost" {
+		t.Fatalf("claimed %+v, want lost", job)
+	}
+	time.Sleep(10 * time.Millisecond)
+	if _, dead, err := s.ReclaimExpiredLeases(time.Now()); err != nil || dead != 1 {
+		t.Fatalf("ReclaimExpiredLeases = %d dead, %v, want 1", dead, err)
+	}
+	if got := getJob(t, s, "next"); got.State != store.StateCancelled {
+		t.Errorf("dependent of a reclaimed dead job is %s, want cancelled", got.State)
+	}
+}
+
+func testWorkflows(t testing.TB, s store.Store) {
+	if _, err := s.GetWorkflow("missing"); !errors.Is(err, store.ErrWorkflowNotFound) {
+		t.Errorf("getting a missing workflow returned %v, want ErrWorkflowNotFound", err)
+	}
+
+	build, test := newJob("run.build"), newJob("run.test")
+	build.Env = store.Env{"TARGET": "prod"}
+	test.DependsOn = []string{"run.build"}
+	wf := &store.Workflow{
+		ID:   "run",
+		Name: "release",
+		Steps: []store.WorkflowStep{
+			{Name: "build", JobID: "run.build"},
+			{Name: "test", JobID: "run.test", DependsOn: []string{"build"}},
+		},
+		CreatedAt: now(),
+	}
+	if err := s.CreateWorkflow(wf, []*store.Job{build, test}); err != nil {
+		t.Fatalf("CreateWorkflow: %v", err)
+	}
+	got, err := s.GetWorkflow("run")
+	if err != nil {
+		t.Fatalf("GetWorkflow: %v", err)
+	}
+	if fmt.Sprint(got.Steps) != fmt.Sprint(wf.Steps) || got.Name != wf.Name || !got.CreatedAt.Equal(wf.CreatedAt) {
+		t.Errorf("GetWorkflow = %+v, want %+v", got, wf)
+	}
+	if got := getJob(t, s, "run.build"); got.Env["TARGET"] != "prod" || len(got.Env) != 1 {
+		t.Errorf("step job env = %v, want TARGET=prod", got.Env)
+	}
+	if got := getJob(t, s, "run.test"); got.State != store.StateBlocked {
+		t.Errorf("dependent step is %s, want blocked", got.State)
+	}
+
+	// A workflow whose jobs cannot all be enqueued is not created at all.
+	bad := newJob("bad.a")
+	bad.DependsOn = []string{"nope"}
+	err = s.CreateWorkflow(&store.Workflow{ID: "bad", Name: "bad", CreatedAt: now()}, []*store.Job{newJob("bad.ok"), bad})
+	if !errors.Is(err, store.ErrDependencyNotFound) {
+		t.Errorf("CreateWorkflow with a missing dependency returned %v, want ErrDependencyNotFound", err)
+	}
+	if _, err := s.GetWorkflow("bad"); !errors.Is(err, store.ErrWorkflowNotFound) {
+		t.Errorf("failed workflow was stored: %v", err)
+	}
+	if _, err := s.GetJob("bad.ok"); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("job of a failed workflow was stored: %v", err)
+	}
+}
+
+func testRerunJobs(t testing.TB, s store.Store) {
+	a, b, c := newJob("a"), newJob("b"), newJob("c")
+	b.DependsOn = []string{"a"}
+	c.DependsOn = []string{"b"}
+	enqueue(t, s, a, b, c)
+	finish(t, s, claim(t, s, store.ClaimOptions{}), store.StateCompleted)
+	finish(t, s, claim(t, s, store.ClaimOptions{}), store.StateDead)
+	if got := getJob(t, s, "c"); got.State != store.StateCancelled {
+		t.Fatalf("dependent of a dead job is %s, want cancelled", got.State)
+	}
+
+	if err := s.RerunJobs([]string{"b", "c"}); err != nil {
+		t.Fatalf("RerunJobs: %v", err)
+	}
+	for id, want := range map[string]store.JobState{"a": store.StateCompleted, "b": store.StatePending, "c": store.StateBlocked} {
+		if got := getJob(t, s, id); got.State != want {
+			t.Errorf("after rerunning b and c, %s is %s, want %s", id, got.State, want)
+		}
+	}
+	if got := getJob(t, s, "b"); got.Attempts != 0 || got.Reruns != 1 {
+		t.Errorf("rerun job has %d attempts and %d reruns, want 0 and 1", got.Attempts, got.Reruns)
+	}
+
+	// Jobs still queued are refused, and nothing changes.
+	if err := s.RerunJobs([]string{"a", "b"}); !errors.Is(err, store.ErrJobActive) {
+		t.Errorf("rerunning a pending job returned %v, want ErrJobActive", err)
+	}
+	if got := getJob(t, s, "a"); got.State != store.StateCompleted {
+		t.Errorf("failed rerun left a %s, want completed", got.State)
+	}
+
+	finish(t, s, claim(t, s, store.ClaimOptions{}), store.StateCompleted)
+	if job := claim(t, s, store.ClaimOptions{}); job == nil || job.ID != "c" {
+		t.Errorf("claimed %+v after its rerun dependency completed, want c", job)
+	}
+}
+
+func testSetPriority(t testing.TB, s store.Store) {
+	enqueue(t, s, newJob("a"), newJob("b"))
+	if err := s.SetPriority("b", 3); err != nil {
+		t.Fatalf("SetPriority: %v", err)
+	}
+	if got := getJob(t, s, "b"); got.Priority != 3 {
+		t.Errorf("priority = %d, want 3", got.Priority)
+	}
+
+	claim(t, s, store.ClaimOptions{})
+	if err := s.SetPriority("b", 1); !errors.Is(err, store.ErrJobNotPending) {
+		t.Errorf("SetPriority of a processing job returned %v, want ErrJobNotPending", err)
+	}
+	if err := s.SetPriority("missing", 1); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("SetPriority of a missing job returned %v, want sql.ErrNoRows", err)
+	}
+}
+
+func testAttempts(t testing.TB, s store.Store) {
+	enqueue(t, s, newJob("a"))
+	start := now()
+	for _, a := range []*store.Attempt{
+		{JobID: "a", Attempt: 2, Worker: "w1", StartedAt: start, FinishedAt: start.Add(time.Second), ExitCode: 0},
+		{JobID: "a", Attempt: 1, Worker: "w1", StartedAt: start, FinishedAt: start, ExitCode: 1, Stderr: "boom",
+			Reason: store.ReasonExitCode, Classification: store.ClassRetry},
+	} {
+		if err := s.RecordAttempt(a); err != nil {
+			t.Fatalf("RecordAttempt: %v", err)
+		}
+	}
+	// An attempt is recorded once; a second result for it is an error, not a replacement.
+	if err := s.RecordAttempt(&store.Attempt{JobID: "a", Attempt: 2, Worker: "w2", StartedAt: start, FinishedAt: start, ExitCode: 3}); err == nil {
+		t.Errorf("recording attempt 2 twice succeeded")
+	}
+
+	// Attempt numbers start again after a DLQ retry, which keeps the earlier attempts.
+	job := getJob(t, s, "a")
+	job.ResetForRetry()
+	if err := s.UpdateJob(job, ""); err != nil {
+		t.Fatalf("UpdateJob: %v", err)
+	}
+	if got := getJob(t, s, "a"); got.Reruns != 1 {
+		t.Fatalf("job retried from the DLQ has %d reruns, want 1", got.Reruns)
+	}
+	if err := s.RecordAttempt(&store.Attempt{JobID: "a", Rerun: 1, Attempt: 1, Worker: "w2", StartedAt: start, FinishedAt: start, ExitCode: 3}); err != nil {
+		t.Fatalf("RecordAttempt: %v", err)
+	}
+
+	attempts, err := s.ListAttempts("a")
+	if err != nil {
+		t.Fatalf("ListAttempts: %v", err)
+	}
+	if len(attempts) != 3 {
+		t.Fatalf("ListAttempts returned %d attempts, want 3", len(attempts))
+	}
+	first, second, third := attempts[0], attempts[1], attempts[2]
+	if first.Rerun != 0 || first.Attempt != 1 || first.ExitCode != 1 || first.Stderr != "boom" || first.Reason != store.ReasonExitCode || first.Classification != store.ClassRetry {
+		t.Errorf("first attempt = %+v", first)
+	}
+	if second.Rerun != 0 || second.Attempt != 2 || second.Worker != "w1" || second.ExitCode != 0 {
+		t.Errorf("second attempt = %+v, want the first one recorded", second)
+	}
+	if third.Rerun != 1 || third.Attempt != 1 || third.Worker != "w2" || third.ExitCode != 3 {
+		t.Errorf("third attempt = %+v, want the attempt of the rerun", third)
+	}
+	if attempts, err := s.ListAttempts("missing"); err != nil || len(attempts) != 0 {
+		t.Errorf("ListAttempts of a missing job = %v, %v", attempts, err)
+	}
+}
+
+func testFinishJobs(t testing.TB, s store.Store) {
+	enqueue(t, s, newJob("a"), newJob("b"), newJob("lost"))
+	jobs, err := s.ClaimJobs(store.ClaimOptions{Owner: "w", Lease: time.Minute}, 2)
+	if err != nil || len(jobs) != 2 {
+		t.Fatalf("ClaimJobs = %v, %v", jobIDs(jobs), err)
+	}
+	// The lease on the last job runs out, and another owner claims it before its result is saved.
+	jobs = append(jobs, claim(t, s, store.ClaimOptions{Owner: "w", Lease: -time.Second}))
+	if _, _, err := s.ReclaimExpiredLeases(now()); err != nil {
+		t.Fatalf("ReclaimExpiredLeases: %v", err)
+	}
+	if job := claim(t, s, store.ClaimOptions{Owner: "w2"}); job == nil || job.ID != "lost" {
+		t.Fatalf("claimed %+v after the reclaim, want lost", job)
+	}
+
+	start := now()
+	var results []*store.JobResult
+	for i, job := range jobs {
+		lease := job.LeaseOwner
+		job.LeaseOwner = ""
+		job.LeaseExpiresAt = time.Time{}
+		job.State = store.StateCompleted
+		if i == 1 {
+			job.State = store.StateDead
+		}
+		results = append(results, &store.JobResult{
+			Job:     job,
+			Attempt: &store.Attempt{JobID: job.ID, Attempt: job.Attempts, Worker: "w", StartedAt: start, FinishedAt: start, ExitCode: i},
+			Lease:   lease,
+		})
+	}
+	if err := s.FinishJobs(results); err != nil {
+		t.Fatalf("FinishJobs: %v", err)
+	}
+
+	for i, job := range jobs {
+		want := results[i].Job.State
+		if job.ID == "lost" {
+			want = store.StateProcessing
+		}
+		if got := getJob(t, s, job.ID); got.State != want {
+			t.Errorf("%s is %s, want %s", job.ID, got.State, want)
+		}
+		attempts, err := s.ListAttempts(job.ID)
+		if err != nil || len(attempts) != 1 || attempts[0].ExitCode != i {
+			t.Errorf("attempts of %s = %v, %v", job.ID, attempts, err)
+		}
+	}
+}
+
+// seedStates enqueues jobs in a spread of states across two queues.
+func seedStates(t testing.TB, s store.Store) {
+	t.Helper()
+	mk := func(id, queue string) *store.Job {
+		job := newJob(id)
+		job.Queue = queue
+		return job
+	}
+	scheduled := mk("scheduled", "emails")
+	scheduled.NextRunAt = now().Add(time.Hour)
+	enqueue(t, s, mk("done", "emails"), mk("running", "emails"), mk("pending-1", "emails"), mk("pending-2", "reports"), scheduled)
+
+	for _, id := range []string{"done", "running"} {
+		job := claim(t, s, store.ClaimOptions{Queue: "emails"})
+		if job == nil || job.ID != id {
+			t.Fatalf("claimed %+v, want %s", job, id)
+		}
+	}
+	done := getJob(t, s, "done")
+	done.State = store.StateCompleted
+	lease := done.LeaseOwner
+	done.LeaseOwner = ""
+	done.LeaseExpiresAt = time.Time{}
+	if err := s.UpdateJob(done, lease); err != nil {
+		t.Fatalf("UpdateJob: %v", err)
+	}
+}
+
+func testStatusSummary(t testing.TB, s store.Store) {
+	seedStates(t, s)
+
+	summary, err := s.GetStatusSummary("")
+	if err != nil {
+		t.Fatalf("GetStatusSummary: %v", err)
+	}
+	want := map[store.JobState]int{store.StateCompleted: 1, store.StateProcessing: 1, store.StatePending: 2, store.StateScheduled: 1}
+	if fmt.Sprint(summary) != fmt.Sprint(want) {
+		t.Errorf("GetStatusSummary = %v, want %v", summary, want)
+	}
+
+	summary, err = s.GetStatusSummary("reports")
+	if err != nil {
+		t.Fatalf("GetStatusSummary: %v", err)
+	}
+	if want := map[store.JobState]int{store.StatePending: 1}; fmt.Sprint(summary) != fmt.Sprint(want) {
+		t.Errorf("GetStatusSummary(reports) = %v, want %v", summary, want)
+	}
+}
+
+func testListJobsByState(t testing.TB, s store.Store) {
+	seedStates(t, s)
+	later := newJob("later")
+	later.Queue = "emails"
+	later.NextRunAt = now().Add(2 * time.Hour)
+	enqueue(t, s, later)
+
+	for _, c := range []struct {
+		state store.JobState
+		queue string
+		want  []string
+	}{
+		{store.StatePending, "", []string{"pending-1", "pending-2"}},
+		{store.StatePending, "emails", []string{"pending-1"}},
+		{store.StateScheduled, "", []string{"scheduled", "later"}},
+		{store.StateProcessing, "", []string{"running"}},
+		{store.StateCompleted, "reports", nil},
+	} {
+		jobs, err := s.ListJobsByState(c.state, c.queue)
+		if err != nil {
+			t.Fatalf("ListJobsByState(%s, %q): %v", c.state, c.queue, err)
+		}
+		wantIDs(t, fmt.Sprintf("ListJobsByState(%s, %q)", c.state, c.queue), jobIDs(jobs), c.want...)
+	}
+}
+
+func testQueueStats(t testing.TB, s store.Store) {
+	seedStates(t, s)
+	oldest := newJob("oldest")
+	oldest.Queue = "reports"
+	oldest.CreatedAt = now().Add(-time.Hour)
+	enqueue(t, s, oldest)
+
+	stats, err := s.GetQueueStats()
+	if err != nil {
+		t.Fatalf("GetQueueStats: %v", err)
+	}
+	if len(stats) != 2 || stats[0].Queue != "emails" || stats[1].Queue != "reports" {
+		t.Fatalf("GetQueueStats returned queues %v, want emails and reports", stats)
+	}
+	emails, reports := stats[0], stats[1]
+	want := map[store.JobState]int{store.StateCompleted: 1, store.StateProcessing: 1, store.StatePending: 1, store.StateScheduled: 1}
+	if fmt.Sprint(emails.Counts) != fmt.Sprint(want) {
+		t.Errorf("emails counts = %v, want %v", emails.Counts, want)
+	}
+	if reports.Counts[store.StatePending] != 2 {
+		t.Errorf("reports counts = %v, want 2 pending", reports.Counts)
+	}
+	if !reports.OldestPending.Equal(oldest.CreatedAt) {
+		t.Errorf("reports oldest pending = %v, want %v", reports.OldestPending, oldest.CreatedAt)
+	}
+}
+
+func testSchedules(t testing.TB, s store.Store) {
+	tick := now().Truncate(time.Second).Add(time.Minute)
+	sched := &store.Schedule{
+		Name:          "nightly",
+		CronExpr:      "0 3 * * *",
+		Timezone:      "UTC",
+		Template:      `{"command":"backup"}`,
+		MisfirePolicy: store.MisfireSkip,
+		NextRunAt:     tick,
+		CreatedAt:     now(),
+	}
+	if err := s.AddSchedule(sched); err != nil {
+		t.Fatalf("AddSchedule: %v", err)
+	}
+	if err := s.AddSchedule(sched); err == nil {
+		t.Error("adding a duplicate schedule succeeded")
+	}
+	got, err := s.GetSchedule("nightly")
+	if err != nil {
+		t.Fatalf("GetSchedule: %v", err)
+	}
+	if got.CronExpr != sched.CronExpr || got.Template != sched.Template || got.MisfirePolicy != sched.MisfirePolicy ||
+		!got.NextRunAt.Equal(tick) || !got.LastRunAt.IsZero() {
+		t.Errorf("GetSchedule = %+v, want %+v", got, sched)
+	}
+	if _, err := s.GetSchedule("missing"); !errors.Is(err, store.ErrScheduleNotFound) {
+		t.Errorf("GetSchedule of a missing schedule returned %v, want ErrScheduleNotFound", err)
+	}
+
+	if due, err := s.ListDueSchedules(tick.Add(-time.Second)); err != nil || len(due) != 0 {
+		t.Errorf("ListDueSchedules before the tick = %v, %v", due, err)
+	}
+	if due, err := s.ListDueSchedules(tick); err != nil || len(due) != 1 {
+		t.Errorf("ListDueSchedules at the tick = %v, %v", due, err)
+	}
+
+	// Only the first of two managers racing for the same tick enqueues its job.
+	next := tick.Add(24 * time.Hour)
+	job := newJob("nightly-1")
+	if ok, err := s.AdvanceSchedule("nightly", tick, next, []*store.Job{job}); err != nil || !ok {
+		t.Fatalf("AdvanceSchedule = %v, %v, want true", ok, err)
+	}
+	if ok, err := s.AdvanceSchedule("nightly", tick, next, []*store.Job{newJob("nightly-2")}); err != nil || ok {
+		t.Errorf("second AdvanceSchedule for the same tick = %v, %v, want false", ok, err)
+	}
+	getJob(t, s, "nightly-1")
+	if _, err := s.GetJob("nightly-2"); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("the losing AdvanceSchedule enqueued its job: %v", err)
+	}
+	if got, err := s.GetSchedule("nightly"); err != nil || !got.NextRunAt.Equal(next) || got.LastRunAt.IsZero() {
+		t.Errorf("advanced schedule = %+v, %v, want next run %v", got, err, next)
+	}
+
+	sched.Paused = true
+	sched.NextRunAt = next
+	if err := s.UpdateSchedule(sched); err != nil {
+		t.Fatalf("UpdateSchedule: %v", err)
+	}
+	if due, err := s.ListDueSchedules(next.Add(time.Hour)); err != nil || len(due) != 0 {
+		t.Errorf("ListDueSchedules returned paused schedules: %v, %v", due, err)
+	}
+	if ok, err := s.AdvanceSchedule("nightly", next, next.Add(time.Hour), nil); err != nil || ok {
+		t.Errorf("AdvanceSchedule of a paused schedule = %v, %v, want false", ok, err)
+	}
+
+	if err := s.AddSchedule(&store.Schedule{Name: "hourly", CronExpr: "0 * * * *", Timezone: "UTC", Template: "{}",
+		MisfirePolicy: store.MisfireSkip, NextRunAt: tick, CreatedAt: now()}); err != nil {
+		t.Fatalf("AddSchedule: %v", err)
+	}
+	all, err := s.ListSchedules()
+	if err != nil || len(all) != 2 || all[0].Name != "hourly" || all[1].Name != "nightly" {
+		t.Errorf("ListSchedules = %v, %v, want hourly and nightly", all, err)
+	}
+
+	if err := s.RemoveSchedule("nightly"); err != nil {
+		t.Fatalf("RemoveSchedule: %v", err)
+	}
+	if err := s.RemoveSchedule("nightly"); !errors.Is(err, store.ErrScheduleNotFound) {
+		t.Errorf("removing a removed schedule returned %v, want ErrScheduleNotFound", err)
+	}
+	if err := s.UpdateSchedule(sched); !errors.Is(err, store.ErrScheduleNotFound) {
+		t.Errorf("updating a removed schedule returned %v, want ErrScheduleNotFound", err)
+	}
+}
+
+func testWorkers(t testing.TB, s store.Store) {
+	start := now().Add(-time.Hour)
+	for _, w := range []*store.WorkerRecord{
+		{ID: "b:1:1", Hostname: "b", ManagerPID: 1, StartedAt: start, LastSeen: start},
+		{ID: "a:2:1", Hostname: "a", ManagerPID: 2, Queue: "emails", StartedAt: start, LastSeen: now()},
+		{ID: "a:1:1", Hostname: "a", ManagerPID: 1, StartedAt: start, LastSeen: now()},
+	} {
+		if err := s.RegisterWorker(w); err != nil {
+			t.Fatalf("RegisterWorker: %v", err)
+		}
+	}
+	if err := s.HeartbeatWorker("a:1:1", "job-1", now()); err != nil {
+		t.Fatalf("HeartbeatWorker: %v", err)
+	}
+	if err := s.HeartbeatWorker("missing", "", now()); !errors.Is(err, store.ErrWorkerNotRegistered) {
+		t.Errorf("heartbeating an unregistered worker returned %v, want ErrWorkerNotRegistered", err)
+	}
+
+	live, err := s.ListWorkers(now().Add(-time.Minute))
+	if err != nil {
+		t.Fatalf("ListWorkers: %v", err)
+	}
+	if len(live) != 2 || live[0].ID != "a:1:1" || live[1].ID != "a:2:1" {
+		t.Fatalf("ListWorkers = %v, want a:1:1 and a:2:1", live)
+	}
+	if live[0].CurrentJob != "job-1" || live[1].Queue != "emails" {
+		t.Errorf("ListWorkers = %+v, %+v", live[0], live[1])
+	}
+
+	if n, err := s.PruneWorkers(now().Add(-time.Minute)); err != nil || n != 1 {
+		t.Errorf("PruneWorkers = %d, %v, want 1", n, err)
+	}
+	if err := s.UnregisterWorker("a:2:1"); err != nil {
+		t.Fatalf("UnregisterWorker: %v", err)
+	}
+	if all, err := s.ListWorkers(time.Time{}); err != nil || len(all) != 1 || all[0].ID != "a:1:1" {
+		t.Errorf("ListWorkers after pruning and unregistering = %v, %v, want a:1:1", all, err)
+	}
+}
+
+// testConcurrentClaims has several goroutines claim through the same store. Backends that
+// can be opened more than once should also be checked with NoDoubleClaims.
+func testConcurrentClaims(t testing.TB, s store.Store) {
+	const jobs, workers = 200, 8
+	for i := 0; i < jobs; i++ {
+		enqueue(t, s, newJob(fmt.Sprintf("job-%d", i)))
+	}
+
+	var (
+		mu     sync.Mutex
+		claims = make(map[string]string)
+		wg     sync.WaitGroup
+	)
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func(owner string) {
+			defer wg.Done()
+			for {
+				job, err := s.FindAndLockJob(store.ClaimOptions{Owner: owner, Lease: time.Minute})
+				if err != nil {
+					// Writers may be turned away under contention; try again.
+					time.Sleep(time.Millisecond)
+					continue
+				}
+				if job == nil {
+					return
+				}
+				mu.Lock()
+				if prev, ok := claims[job.ID]; ok {
+					t.Errorf("job %s claimed by %s after already being claimed by %s", job.ID, owner, prev)
+				}
+				claims[job.ID] = owner
+				mu.Unlock()
+			}
+		}(fmt.Sprintf("worker-%d", w))
+	}
+	wg.Wait()
+
+	if len(claims) != jobs {
+		t.Errorf("%d of %d jobs claimed", len(claims), jobs)
+	}
+	summary, err := s.GetStatusSummary("")
+	if err != nil {
+		t.Fatalf("GetStatusSummary: %v", err)
+	}
+	if summary[store.StateProcessing] != jobs {
+		t.Errorf("GetStatusSummary = %v, want %d processing", summary, jobs)
+	}
+}
@@ -0,0 +1,45 @@
+package worker
+
+import (
+	"math"
+	"math/rand"
+	"time"
+
+	"github.com/Trishvan/queuectl/internal/store"
+)
+
+// maxDelaySeconds keeps retry delays within what a time.Duration can represent.
+const maxDelaySeconds = float64(math.MaxInt64 / int64(time.Second))
+
+// retryDelay computes how long to wait before the next attempt of job, using the job's
+// retry policy and falling back to defaultBase when the job does not set a base.
+func retryDelay(job *store.Job, defaultBase float64) time.Duration {
+	base := job.BackoffBase
+	if base == 0 {
+		base = defaultBase
+	}
+
+	var seconds float64
+	switch job.Backoff {
+	case store.BackoffLinear:
+		seconds = base * float64(job.Attempts)
+	case store.BackoffFixed:
+		seconds = base
+	default:
+		seconds = math.Pow(base, float64(job.Attempts))
+	}
+	if seconds > maxDelaySeconds || math.IsNaN(seconds) {
+		seconds = maxDelaySeconds
+	}
+	delay := time.Duration(seconds * float64(time.Second))
+
+	if job.MaxBackoff > 0 && delay > job.MaxBackoff {
+		delay = job.MaxBackoff
+	}
+	if job.Jitter > 0 {
+		// Shorten the delay by a random fraction, up to Jitter, so jobs that failed
+		// together do not all retry at the same moment.
+		delay -= time.Duration(rand.Float64() * job.Jitter * float64(delay))
+	}
+	return delay
+}
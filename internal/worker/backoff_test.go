@@ -0,0 +1,74 @@
+package worker
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/Trishvan/queuectl/internal/store"
+)
+
+func TestRetryDelay(t *testing.T) {
+	maxDelay := time.Duration(maxDelaySeconds * float64(time.Second))
+	cases := []struct {
+		name string
+		job  store.Job
+		want time.Duration
+	}{
+		{"exponential", store.Job{BackoffBase: 2, Attempts: 3}, 8 * time.Second},
+		{"exponential by name", store.Job{Backoff: store.BackoffExponential, BackoffBase: 3, Attempts: 2}, 9 * time.Second},
+		{"linear", store.Job{Backoff: store.BackoffLinear, BackoffBase: 5, Attempts: 3}, 15 * time.Second},
+		{"fixed", store.Job{Backoff: store.BackoffFixed, BackoffBase: 7, Attempts: 3}, 7 * time.Second},
+		{"default base", store.Job{Attempts: 2}, 4 * time.Second},
+		{"fractional base", store.Job{Backoff: store.BackoffFixed, BackoffBase: 0.5, Attempts: 1}, 500 * time.Millisecond},
+		{"capped by max backoff", store.Job{BackoffBase: 2, Attempts: 10, MaxBackoff: time.Minute}, time.Minute},
+		{"under max backoff", store.Job{BackoffBase: 2, Attempts: 3, MaxBackoff: time.Minute}, 8 * time.Second},
+		{"overflow capped by max backoff", store.Job{BackoffBase: 10, Attempts: 400, MaxBackoff: time.Hour}, time.Hour},
+		{"overflow without max backoff", store.Job{BackoffBase: 10, Attempts: 400}, maxDelay},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if got := retryDelay(&c.job, 2); got != c.want {
+				t.Errorf("retryDelay = %v, want %v", got, c.want)
+			}
+		})
+	}
+}
+
+func TestRetryDelayJitter(t *testing.T) {
+	cases := []struct {
+		name   string
+		job    store.Job
+		max    time.Duration
+		jitter float64
+	}{
+		{"exponential", store.Job{BackoffBase: 2, Attempts: 5}, 32 * time.Second, 0.5},
+		{"capped", store.Job{BackoffBase: 2, Attempts: 20, MaxBackoff: time.Minute}, time.Minute, 0.25},
+		{"full jitter", store.Job{Backoff: store.BackoffFixed, BackoffBase: 10}, 10 * time.Second, 1},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			c.job.Jitter = c.jitter
+			min := c.max - time.Duration(c.jitter*float64(c.max))
+			lowest, highest := time.Duration(math.MaxInt64), time.Duration(0)
+			for i := 0; i < 1000; i++ {
+				got := retryDelay(&c.job, 2)
+				if got < min || got > c.max {
+					t.Fatalf("retryDelay = %v, want between %v and %v", got, min, c.max)
+				}
+				if got < lowest {
+					lowest = got
+				}
+				if got > highest {
+					highest = got
+				}
+			}
+			// Jitter spreads the delays rather than shifting them all by one amount.
+			if highest-lowest < (c.max-min)/2 {
+				t.Errorf("1000 delays only spread from %v to %v", lowest, highest)
+			}
+		})
+	}
+}
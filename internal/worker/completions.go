@@ -0,0 +1,117 @@
+package worker
+
+import (
+	"log"
+	"time"
+
+	"github.com/Trishvan/queuectl/internal/store"
+)
+
+const (
+	// completionBatchSize is the most results written in one transaction, and
+	// completionFlushInterval the longest a result waits to be written.
+	completionBatchSize     = 100
+	completionFlushInterval = 20 * time.Millisecond
+)
+
+// CompletionWriter saves the results of attempts in batches, one transaction per batch,
+// so that short jobs are not held back by a commit each. A job stays leased to its
+// worker until its result is written; if the manager dies first, the reaper reclaims it.
+type CompletionWriter struct {
+	Store store.Store
+
+	results chan *store.JobResult
+	done    chan struct{}
+	flushed func()
+}
+
+// NewCompletionWriter starts a writer. Close must be called to write the final batch.
+// flushed, if not nil, is called after each batch is written: finished jobs can let others
+// run, such as jobs waiting for their concurrency key.
+func NewCompletionWriter(s store.Store, flushed func()) *CompletionWriter {
+	c := &CompletionWriter{
+		Store:   s,
+		results: make(chan *store.JobResult, completionBatchSize),
+		done:    make(chan struct{}),
+		flushed: flushed,
+	}
+	go c.run()
+	return c
+}
+
+// Submit queues a result to be written. It blocks only while the writer is a full batch
+// behind.
+func (c *CompletionWriter) Submit(r *store.JobResult) {
+	c.results <- r
+}
+
+// Close writes any queued results and stops the writer. Submit must not be called after.
+func (c *CompletionWriter) Close() {
+	close(c.results)
+	<-c.done
+}
+
+func (c *CompletionWriter) run() {
+	defer close(c.done)
+	var batch []*store.JobResult
+	timer := time.NewTimer(completionFlushInterval)
+	stopTimer(timer)
+
+	for {
+		select {
+		case r, ok := <-c.results:
+			if !ok {
+				c.flush(batch)
+				return
+			}
+			batch = append(batch, r)
+			if len(batch) == 1 {
+				timer.Reset(completionFlushInterval)
+			}
+			if len(batch) >= completionBatchSize {
+				stopTimer(timer)
+				c.flush(batch)
+				batch = nil
+			}
+		case <-timer.C:
+			c.flush(batch)
+			batch = nil
+		}
+	}
+}
+
+func (c *CompletionWriter) flush(batch []*store.JobResult) {
+	if len(batch) == 0 {
+		return
+	}
+	if c.flushed != nil {
+		defer c.flushed()
+	}
+	err := c.Store.FinishJobs(batch)
+	if err == nil {
+		return
+	}
+
+	// Write the results one by one so a single bad result does not lose the others.
+	log.Printf("Completions: Error writing %d results, retrying one at a time: %v", len(batch), err)
+	for _, r := range batch {
+		if r.Attempt != nil {
+			if err := c.Store.RecordAttempt(r.Attempt); err != nil {
+				log.Printf("Completions: Error recording attempt %d of job %s: %v", r.Attempt.Attempt, r.Job.ID, err)
+			}
+		}
+		if err := c.Store.UpdateJob(r.Job, r.Lease); err != nil {
+			log.Printf("Completions: Error updating job %s: %v", r.Job.ID, err)
+		}
+	}
+}
+
+// stopTimer stops t and drains its channel, so it can be Reset safely.
+func stopTimer(t *time.Timer) {
+	if !t.Stop() {
+		select {
+		case <-t.C:
+		default:
+		}
+	}
+}
@@ -0,0 +1,250 @@
+package worker
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/Trishvan/queuectl/internal/store"
+)
+
+// Control commands accepted on a manager's control socket.
+const (
+	ControlScale  = "scale"
+	ControlPause  = "pause"
+	ControlResume = "resume"
+	ControlDrain  = "drain"
+	ControlInfo   = "info"
+	// ControlNotify tells the manager that jobs have been enqueued. It is sent by the CLI
+	// and the API server so that local jobs start without waiting for a poll, and so that
+	// a manager serving metrics can count them.
+	ControlNotify = "notify"
+)
+
+// controlTimeout bounds every control request except drain, which waits for the
+// manager's workers to finish.
+const controlTimeout = 10 * time.Second
+
+// ControlRequest is a command sent to a running manager. Each connection to the control
+// socket carries one JSON encoded request and its response.
+type ControlRequest struct {
+	Command  string         `json:"command"`
+	Queue    string         `json:"queue,omitempty"`    // scale only
+	Count    int            `json:"count,omitempty"`    // scale only
+	Enqueued map[string]int `json:"enqueued,omitempty"` // notify only: jobs enqueued, by queue
+}
+
+// ControlResponse is a manager's reply to a ControlRequest. Info describes the manager
+// after the command has been applied. Counted is set when the manager has counted the
+// jobs of a notify request in its metrics.
+type ControlResponse struct {
+	Error   string       `json:"error,omitempty"`
+	Info    *ManagerInfo `json:"info,omitempty"`
+	Counted bool         `json:"counted,omitempty"`
+}
+
+// ManagerInfo describes a running manager.
+type ManagerInfo struct {
+	Name      string         `json:"name"`
+	PID       int            `json:"pid"`
+	StartedAt time.Time      `json:"started_at"`
+	Paused    bool           `json:"paused"`
+	Pools     []Pool         `json:"pools"`
+	Workers   []WorkerStatus `json:"workers"`
+}
+
+// WorkerStatus describes what one of a manager's workers is doing.
+type WorkerStatus struct {
+	ID         int       `json:"id"`
+	Owner      string    `json:"owner"`
+	Queue      string    `json:"queue"`
+	CurrentJob string    `json:"current_job"` // Empty while idle
+	StartedAt  time.Time `json:"started_at"`
+	Processed  int       `json:"processed"` // Jobs run to completion or failure
+}
+
+// Status reports the worker's current job and how many jobs it has processed.
+func (w *Worker) Status() WorkerStatus {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return WorkerStatus{
+		ID:         w.ID,
+		Owner:      w.Owner,
+		Queue:      w.Queue,
+		CurrentJob: w.currentJob,
+		StartedAt:  w.startedAt,
+		Processed:  w.processed,
+	}
+}
+
+func getSocketPath(name string) (string, error) {
+	dir, err := pidDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, name+".sock"), nil
+}
+
+// controlListener accepts control connections until it is closed.
+type controlListener struct {
+	ln   net.Listener
+	path string
+	wg   sync.WaitGroup
+}
+
+// listenControl opens the manager's control socket. The manager holds its PID file, so
+// any socket left at the path belongs to a dead process and is removed.
+func (m *Manager) listenControl() (*controlListener, error) {
+	path, err := getSocketPath(m.Name)
+	if err != nil {
+		return nil, fmt.Errorf("error getting control socket path: %w", err)
+	}
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("failed to remove stale control socket: %w", err)
+	}
+	ln, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open control socket: %w", err)
+	}
+	if err := os.Chmod(path, 0600); err != nil {
+		ln.Close()
+		return nil, fmt.Errorf("failed to restrict control socket: %w", err)
+	}
+
+	cl := &controlListener{ln: ln, path: path}
+	cl.wg.Add(1)
+	go func() {
+		defer cl.wg.Done()
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return // Closed
+			}
+			cl.wg.Add(1)
+			go func() {
+				defer cl.wg.Done()
+				m.handleControl(conn)
+			}()
+		}
+	}()
+	return cl, nil
+}
+
+// Close stops accepting control connections, waits for those in progress and removes
+// the socket.
+func (cl *controlListener) Close() {
+	cl.ln.Close()
+	cl.wg.Wait()
+	os.Remove(cl.path)
+}
+
+func (m *Manager) handleControl(conn net.Conn) {
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(controlTimeout))
+
+	var req ControlRequest
+	if err := json.NewDecoder(bufio.NewReader(conn)).Decode(&req); err != nil {
+		log.Printf("Control: Invalid request: %v", err)
+		return
+	}
+
+	resp := &ControlResponse{}
+	switch req.Command {
+	case ControlScale:
+		if err := m.Scale(req.Queue, req.Count); err != nil {
+			resp.Error = err.Error()
+		}
+	case ControlPause:
+		m.Pause()
+	case ControlResume:
+		m.Resume()
+	case ControlDrain:
+		conn.SetDeadline(time.Time{})
+		<-m.Drain()
+	case ControlInfo:
+	case ControlNotify:
+		m.Notify()
+		if len(req.Enqueued) > 0 {
+			resp.Counted = m.metrics.jobsEnqueued(req.Enqueued)
+		}
+	default:
+		resp.Error = fmt.Sprintf("unknown command %q", req.Command)
+	}
+	if resp.Error == "" && req.Command != ControlDrain && req.Command != ControlNotify {
+		resp.Info = m.Info()
+	}
+
+	if err := json.NewEncoder(conn).Encode(resp); err != nil {
+		log.Printf("Control: Error writing response: %v", err)
+	}
+}
+
+// SendControl sends req to the named manager on this host and returns its state after
+// the command. A drain request returns once the manager's workers have all exited, with
+// no state.
+func SendControl(name string, req ControlRequest) (*ManagerInfo, error) {
+	path, err := getSocketPath(name)
+	if err != nil {
+		return nil, fmt.Errorf("error getting control socket path: %w", err)
+	}
+	conn, err := net.Dial("unix", path)
+	if err != nil {
+		return nil, fmt.Errorf("manager %s is not running or not reachable: %w", name, err)
+	}
+	defer conn.Close()
+	if req.Command != ControlDrain {
+		conn.SetDeadline(time.Now().Add(controlTimeout))
+	}
+
+	if err := json.NewEncoder(conn).Encode(req); err != nil {
+		return nil, fmt.Errorf("failed to send request: %w", err)
+	}
+	var resp ControlResponse
+	if err := json.NewDecoder(conn).Decode(&resp); err != nil {
+		return nil, fmt.Errorf("failed to read response: %w", err)
+	}
+	if resp.Error != "" {
+		return nil, fmt.Errorf("%s", resp.Error)
+	}
+	return resp.Info, nil
+}
+
+// notifyTimeout bounds how long NotifyManagers waits on a manager that is not responding.
+const notifyTimeout = 250 * time.Millisecond
+
+// NotifyManagers wakes every manager on this host after jobs have been enqueued. enqueued
+// are the jobs just enqueued, if any; they are offered to the managers in turn until one
+// that serves metrics counts them. It is best effort: managers that cannot be reached find
+// the jobs at their next poll, and jobs no manager counts are not counted.
+func NotifyManagers(enqueued ...*store.Job) {
+	names, err := ListManagers()
+	if err != nil {
+		return
+	}
+	counts := countByQueue(enqueued)
+	for _, name := range names {
+		path, err := getSocketPath(name)
+		if err != nil {
+			continue
+		}
+		conn, err := net.DialTimeout("unix", path, notifyTimeout)
+		if err != nil {
+			continue
+		}
+		conn.SetDeadline(time.Now().Add(notifyTimeout))
+		if err := json.NewEncoder(conn).Encode(ControlRequest{Command: ControlNotify, Enqueued: counts}); err == nil {
+			// Wait for the reply so the manager does not see the connection drop mid-request.
+			var resp ControlResponse
+			if json.NewDecoder(conn).Decode(&resp) == nil && resp.Counted {
+				counts = nil
+			}
+		}
+		conn.Close()
+	}
+}
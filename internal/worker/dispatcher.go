@@ -0,0 +1,196 @@
+package worker
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/Trishvan/queuectl/internal/config"
+	"github.com/Trishvan/queuectl/internal/store"
+)
+
+const (
+	// minPollInterval is how soon the dispatcher looks for jobs again after finding none,
+	// and maxPollInterval is as far as that delay grows while the queues stay empty. Local
+	// enqueues wake the dispatcher straight away, so polling only matters for jobs that
+	// become due later or are enqueued from another host.
+	minPollInterval = 50 * time.Millisecond
+	maxPollInterval = 1 * time.Second
+)
+
+// Dispatcher claims jobs on behalf of a manager's idle workers and hands them over, so an
+// idle manager polls the store once per interval rather than once per worker.
+type Dispatcher struct {
+	Store store.Store
+	Cfg   *config.Config
+	// Owner identifies the manager on the leases of the jobs the dispatcher claims. Each
+	// claim leases its jobs to Owner followed by the claim's number, as in host:pid/17, so a
+	// job claimed again is never held under the lease of an earlier claim. Workers renew
+	// the leases of the jobs they are handed under the job's LeaseOwner.
+	Owner string
+	// Paused, if set, is checked before every claim. Nothing is claimed while it returns true.
+	Paused func() bool
+
+	requests chan *jobRequest
+	wake     chan struct{}
+	claims   int // Claims made so far, numbering their leases
+}
+
+// jobRequest is an idle worker waiting for a job.
+type jobRequest struct {
+	worker *Worker
+	reply  chan *store.Job // Buffered, so the dispatcher never blocks on it
+
+	// The dispatcher claims under mu, and the worker sets abandoned under mu when it stops
+	// waiting. A job is therefore never claimed for a worker that has gone away.
+	mu        sync.Mutex
+	abandoned bool
+}
+
+func NewDispatcher(s store.Store, cfg *config.Config) *Dispatcher {
+	hostname, err := os.Hostname()
+	if err != nil {
+		hostname = "unknown"
+	}
+	return &Dispatcher{
+		Store:    s,
+		Cfg:      cfg,
+		Owner:    fmt.Sprintf("%s:%d", hostname, os.Getpid()),
+		requests: make(chan *jobRequest),
+		wake:     make(chan struct{}, 1),
+	}
+}
+
+// Wake makes the dispatcher look for jobs now, e.g. because one has just been enqueued.
+func (d *Dispatcher) Wake() {
+	select {
+	case d.wake <- struct{}{}:
+	default: // A wakeup is already pending
+	}
+}
+
+// Run hands out jobs until ctx is cancelled.
+func (d *Dispatcher) Run(ctx context.Context) {
+	waiting := make(map[string][]*jobRequest) // Idle workers by queue, longest waiting first
+	interval := minPollInterval
+	timer := time.NewTimer(interval)
+	defer timer.Stop()
+
+	for {
+		claimed := false
+		if d.Paused == nil || !d.Paused() {
+			claimed = d.dispatch(waiting)
+		}
+		if claimed {
+			interval = minPollInterval
+		}
+
+		// Only poll while some worker is waiting for a job.
+		var poll <-chan time.Time
+		if len(waiting) > 0 {
+			stopTimer(timer)
+			timer.Reset(interval)
+			poll = timer.C
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case req := <-d.requests:
+			waiting[req.worker.Queue] = append(waiting[req.worker.Queue], req)
+		case <-d.wake:
+			interval = minPollInterval
+		case <-poll:
+			interval *= 2
+			if interval > maxPollInterval {
+				interval = maxPollInterval
+			}
+		}
+	}
+}
+
+// dispatch claims a batch of jobs for the workers waiting on each queue. It reports
+// whether any job was claimed.
+func (d *Dispatcher) dispatch(waiting map[string][]*jobRequest) bool {
+	claimed := false
+	for queue, reqs := range waiting {
+		n, remaining := d.serveQueue(queue, reqs)
+		claimed = claimed || n > 0
+		if len(remaining) == 0 {
+			delete(waiting, queue)
+		} else {
+			waiting[queue] = remaining
+		}
+	}
+	return claimed
+}
+
+// serveQueue claims up to one job per request waiting on queue and hands them out,
+// longest waiting first. It returns the number of jobs claimed and the requests left
+// waiting.
+func (d *Dispatcher) serveQueue(queue string, reqs []*jobRequest) (int, []*jobRequest) {
+	// Hold every request while claiming, so that none is abandoned with a job on its way.
+	var live []*jobRequest
+	for _, req := range reqs {
+		req.mu.Lock()
+		if req.abandoned {
+			req.mu.Unlock()
+			continue
+		}
+		live = append(live, req)
+	}
+	defer func() {
+		for _, req := range live {
+			req.mu.Unlock()
+		}
+	}()
+	if len(live) == 0 {
+		return 0, nil
+	}
+
+	d.claims++
+	jobs, err := d.Store.ClaimJobs(store.ClaimOptions{
+		Queue:         queue,
+		Owner:         fmt.Sprintf("%s/%d", d.Owner, d.claims),
+		Lease:         d.Cfg.LeaseDuration.Duration,
+		PriorityAging: d.Cfg.PriorityAging.Duration,
+	}, len(live))
+	if err != nil {
+		log.Printf("Dispatcher: Error claiming jobs: %v", err)
+		return 0, live
+	}
+	for i, job := range jobs {
+		live[i].reply <- job
+	}
+	return len(jobs), live[len(jobs):]
+}
+
+// next blocks until the dispatcher hands w a job, or returns nil once ctx is done.
+func (d *Dispatcher) next(ctx context.Context, w *Worker) *store.Job {
+	req := &jobRequest{worker: w, reply: make(chan *store.Job, 1)}
+	select {
+	case d.requests <- req:
+	case <-ctx.Done():
+		return nil
+	}
+
+	select {
+	case job := <-req.reply:
+		return job
+	case <-ctx.Done():
+		req.mu.Lock()
+		defer req.mu.Unlock()
+		req.abandoned = true
+		select {
+		case job := <-req.reply:
+			// Claimed just as we gave up. The job is leased to this worker, so run it
+			// rather than leave it for the reaper.
+			return job
+		default:
+			return nil
+		}
+	}
+}
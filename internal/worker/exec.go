@@ -0,0 +1,86 @@
+package worker
+
+import (
+	"os/exec"
+	"syscall"
+	"time"
+
+	"github.com/Trishvan/queuectl/internal/store"
+)
+
+// runCommand runs cmd in its own process group and waits for it. If timeout is positive
+// and passes first, or a reason to stop arrives on stop, the whole group gets SIGTERM and,
+// if it is still running after grace, SIGKILL. Signalling the group also reaches anything
+// the shell started. The returned reason says why the command was killed, and is empty if
+// it was not.
+func runCommand(cmd *exec.Cmd, timeout, grace time.Duration, stop <-chan store.FailureReason) (store.FailureReason, error) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	if err := cmd.Start(); err != nil {
+		return "", err
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		done <- cmd.Wait()
+	}()
+
+	var deadline <-chan time.Time
+	if timeout > 0 {
+		timer := time.NewTimer(timeout)
+		defer timer.Stop()
+		deadline = timer.C
+	}
+
+	var reason store.FailureReason
+	select {
+	case err := <-done:
+		return "", err
+	case <-deadline:
+		reason = store.ReasonTimedOut
+	case reason = <-stop:
+	}
+
+	killGroup(cmd, syscall.SIGTERM)
+	select {
+	case err := <-done:
+		return reason, err
+	case <-time.After(grace):
+	}
+	killGroup(cmd, syscall.SIGKILL)
+	return reason, <-done
+}
+
+// killGroup sends sig to the process group led by cmd's process.
+func killGroup(cmd *exec.Cmd, sig syscall.Signal) {
+	// The group may already be gone; there is nothing useful to do with the error.
+	_ = syscall.Kill(-cmd.Process.Pid, sig)
+}
+
+// recordExit fills in the exit code, signal, error and failure reason of an attempt
+// from the finished command. killReason is the reason runCommand killed it, if any.
+func recordExit(attempt *store.Attempt, cmd *exec.Cmd, killReason store.FailureReason, runErr error) {
+	if runErr != nil {
+		attempt.Error = runErr.Error()
+	}
+
+	if cmd.ProcessState == nil {
+		// The command never started.
+		attempt.ExitCode = -1
+		attempt.Reason = store.ReasonStartError
+		return
+	}
+
+	attempt.ExitCode = cmd.ProcessState.ExitCode()
+	if status, ok := cmd.ProcessState.Sys().(syscall.WaitStatus); ok && status.Signaled() {
+		attempt.Signal = status.Signal().String()
+	}
+
+	switch {
+	case killReason != "":
+		attempt.Reason = killReason
+	case attempt.Signal != "":
+		attempt.Reason = store.ReasonSignal
+	case attempt.ExitCode != 0:
+		attempt.Reason = store.ReasonExitCode
+	}
+}
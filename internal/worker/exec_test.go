@@ -0,0 +1,63 @@
+package worker
+
+import (
+	"bytes"
+	"os/exec"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Trishvan/queuectl/internal/store"
+)
+
+func TestRunCommand(t *testing.T) {
+	cases := []struct {
+		name     string
+		command  string
+		timeout  time.Duration
+		stop     store.FailureReason // Sent straight away if not empty
+		reason   store.FailureReason // The reason recorded on the attempt
+		signal   string
+		exitCode int
+	}{
+		{"success", "exit 0", time.Minute, "", "", "", 0},
+		{"failure", "exit 3", time.Minute, "", store.ReasonExitCode, "", 3},
+		{"killed by a signal", "kill -KILL $$", time.Minute, "", store.ReasonSignal, "killed", -1},
+		// The background child holds stdout open: if it outlived its shell, waiting for
+		// the command would wait for it as well, and its output would be recorded.
+		{"timeout kills the process group", "(sleep 2; echo late) & sleep 30", 100 * time.Millisecond, "",
+			store.ReasonTimedOut, "terminated", -1},
+		{"SIGKILL after the grace period", "trap '' TERM; (sleep 2; echo late) & sleep 30", 100 * time.Millisecond, "",
+			store.ReasonTimedOut, "killed", -1},
+		{"cancelled", "(sleep 2; echo late) & sleep 30", time.Minute, store.ReasonCancelled,
+			store.ReasonCancelled, "terminated", -1},
+		{"lease lost", "(sleep 2; echo late) & sleep 30", time.Minute, store.ReasonLeaseLost,
+			store.ReasonLeaseLost, "terminated", -1},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			var stdout bytes.Buffer
+			cmd := exec.Command("sh", "-c", c.command)
+			cmd.Stdout = &stdout
+			stop := make(chan store.FailureReason, 1)
+			if c.stop != "" {
+				stop <- c.stop
+			}
+
+			start := time.Now()
+			killReason, err := runCommand(cmd, c.timeout, 200*time.Millisecond, stop)
+			elapsed := time.Since(start)
+			attempt := &store.Attempt{}
+			recordExit(attempt, cmd, killReason, err)
+
+			if attempt.Reason != c.reason || attempt.Signal != c.signal || attempt.ExitCode != c.exitCode {
+				t.Errorf("attempt ended with reason %q, signal %q, exit code %d; want %q, %q, %d",
+					attempt.Reason, attempt.Signal, attempt.ExitCode, c.reason, c.signal, c.exitCode)
+			}
+			if strings.Contains(stdout.String(), "late") || elapsed > time.Second {
+				t.Errorf("command took %v with output %q; its child was not killed", elapsed, stdout.String())
+			}
+		})
+	}
+}
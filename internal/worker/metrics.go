@@ -0,0 +1,158 @@
+package worker
+
+import (
+	"log"
+	"time"
+
+	"github.com/Trishvan/queuectl/internal/metrics"
+	"github.com/Trishvan/queuectl/internal/store"
+)
+
+// Metrics are the Prometheus metrics served by a manager. Job counts and the oldest
+// pending job are read from the store when scraped, so they cover every queue and
+// every manager. The other metrics only count the work done by this manager's workers.
+//
+// A nil *Metrics is valid and records nothing.
+type Metrics struct {
+	Registry *metrics.Registry
+	store    store.Store
+
+	jobs          *metrics.GaugeVec
+	oldestPending *metrics.GaugeVec
+	enqueued      *metrics.CounterVec
+	completed     *metrics.CounterVec
+	failed        *metrics.CounterVec
+	dead          *metrics.CounterVec
+	queueWait     *metrics.HistogramVec
+	duration      *metrics.HistogramVec
+	workers       *metrics.GaugeVec
+}
+
+func NewMetrics(s store.Store) *Metrics {
+	r := metrics.NewRegistry()
+	m := &Metrics{
+		Registry: r,
+		store:    s,
+		jobs: r.NewGaugeVec("queuectl_jobs",
+			"Number of jobs by queue and state.", "queue", "state"),
+		oldestPending: r.NewGaugeVec("queuectl_oldest_pending_job_age_seconds",
+			"Age of the oldest pending job that is ready to run, or 0 if there is none.", "queue"),
+		enqueued: r.NewCounterVec("queuectl_jobs_enqueued_total",
+			"Jobs enqueued by this manager's schedules, or by the CLI or API server on this host.", "queue"),
+		completed: r.NewCounterVec("queuectl_jobs_completed_total",
+			"Jobs completed by this manager's workers.", "queue"),
+		failed: r.NewCounterVec("queuectl_jobs_failed_total",
+			"Failed attempts run by this manager's workers.", "queue"),
+		dead: r.NewCounterVec("queuectl_jobs_dead_total",
+			"Jobs moved to the DLQ by this manager's workers.", "queue"),
+		queueWait: r.NewHistogramVec("queuectl_job_queue_wait_seconds",
+			"Time from a job's creation until it was claimed.", metrics.DefaultBuckets, "queue"),
+		duration: r.NewHistogramVec("queuectl_job_duration_seconds",
+			"Time taken to run an attempt of a job.", metrics.DefaultBuckets, "queue"),
+		workers: r.NewGaugeVec("queuectl_workers",
+			"Number of this manager's workers that are busy or idle, by the queue they serve.", "queue", "state"),
+	}
+	r.BeforeWrite(m.refresh)
+	return m
+}
+
+// refresh reloads the metrics mirrored from the store.
+func (m *Metrics) refresh() {
+	stats, err := m.store.GetQueueStats()
+	if err != nil {
+		log.Printf("Metrics: Error reading queue stats: %v", err)
+		return
+	}
+
+	now := time.Now().UTC()
+	m.jobs.Reset()
+	m.oldestPending.Reset()
+	for _, qs := range stats {
+		for state, count := range qs.Counts {
+			m.jobs.Set(float64(count), qs.Queue, string(state))
+		}
+
+		age := 0.0
+		if !qs.OldestPending.IsZero() {
+			age = now.Sub(qs.OldestPending).Seconds()
+		}
+		m.oldestPending.Set(age, qs.Queue)
+	}
+}
+
+// jobsEnqueued counts enqueued jobs, given as the number in each queue. It reports
+// whether they were counted.
+func (m *Metrics) jobsEnqueued(counts map[string]int) bool {
+	if m == nil {
+		return false
+	}
+	for queue, n := range counts {
+		m.enqueued.Add(float64(n), queue)
+	}
+	return true
+}
+
+// countByQueue returns the number of jobs in each queue.
+func countByQueue(jobs []*store.Job) map[string]int {
+	if len(jobs) == 0 {
+		return nil
+	}
+	counts := make(map[string]int)
+	for _, job := range jobs {
+		counts[job.Queue]++
+	}
+	return counts
+}
+
+func (m *Metrics) workerStarted(queue string) {
+	if m == nil {
+		return
+	}
+	m.workers.Add(1, queue, "idle")
+	m.workers.Add(0, queue, "busy")
+}
+
+func (m *Metrics) workerStopped(queue string) {
+	if m == nil {
+		return
+	}
+	m.workers.Add(-1, queue, "idle")
+}
+
+// jobClaimed marks a worker serving queue busy with job.
+func (m *Metrics) jobClaimed(queue string, job *store.Job) {
+	if m == nil {
+		return
+	}
+	m.queueWait.Observe(time.Since(job.CreatedAt).Seconds(), job.Queue)
+	m.workers.Add(-1, queue, "idle")
+	m.workers.Add(1, queue, "busy")
+}
+
+// jobReleased marks a worker serving queue idle again.
+func (m *Metrics) jobReleased(queue string) {
+	if m == nil {
+		return
+	}
+	m.workers.Add(-1, queue, "busy")
+	m.workers.Add(1, queue, "idle")
+}
+
+// attemptFinished records the outcome of an attempt, once processJob has decided the
+// job's next state.
+func (m *Metrics) attemptFinished(job *store.Job, attempt *store.Attempt) {
+	if m == nil {
+		return
+	}
+	m.duration.Observe(attempt.FinishedAt.Sub(attempt.StartedAt).Seconds(), job.Queue)
+
+	switch job.State {
+	case store.StateCompleted:
+		m.completed.Inc(job.Queue)
+	case store.StatePending:
+		m.failed.Inc(job.Queue)
+	case store.StateDead:
+		m.failed.Inc(job.Queue)
+		m.dead.Inc(job.Queue)
+	}
+}
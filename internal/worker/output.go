@@ -0,0 +1,41 @@
+package worker
+
+import (
+	"bytes"
+	"fmt"
+)
+
+// cappedBuffer keeps at most limit bytes of a command's output and counts the rest,
+// so a chatty job cannot fill the database. Writes never fail, so the child process
+// is not disturbed by a closed pipe once the cap is reached.
+type cappedBuffer struct {
+	limit     int
+	buf       bytes.Buffer
+	truncated int
+}
+
+func newCappedBuffer(limit int) *cappedBuffer {
+	return &cappedBuffer{limit: limit}
+}
+
+func (b *cappedBuffer) Write(p []byte) (int, error) {
+	room := b.limit - b.buf.Len()
+	if room < 0 {
+		room = 0
+	}
+	if len(p) > room {
+		b.buf.Write(p[:room])
+		b.truncated += len(p) - room
+	} else {
+		b.buf.Write(p)
+	}
+	return len(p), nil
+}
+
+// String returns the captured output, followed by a marker if anything was dropped.
+func (b *cappedBuffer) String() string {
+	if b.truncated == 0 {
+		return b.buf.String()
+	}
+	return fmt.Sprintf("%s\n... [truncated %d bytes]", b.buf.String(), b.truncated)
+}
@@ -0,0 +1,180 @@
+package worker
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"github.com/Trishvan/queuectl/internal/config"
+)
+
+// DefaultManagerName is the name of a manager started without --name.
+const DefaultManagerName = "default"
+
+var validManagerName = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_.-]*$`)
+
+// ValidateManagerName checks that name can be used as a manager name. Names end up in
+// file names, so they are limited to letters, digits, '_', '.' and '-'.
+func ValidateManagerName(name string) error {
+	if !validManagerName.MatchString(name) {
+		return fmt.Errorf("invalid manager name %q: use letters, digits, '_', '.' and '-'", name)
+	}
+	return nil
+}
+
+// pidDir returns the directory holding the PID files of the managers on this host. It is
+// per host so that managers on several machines can share a data directory.
+func pidDir() (string, error) {
+	dataDir, err := config.GetDataDir()
+	if err != nil {
+		return "", err
+	}
+	hostname, err := os.Hostname()
+	if err != nil {
+		hostname = "unknown"
+	}
+	return filepath.Join(dataDir, "managers", hostname), nil
+}
+
+func getPidFilePath(name string) (string, error) {
+	dir, err := pidDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, name+".pid"), nil
+}
+
+// acquirePidFile writes the PID file for the named manager and returns its path. It fails
+// if another live process holds the name, and replaces the file if its process is gone.
+func acquirePidFile(name string) (string, error) {
+	pidFile, err := getPidFilePath(name)
+	if err != nil {
+		return "", fmt.Errorf("error getting PID file path: %w", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(pidFile), config.DefaultDataDirPerms); err != nil {
+		return "", err
+	}
+
+	for {
+		f, err := os.OpenFile(pidFile, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+		if err == nil {
+			_, err = f.WriteString(strconv.Itoa(os.Getpid()))
+			if closeErr := f.Close(); err == nil {
+				err = closeErr
+			}
+			if err != nil {
+				os.Remove(pidFile)
+				return "", fmt.Errorf("failed to write PID file: %w", err)
+			}
+			return pidFile, nil
+		}
+		if !os.IsExist(err) {
+			return "", fmt.Errorf("failed to create PID file: %w", err)
+		}
+
+		pid, err := readPid(pidFile)
+		if err == nil && processAlive(pid) {
+			return "", fmt.Errorf("already running with PID %d; run 'queuectl worker stop --name %s' first", pid, name)
+		}
+		log.Printf("Removing stale PID file %s", pidFile)
+		if err := os.Remove(pidFile); err != nil && !os.IsNotExist(err) {
+			return "", err
+		}
+	}
+}
+
+func readPid(pidFile string) (int, error) {
+	pidBytes, err := os.ReadFile(pidFile)
+	if err != nil {
+		return 0, err
+	}
+	pid, err := strconv.Atoi(strings.TrimSpace(string(pidBytes)))
+	if err != nil {
+		return 0, fmt.Errorf("invalid PID in PID file: %w", err)
+	}
+	return pid, nil
+}
+
+// processAlive reports whether a process with the given PID exists.
+func processAlive(pid int) bool {
+	err := syscall.Kill(pid, 0)
+	return err == nil || errors.Is(err, syscall.EPERM)
+}
+
+// ListManagers returns the names of the managers with a PID file on this host.
+func ListManagers() ([]string, error) {
+	dir, err := pidDir()
+	if err != nil {
+		return nil, err
+	}
+	files, err := filepath.Glob(filepath.Join(dir, "*.pid"))
+	if err != nil {
+		return nil, err
+	}
+	var names []string
+	for _, f := range files {
+		names = append(names, strings.TrimSuffix(filepath.Base(f), ".pid"))
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// StopManager sends SIGTERM to the named manager on this host, which then lets its
+// workers finish their current jobs before exiting.
+func StopManager(name string) error {
+	pidFile, err := getPidFilePath(name)
+	if err != nil {
+		return fmt.Errorf("error getting PID file path: %w", err)
+	}
+
+	pid, err := readPid(pidFile)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return fmt.Errorf("manager %s is not running", name)
+		}
+		return err
+	}
+
+	log.Printf("Sending SIGTERM to manager %s with PID %d", name, pid)
+	if err := syscall.Kill(pid, syscall.SIGTERM); err != nil {
+		if errors.Is(err, syscall.ESRCH) {
+			log.Printf("Manager %s is not running. Removing stale PID file.", name)
+			os.Remove(pidFile)
+			return nil
+		}
+		return fmt.Errorf("failed to send signal to process %d: %w", pid, err)
+	}
+
+	// The PID file is removed by the manager itself upon clean exit.
+	log.Printf("Stop signal sent. Manager %s should shut down shortly.", name)
+	return nil
+}
+
+// StopAllManagers stops every manager on this host.
+func StopAllManagers() error {
+	names, err := ListManagers()
+	if err != nil {
+		return err
+	}
+	if len(names) == 0 {
+		return fmt.Errorf("no managers are running")
+	}
+	var failed []string
+	for _, name := range names {
+		if err := StopManager(name); err != nil {
+			log.Printf("Failed to stop manager %s: %v", name, err)
+			failed = append(failed, name)
+		}
+	}
+	if len(failed) > 0 {
+		return fmt.Errorf("failed to stop managers: %s", strings.Join(failed, ", "))
+	}
+	return nil
+}
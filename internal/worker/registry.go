@@ -0,0 +1,103 @@
+package worker
+
+import (
+	"errors"
+	"log"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/Trishvan/queuectl/internal/config"
+	"github.com/Trishvan/queuectl/internal/store"
+)
+
+// joinRegistry registers the worker in the store and heartbeats its entry, with the job
+// it is running, until the returned function is called to remove it again. Registry
+// errors are logged but never stop the worker from processing jobs.
+func (w *Worker) joinRegistry() func() {
+	w.register()
+
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		ticker := time.NewTicker(w.Cfg.LeaseDuration.Duration / 3)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				w.heartbeat()
+			}
+		}
+	}()
+
+	return func() {
+		close(done)
+		wg.Wait()
+		if err := w.Store.UnregisterWorker(w.Owner); err != nil {
+			log.Printf("Worker %d: Error unregistering: %v", w.ID, err)
+		}
+	}
+}
+
+func (w *Worker) register() {
+	now := time.Now().UTC()
+	rec := &store.WorkerRecord{
+		ID:         w.Owner,
+		Hostname:   w.hostname,
+		ManagerPID: os.Getpid(),
+		Queue:      w.Queue,
+		CurrentJob: w.getCurrentJob(),
+		StartedAt:  w.startedAt,
+		LastSeen:   now,
+	}
+	if err := w.Store.RegisterWorker(rec); err != nil {
+		log.Printf("Worker %d: Error registering: %v", w.ID, err)
+	}
+}
+
+// heartbeat refreshes the worker's registry entry, registering it again if it has been
+// pruned in the meantime.
+func (w *Worker) heartbeat() {
+	err := w.Store.HeartbeatWorker(w.Owner, w.getCurrentJob(), time.Now().UTC())
+	if errors.Is(err, store.ErrWorkerNotRegistered) {
+		w.register()
+		return
+	}
+	if err != nil {
+		log.Printf("Worker %d: Error sending heartbeat: %v", w.ID, err)
+	}
+}
+
+// startJob records the job the worker is running and publishes it to the registry
+// straight away.
+func (w *Worker) startJob(id string) {
+	w.mu.Lock()
+	w.currentJob = id
+	w.mu.Unlock()
+	w.heartbeat()
+}
+
+// finishJob marks the worker idle again and counts the job it ran.
+func (w *Worker) finishJob() {
+	w.mu.Lock()
+	w.currentJob = ""
+	w.processed++
+	w.mu.Unlock()
+	w.heartbeat()
+}
+
+func (w *Worker) getCurrentJob() string {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.currentJob
+}
+
+// ListLiveWorkers returns the registered workers that have sent a heartbeat within the
+// lease duration. Workers that have been silent for longer are presumed dead.
+func ListLiveWorkers(s store.Store, cfg *config.Config) ([]*store.WorkerRecord, error) {
+	return s.ListWorkers(time.Now().UTC().Add(-cfg.LeaseDuration.Duration))
+}
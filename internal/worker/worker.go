@@ -2,19 +2,22 @@ package worker
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log"
-	"math"
+	"net/http"
 	"os"
-	"path/filepath"
 	"os/exec"
 	"os/signal"
 	"strconv"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"syscall"
 	"time"
 
 	"github.com/Trishvan/queuectl/internal/config"
+	"github.com/Trishvan/queuectl/internal/scheduler"
 	"github.com/Trishvan/queuectl/internal/store"
 )
 
@@ -23,190 +26,630 @@ type Worker struct {
 	ID    int
 	Store store.Store
 	Cfg   *config.Config
+	// Queue is the queue this worker takes jobs from. Empty means any queue.
+	Queue string
+	// Owner identifies this worker in the worker registry and on the attempts it records.
+	// The leases of its jobs are held by the manager; see Dispatcher.Owner.
+	Owner string
+	// Metrics, if set, receives the outcome of every job the worker runs.
+	Metrics *Metrics
+	// Completions, if set, writes the results of the worker's attempts in batches.
+	// Otherwise each result is written before the worker takes its next job.
+	Completions *CompletionWriter
+
+	hostname  string
+	startedAt time.Time
+
+	mu         sync.Mutex
+	currentJob string
+	processed  int
 }
 
-func NewWorker(id int, s store.Store, cfg *config.Config) *Worker {
+func NewWorker(id int, queue string, s store.Store, cfg *config.Config) *Worker {
+	hostname, err := os.Hostname()
+	if err != nil {
+		hostname = "unknown"
+	}
 	return &Worker{
 		ID:    id,
 		Store: s,
 		Cfg:   cfg,
+		Queue: queue,
+		Owner: fmt.Sprintf("%s:%d:%d", hostname, os.Getpid(), id),
+
+		hostname:  hostname,
+		startedAt: time.Now().UTC(),
 	}
 }
 
-// Run starts the worker's processing loop.
-func (w *Worker) Run(ctx context.Context) {
-	log.Printf("Worker %d started", w.ID)
+// Run processes the jobs d hands the worker until ctx is cancelled. A job already
+// running when ctx is cancelled is finished first.
+func (w *Worker) Run(ctx context.Context, d *Dispatcher) {
+	if w.Queue != "" {
+		log.Printf("Worker %d started on queue %s", w.ID, w.Queue)
+	} else {
+		log.Printf("Worker %d started", w.ID)
+	}
+	w.Metrics.workerStarted(w.Queue)
+	defer w.Metrics.workerStopped(w.Queue)
+	leaveRegistry := w.joinRegistry()
+	defer leaveRegistry()
 	for {
-		select {
-		case <-ctx.Done():
+		job := d.next(ctx, w)
+		if job == nil {
 			log.Printf("Worker %d shutting down", w.ID)
 			return
-		default:
-			job, err := w.Store.FindAndLockJob()
-			if err != nil {
-				log.Printf("Worker %d: Error finding job: %v", w.ID, err)
-				time.Sleep(1 * time.Second) // Avoid busy-looping on DB error
-				continue
-			}
-
-			if job == nil {
-				time.Sleep(1 * time.Second) // No job found, wait a bit
-				continue
-			}
-
-			w.processJob(job)
 		}
+
+		w.Metrics.jobClaimed(w.Queue, job)
+		w.startJob(job.ID)
+		w.processJob(job)
+		w.finishJob()
+		w.Metrics.jobReleased(w.Queue)
 	}
 }
 
 func (w *Worker) processJob(job *store.Job) {
+	// A panic must not take the whole manager down. The job keeps its lease, but the
+	// heartbeat is stopped, so the lease is left to expire and the reaper reclaims it.
+	defer func() {
+		if r := recover(); r != nil {
+			log.Printf("Worker %d: Panic while processing job %s: %v", w.ID, job.ID, r)
+		}
+	}()
+
 	log.Printf("Worker %d: Processing job %s (Attempt %d)", w.ID, job.ID, job.Attempts)
 
+	lease := job.LeaseOwner
+	stop, stopHeartbeat := w.startHeartbeat(job)
+	defer stopHeartbeat()
+
+	attempt := &store.Attempt{
+		JobID:     job.ID,
+		Rerun:     job.Reruns,
+		Attempt:   job.Attempts,
+		Worker:    w.Owner,
+		StartedAt: time.Now().UTC(),
+	}
+	stdout := newCappedBuffer(w.Cfg.OutputLimit)
+	stderr := newCappedBuffer(w.Cfg.OutputLimit)
+
 	// The command can be complex, so we use "sh -c" to execute it
 	cmd := exec.Command("sh", "-c", job.Command)
-	output, err := cmd.CombinedOutput()
+	if len(job.Env) > 0 {
+		cmd.Env = append(os.Environ(), job.Env.Environ()...)
+	}
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+	timeout := job.Timeout
+	if timeout == 0 {
+		timeout = w.Cfg.DefaultTimeout.Duration
+	}
+	killReason, err := runCommand(cmd, timeout, w.Cfg.KillGrace.Duration, stop)
 
-	if err != nil {
-		log.Printf("Worker %d: Job %s failed: %v. Output: %s", w.ID, job.ID, err, string(output))
-		w.handleFailure(job)
-	} else {
-		log.Printf("Worker %d: Job %s completed successfully. Output: %s", w.ID, job.ID, string(output))
+	stopHeartbeat()
+	job.LeaseOwner = ""
+	job.LeaseExpiresAt = time.Time{}
+
+	attempt.FinishedAt = time.Now().UTC()
+	attempt.Stdout = stdout.String()
+	attempt.Stderr = stderr.String()
+	recordExit(attempt, cmd, killReason, err)
+
+	if killReason == store.ReasonLeaseLost {
+		// The job belongs to whoever reclaimed it now, so only the attempt is saved.
+		log.Printf("Worker %d: Lost the lease on job %s, stopped it", w.ID, job.ID)
+		if err := w.Store.RecordAttempt(attempt); err != nil {
+			log.Printf("Worker %d: Error recording attempt %d of job %s: %v", w.ID, attempt.Attempt, job.ID, err)
+		}
+		return
+	}
+
+	switch {
+	case killReason == store.ReasonCancelled:
+		log.Printf("Worker %d: Job %s was cancelled", w.ID, job.ID)
+		job.State = store.StateCancelled
+	case err != nil:
+		if killReason == store.ReasonTimedOut {
+			log.Printf("Worker %d: Job %s timed out after %v", w.ID, job.ID, timeout)
+		} else {
+			log.Printf("Worker %d: Job %s failed: %v. Stderr: %s", w.ID, job.ID, err, attempt.Stderr)
+		}
+		w.handleFailure(job, attempt)
+	default:
+		log.Printf("Worker %d: Job %s completed successfully. Output: %s", w.ID, job.ID, attempt.Stdout)
 		job.State = store.StateCompleted
-		if err := w.Store.UpdateJob(job); err != nil {
-			log.Printf("Worker %d: Error updating completed job %s: %v", w.ID, job.ID, err)
+	}
+	w.Metrics.attemptFinished(job, attempt)
+
+	if w.Completions != nil {
+		w.Completions.Submit(&store.JobResult{Job: job, Attempt: attempt, Lease: lease})
+		return
+	}
+	if err := w.Store.RecordAttempt(attempt); err != nil {
+		log.Printf("Worker %d: Error recording attempt %d of job %s: %v", w.ID, attempt.Attempt, job.ID, err)
+	}
+	if err := w.Store.UpdateJob(job, lease); err != nil {
+		log.Printf("Worker %d: Error updating job %s: %v", w.ID, job.ID, err)
+	}
+}
+
+// startHeartbeat renews the job's lease periodically while it runs so the reaper does
+// not reclaim it. If the heartbeat finds the job has been cancelled, or its lease has been
+// lost to a reclaim, it sends the reason to stop the job on the returned channel. The
+// returned function stops the heartbeat; calling it again does nothing.
+func (w *Worker) startHeartbeat(job *store.Job) (<-chan store.FailureReason, func()) {
+	lease := w.Cfg.LeaseDuration.Duration
+	done := make(chan struct{})
+	stop := make(chan store.FailureReason, 1)
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		ticker := time.NewTicker(lease / 3)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				cancelRequested, err := w.Store.RenewLease(job.ID, job.LeaseOwner, lease)
+				if errors.Is(err, store.ErrLeaseLost) {
+					log.Printf("Worker %d: Lease on job %s was lost, stopping it", w.ID, job.ID)
+					stop <- store.ReasonLeaseLost
+					return
+				}
+				if err != nil {
+					log.Printf("Worker %d: Failed to renew lease on job %s: %v", w.ID, job.ID, err)
+					continue
+				}
+				if cancelRequested {
+					log.Printf("Worker %d: Cancellation requested for job %s, stopping it", w.ID, job.ID)
+					stop <- store.ReasonCancelled
+					return
+				}
+			}
 		}
+	}()
+	var once sync.Once
+	return stop, func() {
+		once.Do(func() {
+			close(done)
+			wg.Wait()
+		})
 	}
 }
 
-func (w *Worker) handleFailure(job *store.Job) {
-	if job.Attempts >= job.MaxRetries {
-		log.Printf("Worker %d: Job %s has reached max retries. Moving to DLQ.", w.ID, job.ID)
-		job.State = store.StateDead
-	} else {
+// handleFailure classifies a failed attempt and either schedules the job's next
+// attempt or moves it to the DLQ.
+func (w *Worker) handleFailure(job *store.Job, attempt *store.Attempt) {
+	attempt.Classification = w.classify(job, attempt)
+
+	switch attempt.Classification {
+	case store.ClassRetry:
 		job.State = store.StateFailed // Intermediate state, will be set to pending
-		backoffDuration := time.Duration(math.Pow(w.Cfg.BackoffBase, float64(job.Attempts))) * time.Second
+		backoffDuration := retryDelay(job, w.Cfg.BackoffBase)
 		job.NextRunAt = time.Now().UTC().Add(backoffDuration)
 		job.State = store.StatePending // Set back to pending for the next run
 		log.Printf("Worker %d: Job %s will be retried in %v.", w.ID, job.ID, backoffDuration)
+	case store.ClassRetriesExhausted:
+		log.Printf("Worker %d: Job %s has reached max retries. Moving to DLQ.", w.ID, job.ID)
+		job.State = store.StateDead
+	default:
+		log.Printf("Worker %d: Job %s failed with a non-retryable error (%s). Moving to DLQ.", w.ID, job.ID, attempt.Classification)
+		job.State = store.StateDead
 	}
+}
 
-	if err := w.Store.UpdateJob(job); err != nil {
-		log.Printf("Worker %d: Error updating failed job %s: %v", w.ID, job.ID, err)
+// classify decides whether a failed attempt may be retried. Exit code lists set on the
+// job take precedence over the global ones.
+func (w *Worker) classify(job *store.Job, attempt *store.Attempt) store.Classification {
+	switch attempt.Reason {
+	case store.ReasonExitCode:
+		failFast := job.FailFastExitCodes
+		if len(failFast) == 0 {
+			failFast = w.Cfg.FailFastExitCodes
+		}
+		retryOn := job.RetryOnExitCodes
+		if len(retryOn) == 0 {
+			retryOn = w.Cfg.RetryOnExitCodes
+		}
+		if containsCode(failFast, attempt.ExitCode) {
+			return store.ClassFailFast
+		}
+		if len(retryOn) > 0 && !containsCode(retryOn, attempt.ExitCode) {
+			return store.ClassNotRetryable
+		}
+	case store.ReasonTimedOut:
+		if !w.Cfg.RetryTimeouts {
+			return store.ClassNotRetryable
+		}
+	}
+
+	if job.Attempts >= job.MaxRetries {
+		return store.ClassRetriesExhausted
+	}
+	return store.ClassRetry
+}
+
+func containsCode(codes []int, code int) bool {
+	for _, c := range codes {
+		if c == code {
+			return true
+		}
+	}
+	return false
+}
+
+// Pool is a group of workers dedicated to one queue.
+type Pool struct {
+	Queue string `json:"queue"` // Empty means the pool takes jobs from any queue
+	Count int    `json:"count"`
+}
+
+// ParsePools parses a pool specification such as "emails:4,reports:1".
+// A queue without a count gets a single worker.
+func ParsePools(spec string) ([]Pool, error) {
+	var pools []Pool
+	seen := make(map[string]bool)
+	for _, part := range strings.Split(spec, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		queue, countStr := part, "1"
+		if i := strings.LastIndex(part, ":"); i >= 0 {
+			queue, countStr = part[:i], part[i+1:]
+		}
+		count, err := strconv.Atoi(countStr)
+		if err != nil || count < 1 {
+			return nil, fmt.Errorf("invalid worker count for queue %q: %s", queue, countStr)
+		}
+		if queue == "" {
+			return nil, fmt.Errorf("empty queue name in %q", part)
+		}
+		if seen[queue] {
+			return nil, fmt.Errorf("queue %q listed more than once", queue)
+		}
+		seen[queue] = true
+		pools = append(pools, Pool{Queue: queue, Count: count})
+	}
+	if len(pools) == 0 {
+		return nil, fmt.Errorf("no queues given")
 	}
+	return pools, nil
 }
 
 // Manager orchestrates multiple workers.
 type Manager struct {
-	Count int
+	Pools []Pool
 	Store store.Store
 	Cfg   *config.Config
+	// Name identifies the manager among those running on this host, so each can be
+	// stopped on its own. Managers on different hosts may share a name.
+	Name string
+	// MetricsAddr, if set, is the address to serve Prometheus metrics on at /metrics.
+	MetricsAddr string
+
+	// Runtime state, set up by Start.
+	ctx         context.Context
+	metrics     *Metrics
+	dispatcher  *Dispatcher
+	completions *CompletionWriter
+	startedAt   time.Time
+	paused      int32
+	workerWG    sync.WaitGroup
+	drain       chan struct{} // Closed to shut the manager down
+	drainOnce   sync.Once
+	stopped     chan struct{} // Closed once every worker has exited
+
+	mu       sync.Mutex
+	nextID   int
+	running  []*runningWorker // In start order
+	stopping bool
 }
 
-func NewManager(count int, s store.Store, cfg *config.Config) *Manager {
-	return &Manager{
-		Count: count,
-		Store: s,
-		Cfg:   cfg,
+// runningWorker is a worker goroutine and the means to stop it.
+type runningWorker struct {
+	worker *Worker
+	cancel context.CancelFunc
+}
+
+func NewManager(name string, pools []Pool, s store.Store, cfg *config.Config) *Manager {
+	m := &Manager{
+		Pools:      pools,
+		Store:      s,
+		Cfg:        cfg,
+		Name:       name,
+		dispatcher: NewDispatcher(s, cfg),
+		drain:      make(chan struct{}),
+		stopped:    make(chan struct{}),
 	}
+	m.dispatcher.Paused = m.isPaused
+	return m
 }
 
 func (m *Manager) Start() {
-	pidFile, err := getPidFilePath()
+	pidFile, err := acquirePidFile(m.Name)
 	if err != nil {
-		log.Fatalf("Error getting PID file path: %v", err)
-	}
-	if _, err := os.Stat(pidFile); err == nil {
-		log.Fatalf("Workers already running or PID file stale. Please run 'queuectl worker stop' or remove %s", pidFile)
+		log.Fatalf("Cannot start manager %s: %v", m.Name, err)
 	}
+	defer os.Remove(pidFile)
 
-	if err := os.WriteFile(pidFile, []byte(strconv.Itoa(os.Getpid())), 0644); err != nil {
-		log.Fatalf("Failed to write PID file: %v", err)
+	// Everything a control request can reach is set up before the socket accepts one.
+	ctx, cancel := context.WithCancel(context.Background())
+	m.ctx = ctx
+	m.startedAt = time.Now().UTC()
+	m.completions = NewCompletionWriter(m.Store, m.dispatcher.Wake)
+	if m.MetricsAddr != "" {
+		m.metrics = NewMetrics(m.Store)
 	}
-	defer os.Remove(pidFile)
 
-	log.Printf("Starting %d workers...", m.Count)
+	control, err := m.listenControl()
+	if err != nil {
+		log.Fatalf("Cannot start manager %s: %v", m.Name, err)
+	}
+	log.Printf("Manager %s started with PID %d", m.Name, os.Getpid())
 
-	ctx, cancel := context.WithCancel(context.Background())
 	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		m.dispatcher.Run(ctx)
+	}()
 
-	for i := 1; i <= m.Count; i++ {
+	if m.metrics != nil {
 		wg.Add(1)
-		worker := NewWorker(i, m.Store, m.Cfg)
 		go func() {
 			defer wg.Done()
-			worker.Run(ctx)
+			m.serveMetrics(ctx, m.metrics)
 		}()
 	}
 
-	// Graceful shutdown
+	m.mu.Lock()
+	for _, pool := range m.Pools {
+		if pool.Queue != "" {
+			log.Printf("Starting %d workers for queue %s...", pool.Count, pool.Queue)
+		} else {
+			log.Printf("Starting %d workers...", pool.Count)
+		}
+		for i := 0; i < pool.Count; i++ {
+			m.startWorker(pool.Queue)
+		}
+	}
+	m.mu.Unlock()
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		m.runReaper(ctx)
+	}()
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		sched := scheduler.New(m.Store, m.Cfg)
+		sched.Enqueued = func(jobs []*store.Job) {
+			m.metrics.jobsEnqueued(countByQueue(jobs))
+			m.dispatcher.Wake()
+		}
+		sched.Run(ctx)
+	}()
+
+	// Graceful shutdown, on a signal or a drain request over the control socket
 	sigChan := make(chan os.Signal, 1)
 	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
-	<-sigChan
+	select {
+	case <-sigChan:
+		log.Println("Shutdown signal received, stopping workers gracefully...")
+	case <-m.drain:
+		log.Println("Drain requested, stopping workers gracefully...")
+	}
 
-	log.Println("Shutdown signal received, stopping workers gracefully...")
+	m.mu.Lock()
+	m.stopping = true
+	m.mu.Unlock()
 	cancel()
+	m.workerWG.Wait()
+	m.completions.Close()
 	wg.Wait()
 	log.Println("All workers have stopped.")
+
+	close(m.stopped)
+	control.Close()
 }
 
-func StopWorkers() error {
-	pidFile, err := getPidFilePath()
-	if err != nil {
-		return fmt.Errorf("error getting PID file path: %w", err)
+// startWorker starts a worker for queue. m.mu must be held.
+func (m *Manager) startWorker(queue string) {
+	if m.stopping {
+		return
 	}
+	m.nextID++
+	worker := NewWorker(m.nextID, queue, m.Store, m.Cfg)
+	worker.Metrics = m.metrics
+	worker.Completions = m.completions
+	ctx, cancel := context.WithCancel(m.ctx)
+	m.running = append(m.running, &runningWorker{worker: worker, cancel: cancel})
 
-	pidBytes, err := os.ReadFile(pidFile)
-	if err != nil {
-		return fmt.Errorf("workers not running or PID file not found: %w", err)
+	m.workerWG.Add(1)
+	go func() {
+		defer m.workerWG.Done()
+		defer cancel()
+		worker.Run(ctx, m.dispatcher)
+	}()
+}
+
+// Scale changes the number of workers serving queue to count. Workers that are removed
+// finish their current job first. An empty queue names the manager's only pool; a queue
+// the manager does not serve yet gets a new pool.
+func (m *Manager) Scale(queue string, count int) error {
+	if count < 0 {
+		return fmt.Errorf("worker count must not be negative")
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.stopping {
+		return fmt.Errorf("manager is shutting down")
 	}
 
-	pid, err := strconv.Atoi(string(pidBytes))
-	if err != nil {
-		return fmt.Errorf("invalid PID in PID file: %w", err)
+	idx := -1
+	if queue == "" {
+		if len(m.Pools) != 1 {
+			return fmt.Errorf("manager serves %d pools; name the queue to scale", len(m.Pools))
+		}
+		idx = 0
+	} else {
+		for i, pool := range m.Pools {
+			if pool.Queue == queue {
+				idx = i
+				break
+			}
+		}
+		if idx < 0 {
+			m.Pools = append(m.Pools, Pool{Queue: queue})
+			idx = len(m.Pools) - 1
+		}
 	}
+	pool := &m.Pools[idx]
 
-	process, err := os.FindProcess(pid)
-	if err != nil {
-		// On Unix, FindProcess always succeeds, so we check the error from Signal
-		// but this could be an issue on Windows.
-		return fmt.Errorf("could not find process with PID %d: %w", pid, err)
+	var current []int // Indexes into m.running of the pool's workers
+	for i, rw := range m.running {
+		if rw.worker.Queue == pool.Queue {
+			current = append(current, i)
+		}
 	}
 
-	log.Printf("Sending SIGTERM to worker process with PID %d", pid)
-	if err := process.Signal(syscall.SIGTERM); err != nil {
-		// If the process doesn't exist, we might get an error.
-		// We can consider this a success and clean up the PID file.
-		if os.IsNotExist(err) {
-			log.Println("Worker process not found. Removing stale PID file.")
-			os.Remove(pidFile)
-			return nil
+	if count > len(current) {
+		for i := len(current); i < count; i++ {
+			m.startWorker(pool.Queue)
 		}
-		return fmt.Errorf("failed to send signal to process %d: %w", pid, err)
+	} else if count < len(current) {
+		// Stop the newest workers first.
+		remove := make(map[int]bool)
+		for _, i := range current[count:] {
+			m.running[i].cancel()
+			remove[i] = true
+		}
+		kept := m.running[:0]
+		for i, rw := range m.running {
+			if !remove[i] {
+				kept = append(kept, rw)
+			}
+		}
+		m.running = kept
 	}
 
-	// The PID file is removed by the daemon process itself upon clean exit.
-	// We can add a timeout here to force-remove it if needed.
-	log.Println("Stop signal sent. Workers should shut down shortly.")
+	log.Printf("Scaled pool %s from %d to %d workers", poolName(pool.Queue), len(current), count)
+	pool.Count = count
 	return nil
 }
 
-func getPidFilePath() (string, error) {
-	dataDir, err := config.GetDataDir()
-	if err != nil {
-		return "", err
+func poolName(queue string) string {
+	if queue == "" {
+		return "for all queues"
+	}
+	return queue
+}
+
+// Pause stops the manager's workers from claiming new jobs. Jobs already running finish.
+func (m *Manager) Pause() {
+	atomic.StoreInt32(&m.paused, 1)
+	log.Println("Workers paused")
+}
+
+func (m *Manager) Resume() {
+	atomic.StoreInt32(&m.paused, 0)
+	m.dispatcher.Wake()
+	log.Println("Workers resumed")
+}
+
+// Notify tells the manager that jobs may have been enqueued, so it claims them without
+// waiting for its next poll.
+func (m *Manager) Notify() {
+	m.dispatcher.Wake()
+}
+
+func (m *Manager) isPaused() bool {
+	return atomic.LoadInt32(&m.paused) == 1
+}
+
+// Drain shuts the manager down once its workers have finished their current jobs, as
+// SIGTERM does. The returned channel is closed when every worker has exited.
+func (m *Manager) Drain() <-chan struct{} {
+	m.drainOnce.Do(func() { close(m.drain) })
+	return m.stopped
+}
+
+// Info describes the manager and what each of its workers is doing.
+func (m *Manager) Info() *ManagerInfo {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	info := &ManagerInfo{
+		Name:      m.Name,
+		PID:       os.Getpid(),
+		StartedAt: m.startedAt,
+		Paused:    m.isPaused(),
+		Pools:     append([]Pool(nil), m.Pools...),
 	}
-	return filepath.Join(dataDir, "queuectl.pid"), nil
+	for _, rw := range m.running {
+		info.Workers = append(info.Workers, rw.worker.Status())
+	}
+	return info
 }
 
-func GetActiveWorkerCount() int {
-	pidFile, err := getPidFilePath()
+// serveMetrics serves /metrics on m.MetricsAddr until ctx is done.
+func (m *Manager) serveMetrics(ctx context.Context, metrics *Metrics) {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", metrics.Registry.Handler())
+	srv := &http.Server{
+		Addr:              m.MetricsAddr,
+		Handler:           mux,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		srv.Shutdown(shutdownCtx)
+	}()
+
+	log.Printf("Serving metrics on %s/metrics", m.MetricsAddr)
+	if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+		log.Printf("Metrics: Server failed: %v", err)
+	}
+}
+
+// runReaper periodically returns jobs with expired leases to the queue. This recovers
+// jobs left in processing by a manager that was killed or a worker that crashed.
+func (m *Manager) runReaper(ctx context.Context) {
+	ticker := time.NewTicker(m.Cfg.LeaseDuration.Duration / 2)
+	defer ticker.Stop()
+	for {
+		m.reap()
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (m *Manager) reap() {
+	now := time.Now().UTC()
+	requeued, dead, err := m.Store.ReclaimExpiredLeases(now)
 	if err != nil {
-		return 0
+		log.Printf("Reaper: Error reclaiming expired leases: %v", err)
+	} else if requeued > 0 || dead > 0 {
+		log.Printf("Reaper: Reclaimed %d expired jobs to pending, moved %d to DLQ", requeued, dead)
 	}
-	if _, err := os.Stat(pidFile); os.IsNotExist(err) {
-		return 0
+
+	// Workers heartbeat as often as they renew leases, so one that has missed a whole
+	// lease duration is gone.
+	pruned, err := m.Store.PruneWorkers(now.Add(-m.Cfg.LeaseDuration.Duration))
+	if err != nil {
+		log.Printf("Reaper: Error pruning dead workers: %v", err)
+	} else if pruned > 0 {
+		log.Printf("Reaper: Pruned %d dead workers from the registry", pruned)
 	}
-	// A more robust check would be to see if the process is actually running
-	// but for a summary, checking the PID file existence is a good start.
-	return 1 // We know a manager process is running, but not the worker count inside it.
 }
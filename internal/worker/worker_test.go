@@ -0,0 +1,56 @@
+package worker
+
+import (
+	"testing"
+
+	"github.com/Trishvan/queuectl/internal/config"
+	"github.com/Trishvan/queuectl/internal/store"
+)
+
+func TestClassify(t *testing.T) {
+	cases := []struct {
+		name    string
+		cfg     config.Config
+		job     store.Job
+		attempt store.Attempt
+		want    store.Classification
+	}{
+		{"retryable exit code", config.Config{}, store.Job{Attempts: 1, MaxRetries: 3},
+			store.Attempt{Reason: store.ReasonExitCode, ExitCode: 1}, store.ClassRetry},
+		{"retries used up", config.Config{}, store.Job{Attempts: 3, MaxRetries: 3},
+			store.Attempt{Reason: store.ReasonExitCode, ExitCode: 1}, store.ClassRetriesExhausted},
+		{"global fail-fast code", config.Config{FailFastExitCodes: []int{2}}, store.Job{Attempts: 1, MaxRetries: 3},
+			store.Attempt{Reason: store.ReasonExitCode, ExitCode: 2}, store.ClassFailFast},
+		{"job fail-fast code", config.Config{}, store.Job{Attempts: 1, MaxRetries: 3, FailFastExitCodes: []int{2}},
+			store.Attempt{Reason: store.ReasonExitCode, ExitCode: 2}, store.ClassFailFast},
+		{"job fail-fast codes replace the global ones", config.Config{FailFastExitCodes: []int{2}},
+			store.Job{Attempts: 1, MaxRetries: 3, FailFastExitCodes: []int{3}},
+			store.Attempt{Reason: store.ReasonExitCode, ExitCode: 2}, store.ClassRetry},
+		{"fail-fast before retries used up", config.Config{}, store.Job{Attempts: 3, MaxRetries: 3, FailFastExitCodes: []int{2}},
+			store.Attempt{Reason: store.ReasonExitCode, ExitCode: 2}, store.ClassFailFast},
+		{"exit code not in retry list", config.Config{RetryOnExitCodes: []int{75}}, store.Job{Attempts: 1, MaxRetries: 3},
+			store.Attempt{Reason: store.ReasonExitCode, ExitCode: 1}, store.ClassNotRetryable},
+		{"exit code in retry list", config.Config{RetryOnExitCodes: []int{75}}, store.Job{Attempts: 1, MaxRetries: 3},
+			store.Attempt{Reason: store.ReasonExitCode, ExitCode: 75}, store.ClassRetry},
+		{"job retry list replaces the global one", config.Config{RetryOnExitCodes: []int{75}},
+			store.Job{Attempts: 1, MaxRetries: 3, RetryOnExitCodes: []int{1}},
+			store.Attempt{Reason: store.ReasonExitCode, ExitCode: 1}, store.ClassRetry},
+		{"fail-fast wins over the retry list", config.Config{}, store.Job{Attempts: 1, MaxRetries: 3, FailFastExitCodes: []int{2}, RetryOnExitCodes: []int{2}},
+			store.Attempt{Reason: store.ReasonExitCode, ExitCode: 2}, store.ClassFailFast},
+		{"retry list ignores signals", config.Config{RetryOnExitCodes: []int{75}}, store.Job{Attempts: 1, MaxRetries: 3},
+			store.Attempt{Reason: store.ReasonSignal, ExitCode: -1}, store.ClassRetry},
+		{"timeout retried", config.Config{RetryTimeouts: true}, store.Job{Attempts: 1, MaxRetries: 3},
+			store.Attempt{Reason: store.ReasonTimedOut, ExitCode: -1}, store.ClassRetry},
+		{"timeout not retried", config.Config{RetryTimeouts: false}, store.Job{Attempts: 1, MaxRetries: 3},
+			store.Attempt{Reason: store.ReasonTimedOut, ExitCode: -1}, store.ClassNotRetryable},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			w := &Worker{Cfg: &c.cfg}
+			if got := w.classify(&c.job, &c.attempt); got != c.want {
+				t.Errorf("classify = %s, want %s", got, c.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,222 @@
+package workflow
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/Trishvan/queuectl/internal/store"
+	"github.com/google/uuid"
+	"gopkg.in/yaml.v3"
+)
+
+// File is a workflow file: named steps, each a job spec as accepted by enqueue, that
+// depend on one another.
+type File struct {
+	Name  string            `yaml:"name"`
+	Queue string            `yaml:"queue"` // Queue of the steps that do not name one
+	Env   map[string]string `yaml:"env"`   // Shared by every step; a step's own env wins
+	Steps []Step            `yaml:"steps"`
+}
+
+// Step is one step of a workflow file.
+type Step struct {
+	Name      string            `yaml:"name"`
+	DependsOn []string          `yaml:"depends_on"` // Names of other steps
+	Env       map[string]string `yaml:"env"`
+	// Spec holds the rest of the step: the job spec its job is made from.
+	Spec map[string]interface{} `yaml:",inline"`
+}
+
+// stepName restricts step names to characters that read well in job IDs.
+var stepName = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+// Parse reads a workflow file in YAML or JSON, which is also YAML, and checks its steps.
+// The steps are returned in an order that puts every step after the steps it depends on,
+// otherwise keeping the order of the file.
+func Parse(data []byte) (*File, error) {
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+	var f File
+	if err := dec.Decode(&f); err != nil {
+		if errors.Is(err, io.EOF) {
+			return nil, fmt.Errorf("the workflow file is empty")
+		}
+		return nil, err
+	}
+	if len(f.Steps) == 0 {
+		return nil, fmt.Errorf("the workflow has no steps")
+	}
+
+	steps := make(map[string]bool)
+	for _, step := range f.Steps {
+		if !stepName.MatchString(step.Name) {
+			return nil, fmt.Errorf("invalid step name %q: use letters, digits, '-' and '_'", step.Name)
+		}
+		if steps[step.Name] {
+			return nil, fmt.Errorf("step %s is defined twice", step.Name)
+		}
+		steps[step.Name] = true
+		// The inline Spec takes every key the step does not declare, so KnownFields cannot
+		// catch a misspelt job field; check them against the job spec instead.
+		keys := make([]string, 0, len(step.Spec))
+		for key := range step.Spec {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			if !store.IsSpecField(key) {
+				return nil, fmt.Errorf("step %s: unknown field %s", step.Name, key)
+			}
+		}
+		for _, field := range []string{"id", "idempotency_key", "idempotency_scope", "idempotency_ttl"} {
+			if _, ok := step.Spec[field]; ok {
+				return nil, fmt.Errorf("step %s: steps cannot set %s", step.Name, field)
+			}
+		}
+		if command, _ := step.Spec["command"].(string); strings.TrimSpace(command) == "" {
+			return nil, fmt.Errorf("step %s has no command", step.Name)
+		}
+	}
+	for _, step := range f.Steps {
+		for _, dep := range step.DependsOn {
+			if !steps[dep] {
+				return nil, fmt.Errorf("step %s depends on unknown step %s", step.Name, dep)
+			}
+		}
+	}
+
+	sorted, err := sortSteps(f.Steps)
+	if err != nil {
+		return nil, err
+	}
+	f.Steps = sorted
+	return &f, nil
+}
+
+// sortSteps orders steps so that each comes after its dependencies, taking the first
+// step in file order whose dependencies are all placed each time.
+func sortSteps(steps []Step) ([]Step, error) {
+	placed := make(map[string]bool)
+	var sorted []Step
+	for len(sorted) < len(steps) {
+		progress := false
+		for _, step := range steps {
+			if placed[step.Name] || !dependenciesPlaced(step, placed) {
+				continue
+			}
+			placed[step.Name] = true
+			sorted = append(sorted, step)
+			progress = true
+			break
+		}
+		if !progress {
+			var cycle []string
+			for _, step := range steps {
+				if !placed[step.Name] {
+					cycle = append(cycle, step.Name)
+				}
+			}
+			return nil, fmt.Errorf("steps %s depend on each other in a cycle", strings.Join(cycle, ", "))
+		}
+	}
+	return sorted, nil
+}
+
+func dependenciesPlaced(step Step, placed map[string]bool) bool {
+	for _, dep := range step.DependsOn {
+		if !placed[dep] {
+			return false
+		}
+	}
+	return true
+}
+
+// JobID returns the ID of the job that runs step in the workflow run runID.
+func JobID(runID, step string) string {
+	return runID + "." + step
+}
+
+// NewRun makes a workflow run of f with a new ID, and the jobs of its steps in the order
+// they must be enqueued.
+func (f *File) NewRun(defaultMaxRetries int) (*store.Workflow, []*store.Job, error) {
+	wf := &store.Workflow{
+		ID:        uuid.New().String(),
+		Name:      f.Name,
+		CreatedAt: time.Now().UTC(),
+	}
+
+	var jobs []*store.Job
+	for _, step := range f.Steps {
+		job, err := f.stepJob(wf.ID, step, defaultMaxRetries)
+		if err != nil {
+			return nil, nil, fmt.Errorf("step %s: %w", step.Name, err)
+		}
+		wf.Steps = append(wf.Steps, store.WorkflowStep{Name: step.Name, JobID: job.ID, DependsOn: step.DependsOn})
+		jobs = append(jobs, job)
+	}
+	return wf, jobs, nil
+}
+
+// stepJob makes the job of one step, filling in what the step inherits from the workflow.
+func (f *File) stepJob(runID string, step Step, defaultMaxRetries int) (*store.Job, error) {
+	spec := make(map[string]interface{}, len(step.Spec)+4)
+	for k, v := range step.Spec {
+		spec[k] = v
+	}
+	spec["id"] = JobID(runID, step.Name)
+	if _, ok := spec["queue"]; !ok && f.Queue != "" {
+		spec["queue"] = f.Queue
+	}
+
+	var dependsOn []string
+	for _, dep := range step.DependsOn {
+		dependsOn = append(dependsOn, JobID(runID, dep))
+	}
+	spec["depends_on"] = dependsOn
+
+	env := make(map[string]string, len(f.Env)+len(step.Env))
+	for k, v := range f.Env {
+		env[k] = v
+	}
+	for k, v := range step.Env {
+		env[k] = v
+	}
+	spec["env"] = env
+
+	b, err := json.Marshal(spec)
+	if err != nil {
+		return nil, err
+	}
+	return store.NewJobFromSpec(string(b), defaultMaxRetries)
+}
+
+// Branch returns the step named from and every step that depends on it, directly or not,
+// in the order of wf.Steps.
+func Branch(wf *store.Workflow, from string) ([]store.WorkflowStep, error) {
+	inBranch := map[string]bool{from: true}
+	var branch []store.WorkflowStep
+	for _, step := range wf.Steps {
+		if !inBranch[step.Name] {
+			for _, dep := range step.DependsOn {
+				if inBranch[dep] {
+					inBranch[step.Name] = true
+					break
+				}
+			}
+		}
+		if inBranch[step.Name] {
+			branch = append(branch, step)
+		}
+	}
+	if len(branch) == 0 {
+		return nil, fmt.Errorf("workflow %s has no step %s", wf.ID, from)
+	}
+	return branch, nil
+}
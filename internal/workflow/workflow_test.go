@@ -0,0 +1,183 @@
+package workflow
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/Trishvan/queuectl/internal/store"
+)
+
+// steps makes steps from specs such as "deploy:build,test", a name and the steps it
+// depends on.
+func steps(specs ...string) []Step {
+	var steps []Step
+	for _, spec := range specs {
+		name, deps, _ := strings.Cut(spec, ":")
+		step := Step{Name: name}
+		if deps != "" {
+			step.DependsOn = strings.Split(deps, ",")
+		}
+		steps = append(steps, step)
+	}
+	return steps
+}
+
+func stepNames(steps []Step) []string {
+	var names []string
+	for _, step := range steps {
+		names = append(names, step.Name)
+	}
+	return names
+}
+
+func TestSortSteps(t *testing.T) {
+	cases := []struct {
+		name  string
+		steps []Step
+		want  []string
+		err   string
+	}{
+		{"file order kept", steps("a", "b", "c"), []string{"a", "b", "c"}, ""},
+		{"already sorted", steps("a", "b:a", "c:b"), []string{"a", "b", "c"}, ""},
+		{"reversed chain", steps("c:b", "b:a", "a"), []string{"a", "b", "c"}, ""},
+		{"diamond", steps("deploy:test,lint", "test:build", "lint:build", "build"), []string{"build", "test", "lint", "deploy"}, ""},
+		{"independent steps stay in place", steps("x", "b:a", "a", "y"), []string{"x", "a", "b", "y"}, ""},
+		{"cycle", steps("a:c", "b:a", "c:b"), nil, "steps a, b, c depend on each other in a cycle"},
+		{"self dependency", steps("a", "b:b"), nil, "steps b depend on each other in a cycle"},
+		{"steps after a cycle are named with it", steps("ok", "a:b", "b:a", "after:a"), nil, "steps a, b, after depend on each other in a cycle"},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			sorted, err := sortSteps(c.steps)
+			if c.err != "" {
+				if err == nil || err.Error() != c.err {
+					t.Fatalf("sortSteps = %v, %v; want error %q", stepNames(sorted), err, c.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("sortSteps: %v", err)
+			}
+			if got := stepNames(sorted); !reflect.DeepEqual(got, c.want) {
+				t.Errorf("sortSteps = %v, want %v", got, c.want)
+			}
+		})
+	}
+}
+
+func TestParse(t *testing.T) {
+	cases := []struct {
+		name string
+		file string
+		want []string // Step names in order, if the file is valid
+		err  string
+	}{
+		{"sorted", `
+name: release
+steps:
+  - name: deploy
+    command: ./deploy.sh
+    depends_on: [build]
+  - name: build
+    command: make
+`, []string{"build", "deploy"}, ""},
+		{"json", `{"steps": [{"name": "a", "command": "true"}, {"name": "b", "command": "true", "depends_on": ["a"]}]}`,
+			[]string{"a", "b"}, ""},
+		{"empty", ``, nil, "the workflow file is empty"},
+		{"no steps", `name: x`, nil, "the workflow has no steps"},
+		{"cycle", `
+steps:
+  - {name: a, command: "true", depends_on: [b]}
+  - {name: b, command: "true", depends_on: [a]}
+`, nil, "steps a, b depend on each other in a cycle"},
+		{"unknown dependency", `
+steps:
+  - {name: a, command: "true", depends_on: [nope]}
+`, nil, "step a depends on unknown step nope"},
+		{"duplicate step", `
+steps:
+  - {name: a, command: "true"}
+  - {name: a, command: "false"}
+`, nil, "step a is defined twice"},
+		{"invalid name", `
+steps:
+  - {name: "a.b", command: "true"}
+`, nil, `invalid step name "a.b": use letters, digits, '-' and '_'`},
+		{"no command", `
+steps:
+  - {name: a, priority: 1}
+`, nil, "step a has no command"},
+		{"misspelt job field", `
+steps:
+  - {name: a, command: "true", max_retrys: 1}
+`, nil, "step a: unknown field max_retrys"},
+		{"step sets its ID", `
+steps:
+  - {name: a, command: "true", id: mine}
+`, nil, "step a: steps cannot set id"},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			f, err := Parse([]byte(c.file))
+			if c.err != "" {
+				if err == nil || err.Error() != c.err {
+					t.Fatalf("Parse = %v; want error %q", err, c.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Parse: %v", err)
+			}
+			if got := stepNames(f.Steps); !reflect.DeepEqual(got, c.want) {
+				t.Errorf("Parse gave steps %v, want %v", got, c.want)
+			}
+		})
+	}
+}
+
+func TestBranch(t *testing.T) {
+	wf := &store.Workflow{ID: "run"}
+	for _, step := range steps("build", "test:build", "lint:build", "docs", "deploy:test,lint", "notify:deploy,docs") {
+		wf.Steps = append(wf.Steps, store.WorkflowStep{Name: step.Name, JobID: JobID("run", step.Name), DependsOn: step.DependsOn})
+	}
+
+	cases := []struct {
+		from string
+		want []string
+		err  string
+	}{
+		{"build", []string{"build", "test", "lint", "deploy", "notify"}, ""},
+		{"test", []string{"test", "deploy", "notify"}, ""},
+		{"docs", []string{"docs", "notify"}, ""},
+		{"notify", []string{"notify"}, ""},
+		{"nope", nil, "workflow run has no step nope"},
+	}
+
+	for _, c := range cases {
+		t.Run(c.from, func(t *testing.T) {
+			branch, err := Branch(wf, c.from)
+			if c.err != "" {
+				if err == nil || err.Error() != c.err {
+					t.Fatalf("Branch = %v; want error %q", err, c.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Branch: %v", err)
+			}
+			var got []string
+			for _, step := range branch {
+				got = append(got, step.Name)
+				if step.JobID != JobID("run", step.Name) {
+					t.Errorf("step %s runs job %s", step.Name, step.JobID)
+				}
+			}
+			if !reflect.DeepEqual(got, c.want) {
+				t.Errorf("Branch(%s) = %v, want %v", c.from, got, c.want)
+			}
+		})
+	}
+}